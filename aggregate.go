@@ -0,0 +1,155 @@
+package sest
+
+import (
+	"bytes"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// aggregateCheckInterval is how often the windows of aggregated events are
+// checked for having ended.
+const aggregateCheckInterval = time.Second
+
+// aggregator counts the matches of an event over consecutive windows, per
+// value of a capture group or field, instead of delivering each. It is safe
+// for concurrent use, as files are matched concurrently.
+type aggregator struct {
+	mu     sync.Mutex
+	window time.Duration
+	// key is the name or number of the capture group, or the name of the
+	// decoded field, the matches are counted by, empty to count all
+	// together.
+	key    string
+	start  time.Time
+	groups map[string]*aggregateGroup
+	// order holds the keys in the order they were first matched in the
+	// window, which their summaries are delivered in.
+	order []string
+}
+
+// aggregateGroup is the count of the matches with a key in a window and the
+// last of them, which the summary is rendered from.
+type aggregateGroup struct {
+	count      int
+	filename   string
+	text       []byte
+	submatches []int
+	doc        map[string]interface{}
+}
+
+// aggregateSummary is the summary of the matches with a key in a window.
+type aggregateSummary struct {
+	aggregateGroup
+	key        string
+	start, end time.Time
+}
+
+// newAggregator returns nil if window is zero, delivering every match.
+func newAggregator(window time.Duration, key string, now time.Time) *aggregator {
+	if window <= 0 {
+		return nil
+	}
+	return &aggregator{window: window, key: key, start: now, groups: make(map[string]*aggregateGroup)}
+}
+
+// add counts a match of e.
+func (a *aggregator) add(e Event, filename string, text []byte, submatches []int, doc map[string]interface{}) {
+	var key string
+	if a.key != "" {
+		key = sampleValue(a.key, e, text, submatches, doc)
+	}
+	// The text is part of a read buffer, which is reused.
+	last := aggregateGroup{
+		filename:   filename,
+		text:       bytes.Clone(text),
+		submatches: append([]int(nil), submatches...),
+		doc:        doc,
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	group, ok := a.groups[key]
+	if !ok {
+		group = &aggregateGroup{}
+		a.groups[key] = group
+		a.order = append(a.order, key)
+	}
+	last.count = group.count + 1
+	*group = last
+}
+
+// flush returns the summaries of the window that ended by now, or of the
+// current one if force is set, and starts the next window. Windows without
+// matches have no summaries.
+func (a *aggregator) flush(now time.Time, force bool) []aggregateSummary {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	end := a.start.Add(a.window)
+	if now.Before(end) && !force {
+		return nil
+	}
+	if force {
+		end = now
+	}
+
+	summaries := make([]aggregateSummary, 0, len(a.order))
+	for _, key := range a.order {
+		summaries = append(summaries, aggregateSummary{aggregateGroup: *a.groups[key], key: key, start: a.start, end: end})
+	}
+	// Windows follow each other without gaps, unless no match was counted
+	// for a whole window, e.g. while sest was suspended.
+	if a.start = end; now.Sub(a.start) >= a.window {
+		a.start = now
+	}
+	a.groups = make(map[string]*aggregateGroup)
+	a.order = nil
+	return summaries
+}
+
+// flushAggregates delivers the summaries of the aggregated events whose
+// window ended, or of all of them if force is set, e.g. on shutdown.
+func (r *Runner) flushAggregates(events []Event, force bool) {
+	now := time.Now()
+	for _, event := range events {
+		if event.aggregate == nil {
+			continue
+		}
+		for _, summary := range event.aggregate.flush(now, force) {
+			r.deliverSummary(event, summary)
+		}
+	}
+}
+
+// deliverSummary renders the summary of an aggregated event from its last
+// match, with the Count of the matches, the Key they were counted by and the
+// WindowStart and WindowEnd added to the data and fields.
+func (r *Runner) deliverSummary(event Event, summary aggregateSummary) {
+	location := event.location
+	if location == nil {
+		location = time.Local
+	}
+	doc := make(map[string]interface{}, len(summary.doc)+4)
+	for key, value := range summary.doc {
+		doc[key] = value
+	}
+	doc["Count"] = summary.count
+	doc["Key"] = summary.key
+	doc["WindowStart"] = summary.start.In(location).Format(time.RFC3339)
+	doc["WindowEnd"] = summary.end.In(location).Format(time.RFC3339)
+
+	rendered, err := event.render(summary.filename, summary.text, summary.submatches, doc, 0)
+	if err != nil {
+		slog.Warn("Could not render event", "event_type", event.EventType, "err", err)
+		return
+	}
+	if len(bytes.TrimSpace(rendered.Body)) == 0 {
+		emptyEvents.WithLabelValues(event.EventType).Inc()
+		return
+	}
+	r.dispatcher.enqueue(event, rendered)
+}
+
+// aggregateData are the names of the data the summaries of aggregated events
+// add to their template data.
+var aggregateData = []string{"Count", "Key", "WindowStart", "WindowEnd"}
@@ -0,0 +1,296 @@
+package sest
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// alertCheckInterval is how often alerts are checked for having resolved.
+const alertCheckInterval = time.Second
+
+// The states of alerts, passed to the templates as State.
+const (
+	alertFiring   = "firing"
+	alertResolved = "resolved"
+)
+
+// alerter turns the matches of an event into alerts, which fire with the
+// first match and resolve once they were not matched again for a while,
+// suppressing the matches in between. It is safe for concurrent use, as
+// files are matched concurrently.
+type alerter struct {
+	mu sync.Mutex
+	// name is the key of the event in the config, by which a reload hands
+	// on the firing alerts.
+	name string
+	// key is the name or number of the capture group, or the name of the
+	// decoded field, identifying alerts, empty for the matched text.
+	key          string
+	resolveAfter time.Duration
+	firing       map[string]*alertState
+
+	// notify is whether resolved alerts are delivered. fired and resolved
+	// render and deliver the events of alerts that fired and resolved.
+	notify   bool
+	fired    alertNotice
+	resolved alertNotice
+}
+
+// alertNotice is the template and sinks of the events of firing or resolved
+// alerts, which are rendered and delivered like the event where unset.
+type alertNotice struct {
+	template []byte
+	compiled *template.Template
+	sinks    []Sink
+}
+
+// apply returns e with the template and sinks of the notice.
+func (n alertNotice) apply(e Event) Event {
+	if n.compiled != nil {
+		e.Template, e.compiled, e.output = n.template, n.compiled, outputTemplate
+	}
+	if n.sinks != nil {
+		e.Sinks = n.sinks
+	}
+	return e
+}
+
+// notices returns the notices of the alerter, to replace their sinks.
+func (a *alerter) notices() []*alertNotice {
+	return []*alertNotice{&a.fired, &a.resolved}
+}
+
+// alertState is an alert that fires and the last match of it, which the
+// resolved event is rendered from.
+type alertState struct {
+	firedAt    time.Time
+	lastSeen   time.Time
+	repeats    int
+	filename   string
+	text       []byte
+	submatches []int
+	doc        map[string]interface{}
+}
+
+// newAlerter returns the alerter of an event, nil if it sets no resolve_after.
+// The event has to be parsed already, as a resolve template is parsed like the
+// template of the event.
+func newAlerter(cfg Config, name string, eventCfg EventConfig, event Event, sinks *sinkRegistry) (*alerter, error) {
+	alert := eventCfg.Alert
+	if alert.ResolveAfter <= 0 {
+		return nil, nil
+	}
+	a := &alerter{
+		name:         name,
+		key:          alert.Key,
+		resolveAfter: alert.ResolveAfter,
+		firing:       make(map[string]*alertState),
+		notify:       alert.resolve().configured(),
+	}
+	var err error
+	if a.fired, err = newAlertNotice(cfg, eventCfg, event, sinks, alert.firing()); err != nil {
+		return nil, err
+	}
+	if a.resolved, err = newAlertNotice(cfg, eventCfg, event, sinks, alert.resolve()); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// newAlertNotice parses the template of a notice like the template of the
+// event and creates its sinks.
+func newAlertNotice(cfg Config, eventCfg EventConfig, event Event, sinks *sinkRegistry, noticeCfg alertNoticeConfig) (alertNotice, error) {
+	var n alertNotice
+	if noticeCfg.hasTemplate() {
+		content, err := noticeCfg.loadTemplate()
+		if err != nil {
+			return n, fmt.Errorf("could not load %s template: %w", noticeCfg.name, err)
+		}
+		notice := event
+		notice.Template = content
+		if n.compiled, err = notice.parse(); err != nil {
+			return n, fmt.Errorf("could not parse %s template: %w", noticeCfg.name, err)
+		}
+		n.template = content
+	}
+	if len(noticeCfg.sinks) > 0 {
+		noticeEventCfg := eventCfg
+		noticeEventCfg.Sinks = noticeCfg.sinks
+		var err error
+		if n.sinks, err = sinks.create(cfg, noticeEventCfg); err != nil {
+			return n, fmt.Errorf("could not configure %s sinks: %w", noticeCfg.name, err)
+		}
+	}
+	return n, nil
+}
+
+// fingerprint returns the key of the alert a match belongs to, the value of
+// the capture group or field of the alert, or else the matched text, group0,
+// or the whole text if the match is empty. The rendered body would not do,
+// as it changes with every match if it has a timestamp.
+func (a *alerter) fingerprint(e Event, text []byte, submatches []int, doc map[string]interface{}) string {
+	if a.key != "" {
+		return sampleValue(a.key, e, text, submatches, doc)
+	}
+	if len(submatches) >= 2 && submatches[0] >= 0 && submatches[0] < submatches[1] {
+		return string(text[submatches[0]:submatches[1]])
+	}
+	return string(text)
+}
+
+// fire records a match of the alert with key. It reports whether the match
+// fired the alert, rather than repeating one that fires.
+func (a *alerter) fire(key, filename string, text []byte, submatches []int, doc map[string]interface{}, now time.Time) bool {
+	// The text is part of a read buffer, which is reused.
+	last := alertState{
+		firedAt:    now,
+		lastSeen:   now,
+		filename:   filename,
+		text:       bytes.Clone(text),
+		submatches: append([]int(nil), submatches...),
+		doc:        doc,
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	state, ok := a.firing[key]
+	if !ok {
+		a.firing[key] = &last
+		return true
+	}
+	last.firedAt = state.firedAt
+	last.repeats = state.repeats + 1
+	*state = last
+	return false
+}
+
+// unfire drops the alert fired for key.
+func (a *alerter) unfire(key string) {
+	a.mu.Lock()
+	delete(a.firing, key)
+	a.mu.Unlock()
+}
+
+// carryAlerts hands the alerts firing for the running events on to the
+// events of a reloaded config, to the event with the same name and alert
+// key, so that a reload neither fires them again nor drops their resolved
+// event. Alerts of events whose key changed are dropped.
+func carryAlerts(running, reloaded []Event) {
+	for _, event := range reloaded {
+		if event.alert == nil {
+			continue
+		}
+		for _, old := range running {
+			if old.alert != nil && old.alert.name == event.alert.name && old.alert.key == event.alert.key {
+				event.alert.adopt(old.alert)
+				break
+			}
+		}
+	}
+}
+
+// adopt copies the firing alerts of old.
+func (a *alerter) adopt(old *alerter) {
+	old.mu.Lock()
+	defer old.mu.Unlock()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for key, state := range old.firing {
+		copied := *state
+		a.firing[key] = &copied
+	}
+}
+
+// alertResolution is an alert that resolved, with its key.
+type alertResolution struct {
+	alertState
+	key string
+}
+
+// resolve returns the alerts that were not matched for resolveAfter by now,
+// in the order they fired, and forgets them, so their next match fires them
+// again.
+func (a *alerter) resolve(now time.Time) []alertResolution {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var resolved []alertResolution
+	for key, state := range a.firing {
+		if now.Sub(state.lastSeen) >= a.resolveAfter {
+			resolved = append(resolved, alertResolution{alertState: *state, key: key})
+			delete(a.firing, key)
+		}
+	}
+	sort.Slice(resolved, func(i, j int) bool {
+		return resolved[i].firedAt.Before(resolved[j].firedAt)
+	})
+	return resolved
+}
+
+// firingData returns doc with the State of a firing alert added, which
+// templates and sinks get like the fields of a line.
+func firingData(doc map[string]interface{}) map[string]interface{} {
+	firing := make(map[string]interface{}, len(doc)+1)
+	for key, value := range doc {
+		firing[key] = value
+	}
+	firing["State"] = alertFiring
+	return firing
+}
+
+// resolveAlerts delivers the resolved events of the alerts of events that
+// resolved.
+func (r *Runner) resolveAlerts(events []Event) {
+	now := time.Now()
+	for _, event := range events {
+		if event.alert == nil {
+			continue
+		}
+		for _, resolution := range event.alert.resolve(now) {
+			slog.Debug("Alert resolved", "event_type", event.EventType, "key", resolution.key, "repeats", resolution.repeats)
+			if event.alert.notify {
+				r.deliverResolved(event, resolution, now)
+			}
+		}
+	}
+}
+
+// deliverResolved renders the resolved event of an alert from its last
+// match, with the State resolved, the times it FiredAt, was LastSeen and
+// ResolvedAt, the Duration it fired for and the number of Repeats
+// suppressed while it fired added to the data and fields.
+func (r *Runner) deliverResolved(event Event, resolution alertResolution, now time.Time) {
+	location := event.location
+	if location == nil {
+		location = time.Local
+	}
+	doc := make(map[string]interface{}, len(resolution.doc)+6)
+	for key, value := range resolution.doc {
+		doc[key] = value
+	}
+	doc["State"] = alertResolved
+	doc["FiredAt"] = resolution.firedAt.In(location).Format(time.RFC3339)
+	doc["LastSeen"] = resolution.lastSeen.In(location).Format(time.RFC3339)
+	doc["ResolvedAt"] = now.In(location).Format(time.RFC3339)
+	doc["Duration"] = now.Sub(resolution.firedAt).Round(time.Second).String()
+	doc["Repeats"] = resolution.repeats
+
+	resolved := event.alert.resolved.apply(event)
+	rendered, err := resolved.render(resolution.filename, resolution.text, resolution.submatches, doc, 0)
+	if err != nil {
+		slog.Warn("Could not render resolved event", "event_type", event.EventType, "err", err)
+		return
+	}
+	if len(bytes.TrimSpace(rendered.Body)) == 0 {
+		emptyEvents.WithLabelValues(event.EventType).Inc()
+		return
+	}
+	r.dispatcher.enqueue(resolved, rendered)
+}
+
+// alertData are the names of the data alerts add to the template data.
+var alertData = []string{"State", "FiredAt", "LastSeen", "ResolvedAt", "Duration", "Repeats"}
@@ -0,0 +1,319 @@
+package sest
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAlertFingerprint(t *testing.T) {
+	re := regexp.MustCompile(`(?P<host>\S+) is (down|up)`)
+	e := Event{Regex: re, GroupNames: re.SubexpNames()}
+	empty := regexp.MustCompile(`x*`)
+	tests := []struct {
+		name       string
+		key        string
+		text       string
+		submatches []int
+		doc        map[string]interface{}
+		want       string
+	}{
+		{name: "matched text", text: "12:00:01 web-1 is down", want: "web-1 is down"},
+		{name: "capture group name", key: "host", text: "12:00:01 web-1 is down", want: "web-1"},
+		{name: "capture group number", key: "2", text: "12:00:01 web-1 is down", want: "down"},
+		{name: "field", key: "service", text: "web-1 is down", doc: map[string]interface{}{"service": "api"}, want: "api"},
+		{name: "empty match", text: "web-1 is down", submatches: empty.FindStringSubmatchIndex("web-1 is down"), want: "web-1 is down"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			submatches := tt.submatches
+			if submatches == nil {
+				submatches = re.FindStringSubmatchIndex(tt.text)
+			}
+			a := &alerter{key: tt.key}
+			if got := a.fingerprint(e, []byte(tt.text), submatches, tt.doc); got != tt.want {
+				t.Errorf("fingerprint() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestAlerterFireResolve checks that an alert fires with its first match,
+// suppresses its repeats and resolves once it was not matched for
+// resolveAfter, so that its next match fires it again.
+func TestAlerterFireResolve(t *testing.T) {
+	a := &alerter{resolveAfter: time.Minute, firing: make(map[string]*alertState)}
+	start := time.Date(2024, time.January, 1, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) time.Time { return start.Add(d) }
+	steps := []struct {
+		// fire is the key of a match at, resolve checks for resolved
+		// alerts at if fire is empty.
+		fire string
+		at   time.Time
+		// fired is whether the match fires its alert, resolved the keys
+		// of the resolved alerts with their repeats.
+		fired    bool
+		resolved map[string]int
+	}{
+		{fire: "web-1", at: at(0), fired: true},
+		{fire: "web-1", at: at(30 * time.Second)},
+		{fire: "web-2", at: at(40 * time.Second), fired: true},
+		{at: at(80 * time.Second)},
+		{fire: "web-1", at: at(85 * time.Second)},
+		{at: at(100 * time.Second), resolved: map[string]int{"web-2": 0}},
+		{at: at(145 * time.Second), resolved: map[string]int{"web-1": 2}},
+		{at: at(time.Hour)},
+		{fire: "web-1", at: at(time.Hour), fired: true},
+	}
+	for i, step := range steps {
+		if step.fire != "" {
+			if fired := a.fire(step.fire, "app.log", []byte(step.fire+" is down"), []int{0, 12}, nil, step.at); fired != step.fired {
+				t.Errorf("step %d: fire(%s) = %v, want %v", i, step.fire, fired, step.fired)
+			}
+			continue
+		}
+		resolved := a.resolve(step.at)
+		if len(resolved) != len(step.resolved) {
+			t.Errorf("step %d: resolved %v, want %v", i, resolved, step.resolved)
+			continue
+		}
+		for _, r := range resolved {
+			if repeats, ok := step.resolved[r.key]; !ok || r.repeats != repeats {
+				t.Errorf("step %d: resolved %s with %d repeats, want %v", i, r.key, r.repeats, step.resolved)
+			}
+		}
+	}
+}
+
+// TestRunnerAlertTimestamp checks that the repeats of an alert without a key
+// are suppressed although its template renders a timestamp, which differs
+// per match.
+func TestRunnerAlertTimestamp(t *testing.T) {
+	logFile, events := runTestConfig(t, `
+input:
+  files: [app.log]
+poll_interval: 10ms
+events:
+  down:
+    src: '([\w-]+) is down'
+    template: '{{.State}} {{.group1}} at {{timestamp}} {{unixMillis}}'
+    alert:
+      resolve_after: 1h
+`)
+	appendFile(t, logFile, "web-1 is down\n")
+	if e := nextEvent(t, events); !strings.HasPrefix(string(e.Body), "firing web-1 at ") {
+		t.Errorf("got event %q, want web-1 firing", e.Body)
+	}
+	time.Sleep(5 * time.Millisecond)
+	appendFile(t, logFile, "web-1 is down\nweb-2 is down\n")
+	if e := nextEvent(t, events); !strings.HasPrefix(string(e.Body), "firing web-2 at ") {
+		t.Errorf("got event %q, want only web-2 firing", e.Body)
+	}
+}
+
+// TestRunnerAlertDropped checks that an alert whose firing event is dropped,
+// here as it renders empty, is fired by the next match.
+func TestRunnerAlertDropped(t *testing.T) {
+	logFile, events := runTestConfig(t, `
+input:
+  files: [app.log]
+poll_interval: 10ms
+events:
+  down:
+    src: '(?P<host>[\w-]+) is (?P<state>\w+)'
+    template: '{{if ne .state "quiet"}}{{.State}} {{.host}}{{end}}'
+    alert:
+      key: host
+      resolve_after: 50ms
+      resolve_template: '{{.State}} {{.host}}'
+`)
+	appendFile(t, logFile, "web-1 is quiet\n")
+	time.Sleep(20 * time.Millisecond)
+	appendFile(t, logFile, "web-1 is down\n")
+	for _, want := range []string{"firing web-1", "resolved web-1"} {
+		if e := nextEvent(t, events); string(e.Body) != want {
+			t.Errorf("got event %q, want %q", e.Body, want)
+		}
+	}
+	select {
+	case e := <-events:
+		t.Errorf("got event %q, want no more", e.Body)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// TestRunnerAlertReload checks that alerts firing before a reload keep
+// firing, and are not delivered again, unless the reload changes their key.
+func TestRunnerAlertReload(t *testing.T) {
+	const config = `
+input:
+  files: [app.log]
+poll_interval: 10ms
+events:
+  down:
+    src: '(?P<host>[\w-]+) is (?P<state>down)'
+    template: '{{.State}} {{.host}}'
+    alert:
+      key: %s
+      resolve_after: 1h
+`
+	tests := []struct {
+		name string
+		key  string
+		// want are the events of web-1 and web-2 going down after the
+		// reload.
+		want []string
+	}{
+		{name: "same key", key: "host", want: []string{"firing web-2"}},
+		{name: "changed key", key: "state", want: []string{"firing web-1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			logFile := filepath.Join(dir, "app.log")
+			appendFile(t, logFile, "")
+			matches := make(chan RenderedEvent, 10)
+			r, err := New(loadTestConfig(t, dir, fmt.Sprintf(config, "host")), OnMatch(func(e RenderedEvent) { matches <- e }))
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan error, 1)
+			go func() { done <- r.Run(ctx) }()
+			defer func() {
+				cancel()
+				<-done
+			}()
+
+			appendFile(t, logFile, "web-1 is down\n")
+			if e := nextEvent(t, matches); string(e.Body) != "firing web-1" {
+				t.Fatalf("got event %q, want web-1 firing", e.Body)
+			}
+			if err := r.Reload(loadTestConfig(t, dir, fmt.Sprintf(config, tt.key))); err != nil {
+				t.Fatal(err)
+			}
+			appendFile(t, logFile, "web-1 is down\nweb-2 is down\n")
+			for _, want := range tt.want {
+				if e := nextEvent(t, matches); string(e.Body) != want {
+					t.Errorf("got event %q, want %q", e.Body, want)
+				}
+			}
+			select {
+			case e := <-matches:
+				t.Errorf("got event %q, want no more", e.Body)
+			case <-time.After(50 * time.Millisecond):
+			}
+		})
+	}
+}
+
+// TestRunnerAlertNotices checks that firing and resolved alerts are rendered
+// with their own templates and delivered to their own sinks, where set, and
+// else like the event.
+func TestRunnerAlertNotices(t *testing.T) {
+	tests := []struct {
+		name  string
+		alert string
+		// fired and resolved are the events delivered when the alert
+		// fires and resolves, and the files they are written to.
+		fired, resolved         string
+		firedFile, resolvedFile string
+	}{
+		{
+			name:         "like the event",
+			alert:        `resolve_template: '{{.State}}'`,
+			fired:        "event firing web-1",
+			resolved:     "resolved",
+			firedFile:    "events.log",
+			resolvedFile: "events.log",
+		},
+		{
+			name: "firing template",
+			alert: `firing_template: 'fired {{.host}}'
+      resolve_template: 'resolved {{.host}} after {{.Repeats}} repeats'`,
+			fired:        "fired web-1",
+			resolved:     "resolved web-1 after 1 repeats",
+			firedFile:    "events.log",
+			resolvedFile: "events.log",
+		},
+		{
+			name: "firing dest",
+			alert: `firing_dest: fired.tmpl
+      resolve_sinks: [{type: file, path: resolved.log}]`,
+			fired:        "from file web-1",
+			resolved:     "event resolved web-1",
+			firedFile:    "events.log",
+			resolvedFile: "resolved.log",
+		},
+		{
+			name: "firing sinks",
+			alert: `firing_sinks: [{type: file, path: fired.log}]
+      resolve_sinks: [{type: file, path: resolved.log}]`,
+			fired:        "event firing web-1",
+			resolved:     "event resolved web-1",
+			firedFile:    "fired.log",
+			resolvedFile: "resolved.log",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			logFile := filepath.Join(dir, "app.log")
+			appendFile(t, logFile, "")
+			if err := os.WriteFile(filepath.Join(dir, "fired.tmpl"), []byte("from file {{.host}}"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			cfg := loadTestConfig(t, dir, `
+input:
+  files: [app.log]
+poll_interval: 10ms
+events:
+  down:
+    src: '(?P<host>[\w-]+) is down'
+    template: 'event {{.State}} {{.host}}'
+    output_file: events.log
+    alert:
+      key: host
+      resolve_after: 10ms
+      `+tt.alert+`
+`)
+			ctx, cancel := context.WithCancel(context.Background())
+			events, done := startRunner(t, ctx, cfg)
+			stop := sync.OnceFunc(func() {
+				cancel()
+				<-done
+			})
+			defer stop()
+
+			appendFile(t, logFile, "web-1 is down\nweb-1 is down\n")
+			if e := nextEvent(t, events); string(e.Body) != tt.fired || e.Fields["State"] != alertFiring {
+				t.Errorf("got event %q with fields %v, want %q firing", e.Body, e.Fields, tt.fired)
+			}
+			if e := nextEvent(t, events); string(e.Body) != tt.resolved || e.Fields["State"] != alertResolved {
+				t.Errorf("got event %q with fields %v, want %q resolved", e.Body, e.Fields, tt.resolved)
+			}
+			// The output files are complete once the Runner stopped.
+			stop()
+
+			want := map[string]string{}
+			for filename, body := range map[string]string{tt.firedFile: tt.fired, tt.resolvedFile: tt.resolved} {
+				if filename == tt.firedFile && filename == tt.resolvedFile {
+					body = tt.fired + "\n" + tt.resolved
+				}
+				want[filename] = body + "\n"
+			}
+			for _, filename := range []string{"events.log", "fired.log", "resolved.log"} {
+				content, _ := os.ReadFile(filepath.Join(dir, filename))
+				if string(content) != want[filename] {
+					t.Errorf("%s has %q, want %q", filename, content, want[filename])
+				}
+			}
+		})
+	}
+}
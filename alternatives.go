@@ -0,0 +1,91 @@
+package sest
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// compileRegexes compiles the regexes of an event, prepending flags to each.
+func compileRegexes(patterns Patterns, flags string) ([]*regexp.Regexp, error) {
+	regexes := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(flags + pattern)
+		if err != nil {
+			return nil, fmt.Errorf("could not compile regex (%s)", pattern)
+		}
+		regexes = append(regexes, re)
+	}
+	return regexes, nil
+}
+
+// variants returns the event once per regex, with the capture groups of the
+// regex. The first one is the event itself.
+func (e Event) variants() []Event {
+	variants := []Event{e}
+	for i, re := range e.Alternatives {
+		v := e
+		v.Regex, v.GroupNames, v.dedupGroup = re, re.SubexpNames(), e.altDedupGroups[i]
+		v.Alternatives, v.altDedupGroups = nil, nil
+		variants = append(variants, v)
+	}
+	return variants
+}
+
+// eventMatch is a match of an event in text, found by the regex of the
+// variant.
+type eventMatch struct {
+	variant    Event
+	submatches []int
+}
+
+// findAll returns the matches of the event in text, skipping empty matches.
+// Regexes like x* match the empty string between any two characters, which
+// would deliver an empty event per byte. A line matched by a regex is not
+// matched by the alternatives after it.
+func (e Event) findAll(text []byte) []eventMatch {
+	var found []eventMatch
+	if len(e.Alternatives) == 0 {
+		for _, submatches := range e.Regex.FindAllSubmatchIndex(text, -1) {
+			if submatches[0] != submatches[1] {
+				found = append(found, eventMatch{variant: e, submatches: submatches})
+			}
+		}
+		return found
+	}
+
+	matched := make(map[int]bool)
+	for _, v := range e.variants() {
+		var lines []int
+		for _, submatches := range v.Regex.FindAllSubmatchIndex(text, -1) {
+			if submatches[0] == submatches[1] {
+				continue
+			}
+			line := bytes.LastIndexByte(text[:submatches[0]], '\n') + 1
+			if matched[line] {
+				continue
+			}
+			lines = append(lines, line)
+			found = append(found, eventMatch{variant: v, submatches: submatches})
+		}
+		for _, line := range lines {
+			matched[line] = true
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool {
+		return found[i].submatches[0] < found[j].submatches[0]
+	})
+	return found
+}
+
+// find returns the first match of the event in a record, trying the regexes
+// in order.
+func (e Event) find(record []byte) (Event, []int) {
+	for _, v := range e.variants() {
+		if submatches := v.Regex.FindSubmatchIndex(record); submatches != nil {
+			return v, submatches
+		}
+	}
+	return e, nil
+}
@@ -0,0 +1,155 @@
+package sest
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+// matchedTexts returns the texts of matches in text.
+func matchedTexts(text string, matches []eventMatch) []string {
+	var texts []string
+	for _, m := range matches {
+		texts = append(texts, text[m.submatches[0]:m.submatches[1]])
+	}
+	return texts
+}
+
+func TestFindAllSkipsEmptyMatches(t *testing.T) {
+	tests := []struct {
+		src  string
+		text string
+		want []string
+	}{
+		{src: `x*`, text: "abc\n", want: nil},
+		{src: `x*`, text: "axxbx\n", want: []string{"xx", "x"}},
+		{src: `(?m)^`, text: "a\nb\n", want: nil},
+		{src: `\b`, text: "a b\n", want: nil},
+		{src: `(error)?`, text: "no\nerror\n", want: []string{"error"}},
+	}
+	for _, tt := range tests {
+		e := testEvent(t, tt.src, "{{.group0}}", false)
+		if got := matchedTexts(tt.text, e.findAll([]byte(tt.text))); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s in %q: findAll() = %q, want %q", tt.src, tt.text, got, tt.want)
+		}
+	}
+}
+
+// TestFindEmptyMatch checks that find, matching a record once, keeps empty
+// matches: events filtering on fields have an empty src matching any record.
+func TestFindEmptyMatch(t *testing.T) {
+	tests := []struct {
+		src    string
+		record string
+		want   []int
+	}{
+		{src: ``, record: `{"level":"error"}`, want: []int{0, 0}},
+		{src: `x*`, record: "abc", want: []int{0, 0}},
+		{src: `b+`, record: "abbc", want: []int{1, 3}},
+		{src: `x+`, record: "abc", want: nil},
+	}
+	for _, tt := range tests {
+		e := testEvent(t, tt.src, "{{.group0}}", false)
+		if _, got := e.find([]byte(tt.record)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s in %q: find() = %v, want %v", tt.src, tt.record, got, tt.want)
+		}
+	}
+}
+
+// testAlternatives returns an event matching the first of srcs and, as
+// alternatives, the others, with the template tmpl.
+func testAlternatives(t *testing.T, tmpl string, srcs ...string) Event {
+	t.Helper()
+	e := testEvent(t, srcs[0], tmpl, false)
+	for _, src := range srcs[1:] {
+		e.Alternatives = append(e.Alternatives, regexp.MustCompile(src))
+		e.altDedupGroups = append(e.altDedupGroups, -1)
+	}
+	return e
+}
+
+func TestFindAllAlternatives(t *testing.T) {
+	srcs := []string{`login of (?P<user>\w+) failed`, `(?P<user>\w+) could not log in`, `failed`}
+	tests := []struct {
+		name string
+		text string
+		// want are the rendered matches, in the order of the text.
+		want []string
+	}{
+		{name: "first regex", text: "login of alice failed\n", want: []string{"alice"}},
+		{name: "alternative", text: "bob could not log in\n", want: []string{"bob"}},
+		{name: "both formats in order", text: "bob could not log in\nlogin of alice failed\ncarol could not log in\n", want: []string{"bob", "alice", "carol"}},
+		// A line is matched by the first regex matching it only.
+		{name: "line matching several regexes", text: "login of alice failed, bob could not log in\n", want: []string{"alice"}},
+		{name: "later alternative", text: "backup failed\n", want: []string{"<no value>"}},
+		{name: "no match", text: "login of alice succeeded\n"},
+		// Every match of the regex first matching a line counts.
+		{name: "several matches in a line", text: "bob could not log in, carol could not log in\n", want: []string{"bob", "carol"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := testAlternatives(t, "{{.user}}", srcs...)
+			var got []string
+			for _, m := range e.findAll([]byte(tt.text)) {
+				rendered, err := m.variant.Render("app.log", []byte(tt.text), m.submatches)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, string(rendered.Body))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("findAll(%q) rendered %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindAlternatives(t *testing.T) {
+	e := testAlternatives(t, "{{.group1}}", `login of (\w+) failed`, `(\w+) could not log in`)
+	tests := []struct {
+		record string
+		want   string
+		// regex is the regex of the variant matching, none if empty.
+		regex string
+	}{
+		{record: "login of alice failed", want: "alice", regex: `login of (\w+) failed`},
+		{record: "bob could not log in", want: "bob", regex: `(\w+) could not log in`},
+		{record: "bob could not log in, login of alice failed", want: "alice", regex: `login of (\w+) failed`},
+		{record: "login of alice succeeded"},
+	}
+	for _, tt := range tests {
+		variant, submatches := e.find([]byte(tt.record))
+		if submatches == nil {
+			if tt.regex != "" {
+				t.Errorf("find(%q) found nothing, want %s", tt.record, tt.regex)
+			}
+			continue
+		}
+		rendered, err := variant.Render("app.log", []byte(tt.record), submatches)
+		if variant.Regex.String() != tt.regex || err != nil || string(rendered.Body) != tt.want {
+			t.Errorf("find(%q) = %s rendering %q, %v, want %s rendering %q", tt.record, variant.Regex, rendered.Body, err, tt.regex, tt.want)
+		}
+	}
+}
+
+// TestRunnerAlternatives checks that two line formats fire the same event.
+func TestRunnerAlternatives(t *testing.T) {
+	logFile, events := runTestConfig(t, `
+input:
+  files: [app.log]
+poll_interval: 10ms
+events:
+  login:
+    src:
+      - 'login of (?P<user>\w+) failed'
+      - '(?P<user>\w+) could not log in'
+    template: '{{.user}}'
+    event_type: LoginFailed
+`)
+	appendFile(t, logFile, "login of alice failed\nbob could not log in\n")
+	for _, want := range []string{"alice", "bob"} {
+		if e := nextEvent(t, events); string(e.Body) != want || e.EventType != "LoginFailed" {
+			t.Errorf("got %s event %q, want LoginFailed %q", e.EventType, e.Body, want)
+		}
+	}
+}
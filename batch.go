@@ -0,0 +1,230 @@
+package sest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// defaultBatchTimeout is how long a partial batch waits for more events if
+// the sink config sets no batch_timeout.
+const defaultBatchTimeout = time.Second
+
+// batchSink collects the events delivered to a sink and sends them together
+// once BatchSize events are collected or the oldest of them waited for
+// BatchTimeout. The events of a batch that failed are retried with the retry
+// policy of the config and then written to the dead letter file, if any, as
+// the events are accepted into a batch right away.
+type batchSink struct {
+	target     batchTarget
+	size       int
+	timeout    time.Duration
+	retry      retryPolicy
+	deadLetter *fileSink
+
+	mu      sync.Mutex
+	pending []RenderedEvent
+	timer   *time.Timer
+	// flushMu keeps batches in order.
+	flushMu sync.Mutex
+}
+
+// batchTarget sends batches of events for a batchSink.
+type batchTarget interface {
+	// sendBatch sends a batch and returns the events that failed. A target
+	// that sends the batch as a whole fails all of them at once.
+	sendBatch(ctx context.Context, batch []RenderedEvent) []batchFailure
+}
+
+// batchFailure is an event of a batch that could not be delivered, after
+// attempts attempts.
+type batchFailure struct {
+	event    RenderedEvent
+	err      error
+	attempts int
+}
+
+// failAll fails every event of a batch with err, unless err is nil.
+func failAll(batch []RenderedEvent, err error) []batchFailure {
+	if err == nil {
+		return nil
+	}
+	failures := make([]batchFailure, len(batch))
+	for i, e := range batch {
+		failures[i] = batchFailure{event: e, err: err}
+	}
+	return failures
+}
+
+func newBatchSink(target batchTarget, spec SinkConfig, retry retryPolicy, deadLetter *fileSink) *batchSink {
+	s := &batchSink{
+		target:     target,
+		size:       spec.BatchSize,
+		timeout:    spec.BatchTimeout,
+		retry:      retry,
+		deadLetter: deadLetter,
+	}
+	if s.timeout <= 0 {
+		s.timeout = defaultBatchTimeout
+	}
+	return s
+}
+
+// batchItem is an event in a batch payload. Bodies that are valid JSON are
+// embedded as such, others as strings.
+type batchItem struct {
+	EventType   string            `json:"event_type"`
+	ChannelName string            `json:"channel_name,omitempty"`
+	Filename    string            `json:"filename"`
+	Line        string            `json:"line"`
+	Fields      map[string]string `json:"fields,omitempty"`
+	Suppressed  int               `json:"suppressed,omitempty"`
+	Severity    string            `json:"severity,omitempty"`
+	Body        json.RawMessage   `json:"body"`
+}
+
+// Deliver adds the event to the current batch, posting the batch under ctx if
+// it is full. Batches sent once they waited for BatchTimeout, or when the sink
+// is closed, are not bound to the context of any delivery.
+func (s *batchSink) Deliver(ctx context.Context, e RenderedEvent) error {
+	s.mu.Lock()
+	s.pending = append(s.pending, e)
+	if len(s.pending) < s.size {
+		if s.timer == nil {
+			s.timer = time.AfterFunc(s.timeout, func() { s.flush(context.Background()) })
+		}
+		s.mu.Unlock()
+		return nil
+	}
+	s.mu.Unlock()
+	s.flush(ctx)
+	return nil
+}
+
+// flush sends the current batch, if any.
+func (s *batchSink) flush(ctx context.Context) {
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+
+	s.mu.Lock()
+	batch := s.pending
+	s.pending = nil
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	s.mu.Unlock()
+	if len(batch) == 0 {
+		return
+	}
+
+	// Only the events that failed are retried. Those failing permanently
+	// are given up right away.
+	var rejected []batchFailure
+	var lastErr error
+	attempt := 0
+	attempts, err := s.retry.do(ctx, func(ctx context.Context) error {
+		attempt++
+		failures := s.target.sendBatch(ctx, batch)
+		batch = nil
+		for _, f := range failures {
+			var perm permanentError
+			if errors.As(f.err, &perm) {
+				f.attempts = attempt
+				rejected = append(rejected, f)
+				continue
+			}
+			batch = append(batch, f.event)
+			lastErr = f.err
+		}
+		if len(batch) > 0 {
+			return lastErr
+		}
+		return nil
+	})
+	for _, f := range failAll(batch, err) {
+		f.attempts = attempts
+		rejected = append(rejected, f)
+	}
+	if len(rejected) == 0 {
+		return
+	}
+	if s.deadLetter == nil {
+		slog.Warn("Could not deliver batch, dropping it", "sink", s.String(), "events", len(rejected), "attempts", rejected[0].attempts, "err", rejected[0].err)
+		return
+	}
+	slog.Warn("Could not deliver batch, writing it to the dead letter file", "sink", s.String(), "events", len(rejected), "attempts", rejected[0].attempts, "err", rejected[0].err)
+	for _, f := range rejected {
+		writeDeadLetter(s.deadLetter, s, f.event, f.attempts, f.err)
+	}
+}
+
+// webhookBatch posts batches of events to a webhook, as a JSON array or one
+// JSON object per line.
+type webhookBatch struct {
+	webhook *webhookSink
+	ndjson  bool
+}
+
+func (b webhookBatch) sendBatch(ctx context.Context, batch []RenderedEvent) []batchFailure {
+	payload, err := b.encode(batch)
+	if err != nil {
+		return failAll(batch, permanent(fmt.Errorf("could not encode batch: %w", err)))
+	}
+	return failAll(batch, b.webhook.post(ctx, payload, b.webhook.contentType))
+}
+
+func (b webhookBatch) String() string {
+	return b.webhook.String()
+}
+
+// encode builds the payload of a batch.
+func (b webhookBatch) encode(batch []RenderedEvent) ([]byte, error) {
+	items := make([]batchItem, len(batch))
+	for i, e := range batch {
+		body := e.Body
+		if !json.Valid(body) {
+			var err error
+			if body, err = json.Marshal(string(e.Body)); err != nil {
+				return nil, err
+			}
+		}
+		items[i] = batchItem{
+			EventType:   e.EventType,
+			ChannelName: e.ChannelName,
+			Filename:    e.Filename,
+			Line:        e.Line,
+			Fields:      e.Fields,
+			Suppressed:  e.Suppressed,
+			Severity:    e.Severity.String(),
+			Body:        body,
+		}
+	}
+	if !b.ndjson {
+		return json.Marshal(items)
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, item := range items {
+		if err := enc.Encode(item); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// Close sends the partial batch.
+func (s *batchSink) Close() error {
+	s.flush(context.Background())
+	return nil
+}
+
+func (s *batchSink) String() string {
+	return fmt.Sprintf("%v (batched)", s.target)
+}
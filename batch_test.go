@@ -0,0 +1,216 @@
+package sest
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordedRequest is a request received by a webhookServer.
+type recordedRequest struct {
+	Method string
+	Path   string
+	Header http.Header
+	Body   string
+}
+
+// webhookServer records the requests it receives. It answers them with
+// statuses in order, and with 200 once they are used up.
+type webhookServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	statuses []int
+	requests []recordedRequest
+}
+
+func newWebhookServer(t *testing.T, statuses ...int) *webhookServer {
+	s := &webhookServer{statuses: statuses}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		s.mu.Lock()
+		s.requests = append(s.requests, recordedRequest{Method: r.Method, Path: r.URL.RequestURI(), Header: r.Header, Body: string(body)})
+		status := http.StatusOK
+		if len(s.statuses) > 0 {
+			status, s.statuses = s.statuses[0], s.statuses[1:]
+		}
+		s.mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// received returns the requests received, once there are n of them or after
+// a second.
+func (s *webhookServer) received(n int) []recordedRequest {
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(5 * time.Millisecond) {
+		s.mu.Lock()
+		if len(s.requests) >= n || time.Now().After(deadline) {
+			requests := append([]recordedRequest(nil), s.requests...)
+			s.mu.Unlock()
+			return requests
+		}
+		s.mu.Unlock()
+	}
+}
+
+func TestBatchWebhookSink(t *testing.T) {
+	events := []RenderedEvent{
+		{EventType: "LoginFailed", Filename: "app.log", Line: "login of alice failed", Body: []byte(`{"user":"alice"}`)},
+		{EventType: "LoginFailed", ChannelName: "logins", Filename: "app.log", Line: "login of bob failed", Body: []byte("bob")},
+		{EventType: "Panic", Filename: "app.log", Line: "panic", Fields: map[string]string{"host": "a"}, Body: []byte("panic")},
+	}
+	ndjson := `{"event_type":"LoginFailed","filename":"app.log","line":"login of alice failed","body":{"user":"alice"}}` + "\n" +
+		`{"event_type":"LoginFailed","channel_name":"logins","filename":"app.log","line":"login of bob failed","body":"bob"}` + "\n" +
+		`{"event_type":"Panic","filename":"app.log","line":"panic","fields":{"host":"a"},"body":"panic"}` + "\n"
+	tests := []struct {
+		name        string
+		spec        SinkConfig
+		contentType string
+		// bodies are the bodies of the requests, in order.
+		bodies []string
+	}{
+		{
+			name:        "json",
+			spec:        SinkConfig{BatchSize: 2},
+			contentType: "application/json",
+			bodies: []string{
+				`[{"event_type":"LoginFailed","filename":"app.log","line":"login of alice failed","body":{"user":"alice"}},` +
+					`{"event_type":"LoginFailed","channel_name":"logins","filename":"app.log","line":"login of bob failed","body":"bob"}]`,
+				// The partial batch is sent on closing.
+				`[{"event_type":"Panic","filename":"app.log","line":"panic","fields":{"host":"a"},"body":"panic"}]`,
+			},
+		},
+		{
+			name:        "ndjson",
+			spec:        SinkConfig{BatchSize: 3, BatchFormat: "ndjson"},
+			contentType: "application/x-ndjson",
+			bodies:      []string{ndjson},
+		},
+		{
+			name:        "content type",
+			spec:        SinkConfig{BatchSize: 3, BatchFormat: "ndjson", ContentType: "text/plain"},
+			contentType: "text/plain",
+			bodies:      []string{ndjson},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newWebhookServer(t)
+			spec := tt.spec
+			spec.URL = server.URL + "/events"
+			sink := newBatchWebhookSink(server.Client(), spec, retryPolicy{}, nil)
+			for _, e := range events {
+				if err := sink.Deliver(context.Background(), e); err != nil {
+					t.Fatal(err)
+				}
+			}
+			sink.Close()
+
+			requests := server.received(len(tt.bodies))
+			if len(requests) != len(tt.bodies) {
+				t.Fatalf("got %d requests, want %d", len(requests), len(tt.bodies))
+			}
+			for i, r := range requests {
+				if r.Method != http.MethodPost || r.Path != "/events" || r.Header.Get("Content-Type") != tt.contentType {
+					t.Errorf("got %s %s with content type %s, want a POST to /events with %s", r.Method, r.Path, r.Header.Get("Content-Type"), tt.contentType)
+				}
+				if r.Body != tt.bodies[i] {
+					t.Errorf("request %d has body\n%s\nwant\n%s", i, r.Body, tt.bodies[i])
+				}
+			}
+		})
+	}
+}
+
+// TestBatchSinkTimeout checks that a partial batch is sent once its oldest
+// event waited for the batch timeout.
+func TestBatchSinkTimeout(t *testing.T) {
+	server := newWebhookServer(t)
+	sink := newBatchWebhookSink(server.Client(), SinkConfig{URL: server.URL, BatchSize: 10, BatchTimeout: 20 * time.Millisecond}, retryPolicy{}, nil)
+	defer sink.Close()
+	start := time.Now()
+	sink.Deliver(context.Background(), RenderedEvent{EventType: "E", Body: []byte("a")})
+	sink.Deliver(context.Background(), RenderedEvent{EventType: "E", Body: []byte("b")})
+
+	requests := server.received(1)
+	if len(requests) != 1 {
+		t.Fatalf("got %d requests, want the partial batch", len(requests))
+	}
+	if waited := time.Since(start); waited < 20*time.Millisecond {
+		t.Errorf("sent the batch after %v, want it to wait for the timeout", waited)
+	}
+	var items []batchItem
+	if err := json.Unmarshal([]byte(requests[0].Body), &items); err != nil || len(items) != 2 {
+		t.Errorf("got batch %s, %v, want both events", requests[0].Body, err)
+	}
+}
+
+// TestBatchSinkFailures checks that failed batches are retried and then
+// written to the dead letter file, one line per event.
+func TestBatchSinkFailures(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		requests int
+		// attempts is the number of attempts in the dead letters, none are
+		// written if it is 0.
+		attempts int
+	}{
+		{name: "retried", statuses: []int{http.StatusServiceUnavailable}, requests: 2},
+		{name: "attempts used up", statuses: []int{500, 500, 500}, requests: 3, attempts: 3},
+		{name: "rejected", statuses: []int{http.StatusBadRequest}, requests: 1, attempts: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newWebhookServer(t, tt.statuses...)
+			filename := filepath.Join(t.TempDir(), "dead.jsonl")
+			deadLetters := newFileSink(filename)
+			defer deadLetters.Close()
+			retry := newRetryPolicy(RetryConfig{MaxAttempts: 3, InitialInterval: time.Millisecond})
+			sink := newBatchWebhookSink(server.Client(), SinkConfig{URL: server.URL, BatchSize: 2}, retry, deadLetters)
+			sink.Deliver(context.Background(), RenderedEvent{EventType: "E", Body: []byte("a")})
+			sink.Deliver(context.Background(), RenderedEvent{EventType: "E", Body: []byte("b")})
+			sink.Close()
+
+			requests := server.received(tt.requests)
+			if len(requests) != tt.requests {
+				t.Errorf("got %d requests, want %d", len(requests), tt.requests)
+			}
+			for _, r := range requests[1:] {
+				if r.Body != requests[0].Body {
+					t.Errorf("retried with %s, want the batch %s", r.Body, requests[0].Body)
+				}
+			}
+			content, _ := os.ReadFile(filename)
+			if tt.attempts == 0 {
+				if len(content) > 0 {
+					t.Errorf("wrote dead letters %q for a delivered batch", content)
+				}
+				return
+			}
+			lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+			if len(lines) != 2 {
+				t.Fatalf("wrote dead letters %q, want one per event", content)
+			}
+			for i, line := range lines {
+				var letter deadLetter
+				if err := json.Unmarshal([]byte(line), &letter); err != nil {
+					t.Fatal(err)
+				}
+				if letter.Body != []string{"a", "b"}[i] || letter.Attempts != tt.attempts || !strings.Contains(letter.Sink, "(batched)") {
+					t.Errorf("wrote dead letter %+v, want event %d after %d attempts", letter, i, tt.attempts)
+				}
+			}
+		})
+	}
+}
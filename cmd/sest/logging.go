@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/nlueb/sest"
+)
+
+// logLevel is shared by all handlers installed by setupLogging, so reloading
+// the config changes the level of the running logger.
+var logLevel = new(slog.LevelVar)
+
+// setupLogging installs the default logger for the log settings of cfg.
+// SEST_LOG_LEVEL overrides the configured level.
+func setupLogging(cfg sest.Config) error {
+	level := cfg.LogLevel
+	if env, ok := os.LookupEnv("SEST_LOG_LEVEL"); ok {
+		level = env
+	}
+	if level != "" {
+		var l slog.Level
+		if err := l.UnmarshalText([]byte(level)); err != nil {
+			return fmt.Errorf("invalid log level %s", level)
+		}
+		logLevel.Set(l)
+	}
+
+	opts := &slog.HandlerOptions{Level: logLevel}
+	var handler slog.Handler
+	switch cfg.LogFormat {
+	case "", "text":
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	default:
+		return fmt.Errorf("invalid log format %s", cfg.LogFormat)
+	}
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// fatal logs an error and exits.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
@@ -0,0 +1,235 @@
+// Command sest watches log files and delivers events for the lines matching
+// the configured patterns.
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"syscall"
+
+	"github.com/nlueb/sest"
+)
+
+var configPath string
+
+func init() {
+	configPath = getEnvOrDefault("SEST_CONFIG_PATH", "/etc/sest/config.yml")
+}
+
+func main() {
+	flag.StringVar(&configPath, "config", configPath, "path of the config file, overrides SEST_CONFIG_PATH")
+	dryRun := flag.Bool("dry-run", false, "read the input files from the start and print events instead of delivering them")
+	flag.Usage = usage
+	flag.Parse()
+
+	switch flag.Arg(0) {
+	case "", "run":
+		run(*dryRun)
+	case "validate":
+		os.Exit(validate())
+	case "test":
+		os.Exit(testPattern(flag.Args()[1:]))
+	default:
+		fmt.Fprintf(flag.CommandLine.Output(), "Unknown command %s\n", flag.Arg(0))
+		usage()
+		os.Exit(2)
+	}
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [flags] [command]\n\n", os.Args[0])
+	fmt.Fprintln(out, "Commands:")
+	fmt.Fprintln(out, "  run       watch the input files and deliver events (default)")
+	fmt.Fprintln(out, "  validate  check the config and exit with status 1 if it is invalid")
+	fmt.Fprintln(out, "  test      match a regex against stdin and render a template for each match")
+	fmt.Fprintln(out, "\nFlags:")
+	flag.PrintDefaults()
+}
+
+// loadConfig loads the config file and resolves its relative paths.
+func loadConfig() (sest.Config, error) {
+	cfg, err := sest.LoadConfig(configPath)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.ResolveRelativePaths(filepath.Dir(configPath))
+	return cfg, nil
+}
+
+// validate loads and validates the config without starting to watch, printing
+// a report. It returns the exit status.
+func validate() int {
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Could not load config %s: %v\n", configPath, err)
+		return 1
+	}
+	if err := cfg.Validate(); err != nil {
+		fmt.Printf("Config %s is invalid:\n%v\n", configPath, err)
+		return 1
+	}
+	fmt.Printf("Config %s is valid: %d events, %d input files, %d input directories\n",
+		configPath, len(cfg.Events), len(cfg.Input.Files), len(cfg.Input.Directories))
+	return 0
+}
+
+// testPattern matches a regex against the text read from stdin and renders a
+// template for every match, the way events are rendered. It returns the exit
+// status, which is 1 if nothing matched.
+func testPattern(args []string) int {
+	flags := flag.NewFlagSet("test", flag.ExitOnError)
+	expr := flags.String("regex", "", "the regex to match")
+	tmpl := flags.String("template", "", "the template to render for each match")
+	tmplFile := flags.String("template-file", "", "a file containing the template, instead of -template")
+	flags.Parse(args)
+
+	if *expr == "" {
+		fmt.Fprintln(os.Stderr, "-regex is required")
+		flags.Usage()
+		return 2
+	}
+	re, err := regexp.Compile(*expr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not compile regex: %v\n", err)
+		return 2
+	}
+	template := []byte(*tmpl)
+	if *tmplFile != "" {
+		if template, err = ioutil.ReadFile(*tmplFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Could not load template: %v\n", err)
+			return 2
+		}
+	}
+
+	text, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not read stdin: %v\n", err)
+		return 2
+	}
+
+	e := sest.Event{
+		Regex:      re,
+		GroupNames: re.SubexpNames(),
+		Template:   template,
+		EventType:  "test",
+	}
+	var matches [][]int
+	for _, submatches := range re.FindAllSubmatchIndex(text, -1) {
+		// Empty matches are skipped, as when watching files.
+		if submatches[0] < submatches[1] {
+			matches = append(matches, submatches)
+		}
+	}
+	for i, submatches := range matches {
+		fmt.Printf("Match %d: %q\n", i+1, text[submatches[0]:submatches[1]])
+		for g := 1; 2*g+1 < len(submatches); g++ {
+			name := fmt.Sprintf("$%d", g)
+			if e.GroupNames[g] != "" {
+				name += " (" + e.GroupNames[g] + ")"
+			}
+			if submatches[2*g] < 0 {
+				fmt.Printf("  %s did not participate\n", name)
+				continue
+			}
+			fmt.Printf("  %s = %q\n", name, text[submatches[2*g]:submatches[2*g+1]])
+		}
+
+		rendered, err := e.Render("stdin", text, submatches)
+		if err != nil {
+			fmt.Printf("  could not render template: %v\n", err)
+			continue
+		}
+		fmt.Printf("Rendered:\n%s\n", bytes.TrimRight(rendered.Body, "\n"))
+	}
+
+	if len(matches) == 0 {
+		fmt.Println("No match")
+		return 1
+	}
+	return 0
+}
+
+func run(dryRun bool) {
+	if err := setupLogging(sest.Config{}); err != nil {
+		fatal("Could not set up logging", "err", err)
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		fatal("Could not load config", "config", configPath, "err", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		fatal("Invalid config", "config", configPath, "err", err)
+	}
+	if err := setupLogging(cfg); err != nil {
+		fatal("Could not set up logging", "err", err)
+	}
+
+	var opts []sest.Option
+	if dryRun {
+		opts = append(opts, sest.WithDryRun())
+	}
+	r, err := sest.New(cfg, opts...)
+	if err != nil {
+		fatal("Could not start", "err", err)
+	}
+
+	for _, filename := range r.Files() {
+		slog.Info("Watching file", "file", filename)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			reload(r)
+		}
+	}()
+
+	if err := r.Run(ctx); err != nil {
+		fatal("Could not watch files", "err", err)
+	}
+	slog.Info("Shut down")
+}
+
+// reload applies the current config file to the runner, keeping the running
+// config if the file is invalid.
+func reload(r *sest.Runner) {
+	slog.Info("Reloading config", "config", configPath)
+
+	cfg, err := loadConfig()
+	if err != nil {
+		slog.Error("Could not reload config, keeping the previous one", "err", err)
+		return
+	}
+	if err := cfg.Validate(); err != nil {
+		slog.Error("Invalid config, keeping the previous one", "err", err)
+		return
+	}
+	if err := r.Reload(cfg); err != nil {
+		slog.Error("Could not reload config, keeping the previous one", "err", err)
+		return
+	}
+	if err := setupLogging(cfg); err != nil {
+		slog.Error("Could not set up logging", "err", err)
+	}
+}
+
+func getEnvOrDefault(key, defaultVal string) (value string) {
+	var ok bool
+	if value, ok = os.LookupEnv(key); !ok {
+		value = defaultVal
+	}
+	return
+}
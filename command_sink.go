@@ -0,0 +1,97 @@
+package sest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Defaults of the command sink.
+const (
+	defaultCommandTimeout     = 10 * time.Second
+	defaultCommandConcurrency = 4
+)
+
+// commandSink runs a command per event, passing the rendered body on stdin
+// and the match in environment variables.
+type commandSink struct {
+	command string
+	args    []string
+	timeout time.Duration
+	// slots limits the commands running at the same time.
+	slots chan struct{}
+}
+
+func newCommandSink(command string, args []string, timeout time.Duration, maxConcurrent int) *commandSink {
+	if timeout <= 0 {
+		timeout = defaultCommandTimeout
+	}
+	if maxConcurrent <= 0 {
+		maxConcurrent = defaultCommandConcurrency
+	}
+	return &commandSink{
+		command: command,
+		args:    args,
+		timeout: timeout,
+		slots:   make(chan struct{}, maxConcurrent),
+	}
+}
+
+// Deliver runs the command, killing it once the timeout has passed. The
+// environment of the command holds SEST_EVENT_TYPE, SEST_CHANNEL_NAME,
+// SEST_FILENAME, SEST_LINE, the capture groups as SEST_GROUP0, SEST_GROUP1,
+// ... and the fields as SEST_FIELD_<name>.
+func (s *commandSink) Deliver(ctx context.Context, e RenderedEvent) error {
+	select {
+	case s.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-s.slots }()
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, s.command, s.args...)
+	cmd.Stdin = bytes.NewReader(e.Body)
+	cmd.Env = append(os.Environ(), commandEnv(e)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	// Children inheriting stderr must not keep Deliver waiting.
+	cmd.WaitDelay = time.Second
+
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("command timed out after %v", s.timeout)
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return fmt.Errorf("command exited with status %d: %s", exitErr.ExitCode(), snippet(bytes.TrimSpace(stderr.Bytes())))
+	}
+	return err
+}
+
+func commandEnv(e RenderedEvent) []string {
+	env := []string{
+		"SEST_EVENT_TYPE=" + e.EventType,
+		"SEST_CHANNEL_NAME=" + e.ChannelName,
+		"SEST_FILENAME=" + e.Filename,
+		"SEST_LINE=" + e.Line,
+	}
+	for i, group := range e.Groups {
+		env = append(env, "SEST_GROUP"+strconv.Itoa(i)+"="+group)
+	}
+	for name, value := range e.Fields {
+		env = append(env, "SEST_FIELD_"+name+"="+value)
+	}
+	return env
+}
+
+func (s *commandSink) String() string {
+	return "command " + strings.Join(append([]string{s.command}, s.args...), " ")
+}
@@ -0,0 +1,1319 @@
+package sest
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the configuration of a Runner, usually loaded from a YAML or JSON
+// file with LoadConfig.
+type Config struct {
+	// Input lists the files to read and the directories whose files are read.
+	// Files that do not exist yet are read once they appear.
+	Input struct {
+		Files       []string
+		Directories []string
+		// Stdin reads lines from stdin in addition to the files, until it
+		// is exhausted. Listing - as a file does the same. Without files
+		// and directories the Runner stops at the end of stdin.
+		Stdin bool
+		// Filter is a regex that the path of a file has to match for the
+		// file to be read.
+		Filter string
+		// Exclude is a regex that skips the files whose path matches it,
+		// even if they match Filter.
+		Exclude string
+		// Recursive also watches the subdirectories of the directories,
+		// descending at most MaxDepth levels unless MaxDepth is zero.
+		Recursive bool
+		MaxDepth  int `yaml:"max_depth"`
+		// StartAt is where files without a persisted offset are read from
+		// on startup: beginning, the default, or end to only read lines
+		// appended later on. Files created later on are read from the
+		// beginning.
+		StartAt string `yaml:"start_at"`
+		// CatchUp reads the content already present in the input files on
+		// startup, from the persisted offset or the start of the file,
+		// instead of waiting for the next write.
+		CatchUp bool `yaml:"catch_up"`
+		// MaxRead is the number of bytes read from a file at once, at most
+		// DefaultMaxRead by default, which bounds the memory used to catch
+		// up on large files.
+		MaxRead int64 `yaml:"max_read"`
+		// MaxLineLength bounds the length of a line, so that a line without
+		// newline is not buffered without limit. LongLines decides what
+		// happens to longer lines: truncate, the default, cuts them off
+		// behind a marker, split breaks them into several lines. 0, the
+		// default, means no limit.
+		MaxLineLength int    `yaml:"max_line_length"`
+		LongLines     string `yaml:"long_lines"`
+		// Encoding is the encoding of the input: utf-8, the default,
+		// utf-16le, utf-16be, latin1 or windows-1252. Lines are transcoded
+		// to UTF-8 before matching. A leading byte order mark is skipped,
+		// and switches UTF-8 input to UTF-16 if it is a UTF-16 one.
+		Encoding string
+		// Readers is the number of files read and matched at the same
+		// time, GOMAXPROCS by default. The lines of a file are still
+		// matched in order. Changes take effect on restart.
+		Readers int
+		// LazyOpen keeps files closed while they are not written to,
+		// bounding the descriptors used for many input files. Files are
+		// opened on the next write and closed again once they have been
+		// idle for IdleTimeout, one minute by default. MaxOpenFiles, if
+		// set, closes the least recently read files beyond it.
+		LazyOpen     bool          `yaml:"lazy_open"`
+		IdleTimeout  time.Duration `yaml:"idle_timeout"`
+		MaxOpenFiles int           `yaml:"max_open_files"`
+		// StaleAfter reports a file as stale once nothing has been written
+		// to it for this long, since it was opened or last written to. The
+		// gauge sest_file_stale is 1 for it then, and StaleEvent, if set, is
+		// delivered. StaleFiles overrides StaleAfter for the files matching
+		// a glob pattern, the longest one matching winning. 0 disables the
+		// check, which is the default.
+		StaleAfter time.Duration            `yaml:"stale_after"`
+		StaleFiles map[string]time.Duration `yaml:"stale_files"`
+		// StaleEvent names the event delivered when a file goes stale. It
+		// has no src and is not matched against lines. Its Line and group0
+		// describe the staleness, and StaleAfter is the threshold.
+		StaleEvent string `yaml:"stale_event"`
+		// Format is text, the default, json or logfmt. The latter decode
+		// every line, or multiline block, into fields events can filter on
+		// and templates can refer to. Events can override it.
+		Format string
+		// Fallback is skip, the default, to ignore lines that cannot be
+		// decoded, or text to match them like text lines.
+		Fallback string
+		// Multiline groups lines into blocks that events are matched
+		// against as a whole.
+		Multiline MultilineConfig
+	}
+	// Slack configures the Slack sink, using either a bot token or an
+	// incoming webhook.
+	Slack struct {
+		Token          string
+		WebhookURL     string `yaml:"webhook_url"`
+		DefaultChannel string `yaml:"default_channel"`
+	}
+	// Discord configures the Discord sink, which posts events to the
+	// channel of WebhookURL as Username and with the avatar at AvatarURL, if
+	// set, instead of those of the webhook. Bodies longer than 2000
+	// characters are split into several messages.
+	Discord struct {
+		WebhookURL string `yaml:"webhook_url"`
+		Username   string
+		AvatarURL  string `yaml:"avatar_url"`
+	}
+	// Events are the events to look for, keyed by name.
+	Events map[string]EventConfig
+	// Include lists glob patterns of config fragments, e.g. conf.d/*.yml,
+	// relative to the config file. Fragments add input files, directories
+	// and events, which must not be defined twice, and are reread on
+	// reload. Their relative paths are relative to the fragment.
+	Include []string
+	// Syslog configures the syslog sink. An empty network and address use
+	// the local syslog daemon. The tls network sends over TCP with TLS, as
+	// described in RFC 5425.
+	Syslog struct {
+		Network  string
+		Address  string
+		Facility string
+		Tag      string
+	}
+	// Redis configures the Redis sink, which publishes events to the channel
+	// named by their channel_name, or DefaultChannel. TLS connects with
+	// TLS.
+	Redis struct {
+		Addr           string
+		Password       string
+		DB             int
+		DefaultChannel string `yaml:"default_channel"`
+		TLS            bool
+	}
+	// Nats configures the NATS sink, which publishes events to the subject
+	// named by their channel_name, or else their event type, prefixed with
+	// SubjectPrefix. URL is host:port or nats://[user:password@]host[:port],
+	// authenticating with User and Password or Token. TLS connects with
+	// TLS.
+	Nats struct {
+		URL           string
+		User          string
+		Password      string
+		Token         string
+		SubjectPrefix string `yaml:"subject_prefix"`
+		TLS           bool
+	}
+	// MQTT configures the MQTT sink, which publishes events to Topic, a
+	// template like the url of a webhook sink, or else the channel_name of
+	// the events, at QoS 0, the default, 1 or 2. Broker is host:port,
+	// tcp://host[:port] or ssl://host[:port] for TLS, authenticating with
+	// Username and Password as ClientID, sest-<hostname> by default.
+	// Retain publishes retained messages. CleanSession starts a new session
+	// on every connect; otherwise the broker keeps the session of the
+	// client, and QoS 1 and 2 messages in flight when the connection broke
+	// are completed on the next one. KeepAlive is one minute by default.
+	// TLS connects with TLS.
+	MQTT struct {
+		Broker       string
+		ClientID     string `yaml:"client_id"`
+		Username     string
+		Password     string
+		Topic        string
+		QoS          int `yaml:"qos"`
+		Retain       bool
+		CleanSession bool          `yaml:"clean_session"`
+		KeepAlive    time.Duration `yaml:"keep_alive"`
+		TLS          bool
+	}
+	// Kafka configures the Kafka sink, which produces events to Topic, keyed
+	// by the capture group named or numbered by Key, if any. Acks is all,
+	// the default, leader or none. Messages are sent in batches of up to
+	// BatchSize messages, waiting at most BatchTimeout, 10ms by default, for
+	// a batch to fill up. TLS connects to the brokers with TLS.
+	Kafka struct {
+		Brokers      []string
+		Topic        string
+		Key          string
+		Acks         string
+		BatchSize    int           `yaml:"batch_size"`
+		BatchTimeout time.Duration `yaml:"batch_timeout"`
+		TLS          bool
+	}
+	// TCP configures the TCP sink, which writes events as lines to a
+	// persistent connection to Addr, host:port, e.g. the tcp input of
+	// Logstash. Line breaks in the bodies are replaced with spaces. Writes
+	// time out after WriteTimeout, five seconds by default. TLS connects
+	// with TLS.
+	TCP struct {
+		Addr         string
+		WriteTimeout time.Duration `yaml:"write_timeout"`
+		TLS          bool
+	}
+	// HTTP configures the client shared by the webhook, slack, discord,
+	// elasticsearch, pagerduty and sns sinks. Requests time out after
+	// Timeout, ten seconds by default, even if the delivery timeout is
+	// longer. Up to MaxIdleConns idle connections, 100 by default, and
+	// MaxIdleConnsPerHost per host, 10 by default, are kept alive for
+	// IdleConnTimeout, 90 seconds by default.
+	HTTP struct {
+		Timeout             time.Duration
+		MaxIdleConns        int           `yaml:"max_idle_conns"`
+		MaxIdleConnsPerHost int           `yaml:"max_idle_conns_per_host"`
+		IdleConnTimeout     time.Duration `yaml:"idle_conn_timeout"`
+	}
+	// TLS configures the TLS connections of the HTTP sinks, of the syslog
+	// sink with the tls network and of the redis, nats, mqtt, kafka and tcp
+	// sinks with tls enabled. CAFile adds the PEM certificates in it to the
+	// trusted ones, e.g. of an internal CA. CertFile and KeyFile are the PEM
+	// client certificate and key for mutual TLS. InsecureSkipVerify accepts
+	// any server certificate, for development only.
+	TLS struct {
+		CAFile             string `yaml:"ca_file"`
+		CertFile           string `yaml:"cert_file"`
+		KeyFile            string `yaml:"key_file"`
+		InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+	}
+	// OutputFile is the file sink of events without their own output file.
+	OutputFile string `yaml:"output_file"`
+	// StateFile persists the offsets of the input files across restarts.
+	StateFile string `yaml:"state_file"`
+	// PollInterval is how often the input files are checked for changes,
+	// defaulting to DefaultPollInterval. Shorter intervals deliver events
+	// sooner, but cost more CPU the more files are watched. Changes take
+	// effect on restart, not on reload.
+	PollInterval time.Duration `yaml:"poll_interval"`
+	// MetricsAddr is the address Prometheus metrics are served on at
+	// /metrics, e.g. ":9090". Metrics are not served if it is empty. Changes
+	// take effect on restart, not on reload.
+	MetricsAddr string `yaml:"metrics_addr"`
+	// HealthAddr is the address the health check is served on at /healthz,
+	// together with a JSON description of the input files at /status: their
+	// offset, size and lag, when they were last read and the lines and
+	// matches read from them.
+	// Changes take effect on restart, not on reload.
+	HealthAddr string `yaml:"health_addr"`
+	// MaxWatcherErrors stops the Runner once the watcher reported that many
+	// errors within a minute. Zero keeps it running regardless of errors.
+	MaxWatcherErrors int `yaml:"max_watcher_errors"`
+	// LogLevel is one of debug, info, warn or error, info by default, and
+	// LogFormat one of text or json, text by default. They configure the log
+	// of the sest command.
+	LogLevel  string `yaml:"log_level"`
+	LogFormat string `yaml:"log_format"`
+	// OutputFormat is how the events without a template of their own are
+	// rendered: template, plain for the line containing the match, or json
+	// for the fields of the match as a JSON object. Events can override it.
+	OutputFormat string `yaml:"output_format"`
+	// Timezone is the IANA name of the time zone the timestamp template
+	// function formats in, e.g. UTC or Europe/Berlin. The local time zone is
+	// used if it is empty.
+	Timezone string `yaml:"timezone"`
+	// Retry configures how failed deliveries to sinks are retried.
+	Retry RetryConfig
+	// DeadLetterFile receives the events that could not be delivered to a
+	// sink, as JSON lines describing the event and the failure.
+	DeadLetterFile string `yaml:"dead_letter_file"`
+	// Dispatch configures the queue between reading the input files and
+	// delivering events. Changes take effect on restart, not on reload.
+	Dispatch DispatchConfig
+}
+
+// DefaultPollInterval is the poll interval used if the config sets none.
+const DefaultPollInterval = 100 * time.Millisecond
+
+// Bounds of the poll interval accepted by Validate.
+const (
+	minPollInterval = 10 * time.Millisecond
+	maxPollInterval = time.Minute
+)
+
+// Patterns are the regexes of an event, given as a single regex or a list.
+type Patterns []string
+
+func (p *Patterns) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*p = nil
+		if value.Value != "" {
+			*p = Patterns{value.Value}
+		}
+		return nil
+	}
+	var patterns []string
+	if err := value.Decode(&patterns); err != nil {
+		return err
+	}
+	*p = patterns
+	return nil
+}
+
+// EventConfig is the configuration of a single event.
+type EventConfig struct {
+	// Src is the regex matched against new lines, or a list of alternative
+	// regexes. Each line fires the event at most once per chunk, with the
+	// groups of the first regex that matches it. With JSON input it may be
+	// empty if Fields is not.
+	Src Patterns
+	// CaseInsensitive and Multiline set the i and m flags of src: letters
+	// match regardless of case, and ^ and $ match at the start and end of
+	// every line rather than of the chunk of lines read. Inline flags in
+	// src take precedence, e.g. (?-i) restores case sensitivity. They do
+	// not apply to contains and prefilter.
+	CaseInsensitive bool `yaml:"case_insensitive"`
+	Multiline       bool
+	// Contains and Prefilter gate src cheaply: only lines containing the
+	// substring and matching the regex are matched against src, which is
+	// then matched line by line. In multiline mode they gate whole blocks.
+	Contains  string
+	Prefilter string
+	// Dest is the path of the template rendered for every match, which is
+	// reread when it changes. Short templates can be given inline as
+	// Template instead.
+	Dest        string
+	Template    string
+	EventType   string `yaml:"event_type"`
+	ChannelName string `yaml:"channel_name"`
+	// URL, ContentType and OutputFile configure a webhook and a file sink.
+	// They are ignored if Sinks is not empty.
+	URL         string
+	ContentType string `yaml:"content_type"`
+	OutputFile  string `yaml:"output_file"`
+	Sinks       []SinkConfig
+	// DeadLetterFile overrides the global dead letter file for this event.
+	DeadLetterFile string `yaml:"dead_letter_file"`
+	// Strict makes references to missing template data an error. It also
+	// turns the warnings about references to data a match never sets, like
+	// groups src does not capture, into validation errors.
+	Strict bool
+	// RateLimit limits how often the event is delivered.
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+	// SampleRate, between 0 and 1, delivers only that fraction of the
+	// matches, e.g. 0.1 for 1 in 10, dropping the others at random. With a
+	// SampleKey, the name or number of a capture group or a decoded field,
+	// matches are kept by the hash of its value instead, so all matches
+	// with the same value are either delivered or dropped. Zero delivers
+	// all matches.
+	SampleRate float64 `yaml:"sample_rate"`
+	SampleKey  string  `yaml:"sample_key"`
+	// Schedule restricts the event to time windows, e.g. business hours.
+	// Matches outside of them are dropped.
+	Schedule ScheduleConfig
+	// Aggregate delivers a summary of the matches per window instead of
+	// every match.
+	Aggregate AggregateConfig
+	// Alert tracks the matches of the event as alerts that fire and
+	// resolve, instead of delivering every match.
+	Alert AlertConfig
+	// DedupWindow suppresses repeats of the event for this long after it was
+	// delivered. The number of suppressed repeats is passed to the template
+	// of the next delivery as Suppressed.
+	DedupWindow time.Duration `yaml:"dedup_window"`
+	// DedupKey is the name or number of the capture group identifying
+	// repeats. If it is empty, events with the same rendered output repeat
+	// each other.
+	DedupKey string `yaml:"dedup_key"`
+	// Format overrides the input format for this event.
+	Format string
+	// OutputFormat overrides the output format of the config. Events with
+	// a dest or template use template unless they set another one, which
+	// then requires them to have neither.
+	OutputFormat string `yaml:"output_format"`
+	// Fields maps the fields of decoded lines to regexes their values have
+	// to match, e.g. level: '^error$'. Non-string JSON values are matched in
+	// their JSON form.
+	Fields map[string]string
+	// Severity extracts the severity of the matches, which sinks with a
+	// min_severity filter on.
+	Severity SeverityConfig
+	// Tags are static fields, e.g. env: production, passed to the template
+	// and the sinks like named capture groups.
+	Tags map[string]string
+}
+
+// AggregateConfig counts the matches of an event over consecutive windows
+// of Window, per value of the capture group or decoded field GroupBy if set,
+// and delivers one summary per window and value, rendered from the last of
+// the matches. The template of the summary also gets the Count of the
+// matches, the Key they were counted by and the WindowStart and WindowEnd,
+// which the fields of the summary hold as well. Summaries of the windows
+// in progress are delivered on shutdown and reload.
+type AggregateConfig struct {
+	Window  time.Duration
+	GroupBy string `yaml:"group_by"`
+}
+
+// AlertConfig turns the matches of an event into alerts, identified by the
+// value of the capture group or decoded field Key, or else by the matched
+// text, group0. The first match of an alert fires it and is delivered with
+// the State firing added to the template data and fields, rendered with
+// FiringDest or FiringTemplate, like Dest and Template, and delivered to the
+// FiringSinks, where set, or else like the event. Its repeats are suppressed
+// until there were none for ResolveAfter, which resolves the alert, so that
+// its next match fires it again. If ResolveDest or ResolveTemplate, or
+// ResolveSinks are set, a resolved event is rendered from the last match,
+// with the State resolved, the times the alert FiredAt, was LastSeen and
+// ResolvedAt, the Duration it fired for and the number of suppressed
+// Repeats, and delivered to the ResolveSinks, or else like the event. Alerts
+// are tracked in memory, so firing ones fire again after a restart. A reload
+// keeps them, unless it changes the Key.
+type AlertConfig struct {
+	Key             string
+	ResolveAfter    time.Duration `yaml:"resolve_after"`
+	FiringDest      string        `yaml:"firing_dest"`
+	FiringTemplate  string        `yaml:"firing_template"`
+	FiringSinks     []SinkConfig  `yaml:"firing_sinks"`
+	ResolveDest     string        `yaml:"resolve_dest"`
+	ResolveTemplate string        `yaml:"resolve_template"`
+	ResolveSinks    []SinkConfig  `yaml:"resolve_sinks"`
+}
+
+// alertNoticeConfig is the template and sinks of the events of firing or
+// resolved alerts, whose keys start with name.
+type alertNoticeConfig struct {
+	name     string
+	dest     string
+	template string
+	sinks    []SinkConfig
+}
+
+func (a AlertConfig) firing() alertNoticeConfig {
+	return alertNoticeConfig{name: "firing", dest: a.FiringDest, template: a.FiringTemplate, sinks: a.FiringSinks}
+}
+
+func (a AlertConfig) resolve() alertNoticeConfig {
+	return alertNoticeConfig{name: "resolve", dest: a.ResolveDest, template: a.ResolveTemplate, sinks: a.ResolveSinks}
+}
+
+// configured reports whether the notice has a template or sinks of its own.
+func (n alertNoticeConfig) configured() bool {
+	return n.hasTemplate() || len(n.sinks) > 0
+}
+
+// hasTemplate reports whether the notice has a template of its own.
+func (n alertNoticeConfig) hasTemplate() bool {
+	return n.dest != "" || n.template != ""
+}
+
+// loadTemplate returns the inline template of the notice, or reads it from
+// its dest.
+func (n alertNoticeConfig) loadTemplate() ([]byte, error) {
+	if n.template != "" {
+		return []byte(n.template), nil
+	}
+	return ioutil.ReadFile(n.dest)
+}
+
+// ScheduleConfig makes an event active only during its Windows, in Timezone,
+// an IANA name, or else the time zone of the config. Without windows the
+// event is always active.
+type ScheduleConfig struct {
+	Timezone string
+	Windows  []ScheduleWindow
+}
+
+// ScheduleWindow is active from From to To, times like 09:00, on Days, e.g.
+// mon, tuesday or mon-fri, every day if empty. From defaults to the start
+// and To to the end, 24:00, of the day. A window with To before From runs
+// past midnight, its days being the days it starts on.
+type ScheduleWindow struct {
+	Days []string
+	From string
+	To   string
+}
+
+// RateLimitConfig limits an event to Events deliveries per Interval, one
+// second by default, with bursts of up to Burst deliveries, by default Events.
+// Matches beyond the limit are dropped. Zero Events disables the limit.
+type RateLimitConfig struct {
+	Events   int
+	Interval time.Duration
+	Burst    int
+}
+
+// RetryConfig retries failed deliveries up to MaxAttempts times in total,
+// waiting InitialInterval, 500ms by default, before the first retry and
+// doubling the wait up to MaxInterval, 30s by default. A MaxElapsed other than
+// zero gives up once that much time has passed since the first attempt.
+// Deliveries rejected by the receiver are not retried. MaxAttempts below two
+// disables retries. Retries hold up the dispatch worker delivering the event.
+type RetryConfig struct {
+	MaxAttempts     int           `yaml:"max_attempts"`
+	InitialInterval time.Duration `yaml:"initial_interval"`
+	MaxInterval     time.Duration `yaml:"max_interval"`
+	MaxElapsed      time.Duration `yaml:"max_elapsed"`
+}
+
+// DispatchConfig queues up to Buffer rendered events, 1000 by default, which
+// Workers goroutines, one by default, deliver. With several workers events
+// may be delivered out of order. OnFull is what happens to events once the
+// queue is full: block, the default, waits for a free slot, holding up reading
+// the input files, and drop drops them. Timeout bounds each attempt to
+// deliver an event to a sink, unless the sink has a timeout of its own.
+// ShutdownTimeout bounds delivering the queued events on shutdown; the
+// deliveries still running then are cancelled and the remaining events are
+// given up. Zero means no limit for both.
+type DispatchConfig struct {
+	Buffer          int
+	Workers         int
+	OnFull          string `yaml:"on_full"`
+	Timeout         time.Duration
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+}
+
+// MultilineConfig configures how lines are grouped into blocks, such as stack
+// traces. A line matching Start begins a new block, the following lines
+// matching Continuation, by default indented lines, are appended to it. The
+// last block of a file is matched once no line has been appended to it for
+// FlushTimeout, one second by default. An empty Start disables multiline mode.
+type MultilineConfig struct {
+	Start        string
+	Continuation string
+	FlushTimeout time.Duration `yaml:"flush_timeout"`
+}
+
+// SeverityConfig configures the severity of an event. Group names or numbers
+// the capture group, or names the decoded field, holding the level, and Level
+// is the static level used without a group, or if the group holds no known
+// level. Levels are debug, info, warn, error and fatal, in that order,
+// including common spellings like WARNING or CRIT.
+type SeverityConfig struct {
+	Group string
+	Level string
+}
+
+// SinkConfig configures one of the sinks of an event. Type is one of log,
+// webhook, slack, discord, file, syslog, redis, nats, mqtt, kafka, tcp,
+// elasticsearch, pagerduty, sns or command.
+type SinkConfig struct {
+	Type string
+	// MinSeverity, e.g. error, only passes the events of at least that
+	// severity on to the sink. Events of unknown severity are left out.
+	MinSeverity string `yaml:"min_severity"`
+	// URL and Method, POST by default, are where a webhook sink sends
+	// events. Either may be a template, rendered per event with the
+	// capture groups as group0, group1, ..., the fields by name and the
+	// EventType, ChannelName, Filename, Line and Severity, e.g.
+	// https://example.com/{{.tenant}}/events. Templated sinks are not
+	// batched.
+	URL         string
+	Method      string
+	ContentType string `yaml:"content_type"`
+	// Headers are sent with every request of a webhook sink, along with an
+	// Authorization header for BearerToken, if set. Environment variables
+	// like ${TOKEN} in their values are expanded. The Content-Type header
+	// is the ContentType.
+	Headers     map[string]string
+	BearerToken string `yaml:"bearer_token"`
+	Path        string
+	// Timeout bounds each attempt to deliver an event to the sink,
+	// overriding the timeout of the dispatch config. An attempt that timed
+	// out failed and is retried. A command sink kills the command then.
+	Timeout time.Duration
+	// BatchSize makes a webhook sink post up to that many events at once,
+	// after waiting at most BatchTimeout, one second by default, for more
+	// events. BatchFormat is json, the default, for a JSON array or ndjson
+	// for one JSON object per line. Each object holds the event_type,
+	// channel_name, filename, line, fields, suppressed, severity and the
+	// body, embedded as JSON if it is valid JSON.
+	BatchSize    int           `yaml:"batch_size"`
+	BatchTimeout time.Duration `yaml:"batch_timeout"`
+	BatchFormat  string        `yaml:"batch_format"`
+	// Topic and Key override the topic and key of the Kafka config for a
+	// kafka sink. Topic overrides the topic of the MQTT config for an mqtt
+	// sink. For a pagerduty sink, Key names or numbers the capture
+	// group holding the dedup key of the alerts.
+	Topic string
+	Key   string
+	// URL, Index, Username and Password configure an elasticsearch sink,
+	// which indexes the fields of events in batches of BatchSize, 100 by
+	// default, with the _bulk API. Time layouts in braces in the index
+	// are replaced with the date, e.g. events-{2006.01.02}. Events that
+	// failed to be indexed are retried, unless they were rejected.
+	Index    string
+	Username string
+	Password string
+	// RoutingKey is the integration key of a pagerduty sink, which
+	// triggers an alert per event, or resolves the alert with the same
+	// dedup key if the line matches the Resolve regex. URL overrides the
+	// Events API v2 endpoint.
+	RoutingKey string `yaml:"routing_key"`
+	Resolve    string
+	// TopicARN is the topic an sns sink publishes events to, with their
+	// event type as the subject and their capture groups as message
+	// attributes. The credentials come from the default credential chain
+	// of the AWS SDK, e.g. the environment, the shared config and
+	// credentials files with their SSO and assume role profiles, web
+	// identity tokens, the ECS container or the EC2 instance. URL overrides
+	// the regional endpoint of the topic.
+	TopicARN string `yaml:"topic_arn"`
+	// Command and Args configure a command sink, which runs the command for
+	// every event with the rendered body on stdin. It is killed after
+	// Timeout, ten seconds by default for command sinks, and at most
+	// MaxConcurrent commands of the sink run at once, four by default.
+	Command       string
+	Args          []string
+	MaxConcurrent int `yaml:"max_concurrent"`
+}
+
+// ResolveRelativePaths makes the relative paths of the config relative to
+// configDir, usually the directory containing the config file. The resolved
+// paths are absolute, like the paths reported by the watcher, even if
+// configDir is not.
+func (cfg *Config) ResolveRelativePaths(configDir string) {
+	if abs, err := filepath.Abs(configDir); err == nil {
+		configDir = abs
+	}
+
+	for i, filename := range cfg.Input.Files {
+		if filepath.IsAbs(filename) {
+			cfg.Input.Files[i] = filepath.Clean(filename)
+			continue
+		}
+		cfg.Input.Files[i] = filepath.Join(configDir, filename)
+	}
+
+	for i, dirName := range cfg.Input.Directories {
+		if filepath.IsAbs(dirName) {
+			cfg.Input.Directories[i] = filepath.Clean(dirName)
+			continue
+		}
+		cfg.Input.Directories[i] = filepath.Join(configDir, dirName)
+	}
+
+	if len(cfg.Input.StaleFiles) > 0 {
+		staleFiles := make(map[string]time.Duration, len(cfg.Input.StaleFiles))
+		for pattern, after := range cfg.Input.StaleFiles {
+			if !filepath.IsAbs(pattern) {
+				pattern = filepath.Join(configDir, pattern)
+			}
+			staleFiles[filepath.Clean(pattern)] = after
+		}
+		cfg.Input.StaleFiles = staleFiles
+	}
+
+	for key, event := range cfg.Events {
+		if event.Dest != "" && !filepath.IsAbs(event.Dest) {
+			event.Dest = filepath.Join(configDir, event.Dest)
+		}
+		if event.Alert.FiringDest != "" && !filepath.IsAbs(event.Alert.FiringDest) {
+			event.Alert.FiringDest = filepath.Join(configDir, event.Alert.FiringDest)
+		}
+		if event.Alert.ResolveDest != "" && !filepath.IsAbs(event.Alert.ResolveDest) {
+			event.Alert.ResolveDest = filepath.Join(configDir, event.Alert.ResolveDest)
+		}
+		if event.OutputFile != "" && !filepath.IsAbs(event.OutputFile) {
+			event.OutputFile = filepath.Join(configDir, event.OutputFile)
+		}
+		if event.DeadLetterFile != "" && !filepath.IsAbs(event.DeadLetterFile) {
+			event.DeadLetterFile = filepath.Join(configDir, event.DeadLetterFile)
+		}
+		for _, sinks := range [][]SinkConfig{event.Sinks, event.Alert.FiringSinks, event.Alert.ResolveSinks} {
+			for i, sink := range sinks {
+				if sink.Path != "" && !filepath.IsAbs(sink.Path) {
+					sinks[i].Path = filepath.Join(configDir, sink.Path)
+				}
+			}
+		}
+		cfg.Events[key] = event
+	}
+
+	if cfg.OutputFile != "" && !filepath.IsAbs(cfg.OutputFile) {
+		cfg.OutputFile = filepath.Join(configDir, cfg.OutputFile)
+	}
+
+	if cfg.DeadLetterFile != "" && !filepath.IsAbs(cfg.DeadLetterFile) {
+		cfg.DeadLetterFile = filepath.Join(configDir, cfg.DeadLetterFile)
+	}
+
+	if cfg.StateFile != "" && !filepath.IsAbs(cfg.StateFile) {
+		cfg.StateFile = filepath.Join(configDir, cfg.StateFile)
+	}
+
+	for _, file := range []*string{&cfg.TLS.CAFile, &cfg.TLS.CertFile, &cfg.TLS.KeyFile} {
+		if *file != "" && !filepath.IsAbs(*file) {
+			*file = filepath.Join(configDir, *file)
+		}
+	}
+}
+
+// LoadConfig reads a YAML config file, or a JSON one if its name ends in
+// .json. JSON configs use the same keys as YAML ones. Unknown and repeated
+// keys are errors. A - among the input files enables reading stdin instead.
+func LoadConfig(filename string) (Config, error) {
+	c := Config{}
+	if err := decodeConfigFile(filename, &c); err != nil {
+		return c, err
+	}
+	c.extractStdin()
+
+	if err := c.include(filename); err != nil {
+		return c, err
+	}
+	return c, nil
+}
+
+// extractStdin removes - from the input files, enabling stdin instead.
+func (c *Config) extractStdin() {
+	files := c.Input.Files[:0]
+	for _, filename := range c.Input.Files {
+		if filename == stdinName {
+			c.Input.Stdin = true
+			continue
+		}
+		files = append(files, filename)
+	}
+	c.Input.Files = files
+}
+
+// configErrors lists all problems found while validating a config.
+type configErrors []error
+
+func (errs configErrors) Error() string {
+	lines := make([]string, len(errs))
+	for i, err := range errs {
+		lines[i] = "  - " + err.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Validate checks the whole config and reports every problem found instead of
+// stopping at the first one. It expects relative paths to be resolved.
+func (cfg *Config) Validate() error {
+	var errs configErrors
+
+	if _, err := regexp.Compile(cfg.Input.Filter); err != nil {
+		errs = append(errs, fmt.Errorf("input filter %s does not compile: %v", cfg.Input.Filter, err))
+	}
+	if _, err := regexp.Compile(cfg.Input.Exclude); err != nil {
+		errs = append(errs, fmt.Errorf("input exclude %s does not compile: %v", cfg.Input.Exclude, err))
+	}
+	for _, filename := range cfg.Input.Files {
+		if _, err := os.Stat(filename); os.IsNotExist(err) {
+			// It is read once it appears, e.g. after the application
+			// creating it started.
+			slog.Warn("Input file does not exist yet", "file", filename)
+		} else if err != nil {
+			errs = append(errs, fmt.Errorf("input file: %v", err))
+		}
+	}
+	for _, dirName := range cfg.Input.Directories {
+		if stat, err := os.Stat(dirName); err != nil {
+			errs = append(errs, fmt.Errorf("input directory: %v", err))
+		} else if !stat.IsDir() {
+			errs = append(errs, fmt.Errorf("input directory %s is not a directory", dirName))
+		}
+	}
+
+	if !validFormat(cfg.Input.Format) {
+		errs = append(errs, fmt.Errorf("unknown input format %s", cfg.Input.Format))
+	}
+	if !validOutputFormat(cfg.OutputFormat) {
+		errs = append(errs, fmt.Errorf("unknown output_format %s", cfg.OutputFormat))
+	}
+	if cfg.Input.Fallback != "" && cfg.Input.Fallback != "skip" && cfg.Input.Fallback != "text" {
+		errs = append(errs, fmt.Errorf("unknown input fallback %s", cfg.Input.Fallback))
+	}
+	if cfg.Input.StartAt != "" && cfg.Input.StartAt != "beginning" && cfg.Input.StartAt != "end" {
+		errs = append(errs, fmt.Errorf("unknown start_at %s", cfg.Input.StartAt))
+	}
+	if _, err := newMultiline(*cfg); err != nil {
+		errs = append(errs, err)
+	}
+
+	if cfg.Input.MaxRead < 0 {
+		errs = append(errs, errors.New("max_read must not be negative"))
+	}
+	if cfg.Input.MaxLineLength < 0 {
+		errs = append(errs, errors.New("max_line_length must not be negative"))
+	}
+	if cfg.Input.LongLines != "" && cfg.Input.LongLines != "truncate" && cfg.Input.LongLines != "split" {
+		errs = append(errs, fmt.Errorf("unknown long_lines %s", cfg.Input.LongLines))
+	}
+	if _, ok := lookupEncoding(cfg.Input.Encoding); !ok {
+		errs = append(errs, fmt.Errorf("unknown input encoding %s", cfg.Input.Encoding))
+	}
+	if cfg.Input.Readers < 0 {
+		errs = append(errs, errors.New("readers must not be negative"))
+	}
+	if cfg.Input.IdleTimeout < 0 {
+		errs = append(errs, errors.New("idle_timeout must not be negative"))
+	}
+	if cfg.Input.MaxOpenFiles < 0 {
+		errs = append(errs, errors.New("max_open_files must not be negative"))
+	}
+	if cfg.Input.StaleAfter < 0 {
+		errs = append(errs, errors.New("stale_after must not be negative"))
+	}
+	for pattern, after := range cfg.Input.StaleFiles {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			errs = append(errs, fmt.Errorf("stale_files pattern %s is invalid: %v", pattern, err))
+		}
+		if after < 0 {
+			errs = append(errs, fmt.Errorf("stale_files %s must not be negative", pattern))
+		}
+	}
+	if name := cfg.Input.StaleEvent; name != "" {
+		if _, ok := cfg.Events[name]; !ok {
+			errs = append(errs, fmt.Errorf("stale_event %s is not an event", name))
+		}
+	}
+
+	if cfg.PollInterval != 0 && (cfg.PollInterval < minPollInterval || cfg.PollInterval > maxPollInterval) {
+		errs = append(errs, fmt.Errorf("poll_interval %v is not between %v and %v", cfg.PollInterval, minPollInterval, maxPollInterval))
+	}
+
+	if cfg.MaxWatcherErrors < 0 {
+		errs = append(errs, errors.New("max_watcher_errors must not be negative"))
+	}
+
+	if cfg.LogLevel != "" {
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(cfg.LogLevel)); err != nil {
+			errs = append(errs, fmt.Errorf("unknown log_level %s", cfg.LogLevel))
+		}
+	}
+	if cfg.LogFormat != "" && cfg.LogFormat != "text" && cfg.LogFormat != "json" {
+		errs = append(errs, fmt.Errorf("unknown log_format %s", cfg.LogFormat))
+	}
+
+	if r := cfg.Retry; r.MaxAttempts < 0 || r.InitialInterval < 0 || r.MaxInterval < 0 || r.MaxElapsed < 0 {
+		errs = append(errs, errors.New("retry must not be negative"))
+	}
+
+	if d := cfg.Dispatch; d.Buffer < 0 || d.Workers < 0 {
+		errs = append(errs, errors.New("dispatch buffer and workers must not be negative"))
+	}
+	if d := cfg.Dispatch; d.Timeout < 0 || d.ShutdownTimeout < 0 {
+		errs = append(errs, errors.New("dispatch timeout and shutdown_timeout must not be negative"))
+	}
+	if err := cfg.validateHTTP(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := cfg.validateTLS(); err != nil {
+		errs = append(errs, err)
+	}
+	if d := cfg.Dispatch; d.OnFull != "" && d.OnFull != "block" && d.OnFull != "drop" {
+		errs = append(errs, fmt.Errorf("unknown dispatch on_full %s", d.OnFull))
+	}
+
+	if cfg.Timezone != "" {
+		if _, err := time.LoadLocation(cfg.Timezone); err != nil {
+			errs = append(errs, fmt.Errorf("unknown timezone %s", cfg.Timezone))
+		}
+	}
+
+	if _, ok := kafkaAcks[strings.ToLower(cfg.Kafka.Acks)]; !ok {
+		errs = append(errs, fmt.Errorf("unknown kafka acks %s", cfg.Kafka.Acks))
+	}
+	if cfg.Kafka.BatchSize < 0 || cfg.Kafka.BatchTimeout < 0 {
+		errs = append(errs, errors.New("kafka batch_size and batch_timeout must not be negative"))
+	}
+	if cfg.Kafka.Topic != "" && len(cfg.Kafka.Brokers) == 0 {
+		errs = append(errs, errors.New("kafka topic without brokers"))
+	}
+
+	if cfg.Redis.DB < 0 {
+		errs = append(errs, errors.New("redis db must not be negative"))
+	}
+
+	if cfg.Nats.URL != "" {
+		if _, err := newNatsSink(cfg.Nats.URL, "", "", "", "", nil); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if cfg.MQTT.Broker != "" {
+		if _, _, err := parseMQTTBroker(cfg.MQTT.Broker); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if cfg.MQTT.QoS < 0 || cfg.MQTT.QoS > 2 {
+		errs = append(errs, fmt.Errorf("mqtt qos %d is not 0, 1 or 2", cfg.MQTT.QoS))
+	}
+	if cfg.MQTT.KeepAlive < 0 || cfg.MQTT.KeepAlive > 0xffff*time.Second {
+		errs = append(errs, errors.New("mqtt keep_alive must be between 0 and 18h12m15s"))
+	}
+	if _, err := newMQTTSink(nil, cfg.MQTT.Topic); err != nil {
+		errs = append(errs, err)
+	}
+
+	if cfg.TCP.Addr != "" {
+		if _, _, err := net.SplitHostPort(cfg.TCP.Addr); err != nil {
+			errs = append(errs, fmt.Errorf("invalid tcp addr: %v", err))
+		}
+	}
+	if cfg.TCP.WriteTimeout < 0 {
+		errs = append(errs, errors.New("tcp write_timeout must not be negative"))
+	}
+
+	if cfg.Syslog.Facility != "" {
+		if _, ok := syslogFacilities[strings.ToLower(cfg.Syslog.Facility)]; !ok {
+			errs = append(errs, fmt.Errorf("unknown syslog facility %s", cfg.Syslog.Facility))
+		}
+	}
+
+	for _, key := range sortedKeys(cfg.Events) {
+		for _, err := range cfg.validateEvent(key, cfg.Events[key]) {
+			errs = append(errs, fmt.Errorf("event %s: %w", key, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// sortedKeys returns the names of the events in order.
+func sortedKeys(events map[string]EventConfig) []string {
+	keys := make([]string, 0, len(events))
+	for key := range events {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// regexFlags returns the inline flags prepended to the regexes of src.
+func (e EventConfig) regexFlags() string {
+	var flags string
+	if e.CaseInsensitive {
+		flags += "i"
+	}
+	if e.Multiline {
+		flags += "m"
+	}
+	if flags == "" {
+		return ""
+	}
+	return "(?" + flags + ")"
+}
+
+func (cfg *Config) validateEvent(key string, eventCfg EventConfig) []error {
+	var errs []error
+
+	structured := eventFormat(*cfg, eventCfg) != ""
+	var regexes []*regexp.Regexp
+	if key == cfg.Input.StaleEvent {
+		if len(eventCfg.Src) > 0 {
+			errs = append(errs, errors.New("the stale event must not have a src"))
+		}
+	} else if len(eventCfg.Src) == 0 {
+		// With structured formats, events filtering on fields match whole
+		// lines.
+		if !structured || len(eventCfg.Fields) == 0 {
+			errs = append(errs, errors.New("src is empty"))
+		}
+	}
+	for _, src := range eventCfg.Src {
+		if src == "" {
+			errs = append(errs, errors.New("src contains an empty regex"))
+		} else if compiled, err := regexp.Compile(eventCfg.regexFlags() + src); err != nil {
+			errs = append(errs, fmt.Errorf("src does not compile: %v", err))
+		} else if _, err := dedupGroup(eventCfg.DedupKey, compiled.SubexpNames()); err != nil {
+			errs = append(errs, err)
+		} else {
+			regexes = append(regexes, compiled)
+		}
+	}
+
+	if eventCfg.Prefilter != "" {
+		if _, err := regexp.Compile(eventCfg.Prefilter); err != nil {
+			errs = append(errs, fmt.Errorf("prefilter does not compile: %v", err))
+		}
+	}
+
+	output := outputFormat(*cfg, eventCfg)
+	if !validOutputFormat(eventCfg.OutputFormat) {
+		errs = append(errs, fmt.Errorf("unknown output_format %s", eventCfg.OutputFormat))
+	} else if output != outputTemplate {
+		if eventCfg.Dest != "" || eventCfg.Template != "" {
+			errs = append(errs, fmt.Errorf("dest and template are not used with output_format %s", output))
+		}
+	} else if eventCfg.Dest != "" && eventCfg.Template != "" {
+		errs = append(errs, errors.New("dest and template are mutually exclusive"))
+	} else if eventCfg.Dest == "" && eventCfg.Template == "" {
+		errs = append(errs, errors.New("either dest or template is required"))
+	} else if content, err := eventCfg.loadTemplate(); err != nil {
+		errs = append(errs, fmt.Errorf("template: %v", err))
+	} else if t, err := template.New(eventCfg.templateName()).Funcs(templateFunctions).Parse(string(content)); err != nil {
+		errs = append(errs, fmt.Errorf("template does not parse: %v", err))
+	} else if !structured {
+		// The fields of structured lines are only known at runtime.
+		var extra []string
+		if eventCfg.Aggregate.Window > 0 {
+			extra = aggregateData
+		}
+		if eventCfg.Alert.ResolveAfter > 0 {
+			extra = alertData
+		}
+		for i, re := range regexes {
+			for _, err := range unresolvedRefs(t, re, eventCfg.Tags, extra) {
+				if len(regexes) > 1 {
+					err = fmt.Errorf("src %d: %w", i+1, err)
+				}
+				if eventCfg.Strict {
+					errs = append(errs, err)
+				} else {
+					slog.Warn("Template refers to data that is never set", "event", key, "err", err)
+				}
+			}
+		}
+	}
+
+	if !validFormat(eventCfg.Format) {
+		errs = append(errs, fmt.Errorf("unknown format %s", eventCfg.Format))
+	}
+	if len(eventCfg.Fields) > 0 && !structured {
+		errs = append(errs, errors.New("fields require the json or logfmt format"))
+	}
+	if _, err := compileFields(eventCfg.Fields); err != nil {
+		errs = append(errs, err)
+	}
+
+	if level := eventCfg.Severity.Level; level != "" {
+		if _, ok := ParseSeverity(level); !ok {
+			errs = append(errs, fmt.Errorf("unknown severity level %s", level))
+		}
+	}
+	if group := eventCfg.Severity.Group; group != "" && !structured {
+		for _, re := range regexes {
+			if i, err := strconv.Atoi(group); err == nil && i >= 0 && i <= re.NumSubexp() {
+				continue
+			}
+			if re.SubexpIndex(group) < 0 {
+				errs = append(errs, fmt.Errorf("severity group %s is not a capture group of src", group))
+				break
+			}
+		}
+	}
+
+	if rl := eventCfg.RateLimit; rl.Events < 0 || rl.Interval < 0 || rl.Burst < 0 {
+		errs = append(errs, errors.New("rate_limit must not be negative"))
+	}
+	if eventCfg.DedupWindow < 0 {
+		errs = append(errs, errors.New("dedup_window must not be negative"))
+	}
+	if _, err := newSchedule(eventCfg.Schedule, nil); err != nil {
+		errs = append(errs, err)
+	}
+	if eventCfg.SampleRate < 0 || eventCfg.SampleRate > 1 {
+		errs = append(errs, errors.New("sample_rate must be between 0 and 1"))
+	}
+	if eventCfg.SampleKey != "" && eventCfg.SampleRate == 0 {
+		errs = append(errs, errors.New("sample_key requires a sample_rate"))
+	} else if eventCfg.SampleKey != "" && !structured {
+		for _, re := range regexes {
+			if i, err := strconv.Atoi(eventCfg.SampleKey); err == nil && i >= 0 && i <= re.NumSubexp() {
+				continue
+			}
+			if re.SubexpIndex(eventCfg.SampleKey) < 0 {
+				errs = append(errs, fmt.Errorf("sample_key %s is not a capture group of src", eventCfg.SampleKey))
+				break
+			}
+		}
+	}
+
+	if eventCfg.Aggregate.Window < 0 {
+		errs = append(errs, errors.New("aggregate window must not be negative"))
+	}
+	if group := eventCfg.Aggregate.GroupBy; group != "" && eventCfg.Aggregate.Window == 0 {
+		errs = append(errs, errors.New("aggregate group_by requires a window"))
+	} else if group != "" && !structured {
+		for _, re := range regexes {
+			if i, err := strconv.Atoi(group); err == nil && i >= 0 && i <= re.NumSubexp() {
+				continue
+			}
+			if re.SubexpIndex(group) < 0 {
+				errs = append(errs, fmt.Errorf("aggregate group_by %s is not a capture group of src", group))
+				break
+			}
+		}
+	}
+	if eventCfg.Aggregate.Window > 0 && eventCfg.DedupWindow > 0 {
+		errs = append(errs, errors.New("aggregated events cannot have a dedup_window"))
+	}
+	errs = append(errs, cfg.validateAlert(key, eventCfg, regexes, structured)...)
+
+	for i, sink := range eventCfg.Sinks {
+		if err := cfg.validateSink(sink); err != nil {
+			errs = append(errs, fmt.Errorf("sink %d: %w", i+1, err))
+		}
+	}
+	return errs
+}
+
+// validateAlert checks the alert config of an event.
+func (cfg *Config) validateAlert(key string, eventCfg EventConfig, regexes []*regexp.Regexp, structured bool) []error {
+	var errs []error
+	alert := eventCfg.Alert
+	if alert.ResolveAfter < 0 {
+		errs = append(errs, errors.New("alert resolve_after must not be negative"))
+	}
+	if alert.ResolveAfter == 0 {
+		if alert.Key != "" || alert.firing().configured() || alert.resolve().configured() {
+			errs = append(errs, errors.New("alert requires a resolve_after"))
+		}
+		return errs
+	}
+	if eventCfg.Aggregate.Window > 0 || eventCfg.DedupWindow > 0 {
+		errs = append(errs, errors.New("alerts cannot be aggregated or have a dedup_window"))
+	}
+	if alert.Key != "" && !structured {
+		for _, re := range regexes {
+			if i, err := strconv.Atoi(alert.Key); err == nil && i >= 0 && i <= re.NumSubexp() {
+				continue
+			}
+			if re.SubexpIndex(alert.Key) < 0 {
+				errs = append(errs, fmt.Errorf("alert key %s is not a capture group of src", alert.Key))
+				break
+			}
+		}
+	}
+	errs = append(errs, cfg.validateAlertNotice(key, eventCfg, regexes, structured, alert.firing(), []string{"State"})...)
+	errs = append(errs, cfg.validateAlertNotice(key, eventCfg, regexes, structured, alert.resolve(), alertData)...)
+	return errs
+}
+
+// validateAlertNotice checks the template and sinks of firing or resolved
+// alerts, whose templates get the extra data.
+func (cfg *Config) validateAlertNotice(key string, eventCfg EventConfig, regexes []*regexp.Regexp, structured bool, notice alertNoticeConfig, extra []string) []error {
+	var errs []error
+	if notice.dest != "" && notice.template != "" {
+		errs = append(errs, fmt.Errorf("alert %s_dest and %s_template are mutually exclusive", notice.name, notice.name))
+	} else if notice.hasTemplate() {
+		if content, err := notice.loadTemplate(); err != nil {
+			errs = append(errs, fmt.Errorf("alert %s template: %v", notice.name, err))
+		} else if t, err := template.New(notice.name + " template").Funcs(templateFunctions).Parse(string(content)); err != nil {
+			errs = append(errs, fmt.Errorf("alert %s template does not parse: %v", notice.name, err))
+		} else if !structured {
+			for i, re := range regexes {
+				for _, err := range unresolvedRefs(t, re, eventCfg.Tags, extra) {
+					if len(regexes) > 1 {
+						err = fmt.Errorf("src %d: %w", i+1, err)
+					}
+					err = fmt.Errorf("alert %s template: %w", notice.name, err)
+					if eventCfg.Strict {
+						errs = append(errs, err)
+					} else {
+						slog.Warn("Template refers to data that is never set", "event", key, "err", err)
+					}
+				}
+			}
+		}
+	}
+	for i, sink := range notice.sinks {
+		if err := cfg.validateSink(sink); err != nil {
+			errs = append(errs, fmt.Errorf("alert %s sink %d: %w", notice.name, i+1, err))
+		}
+	}
+	return errs
+}
+
+// loadTemplate returns the inline template of the event, or reads it from
+// Dest.
+func (e EventConfig) loadTemplate() ([]byte, error) {
+	if e.Template != "" {
+		return []byte(e.Template), nil
+	}
+	if e.Dest == "" {
+		return nil, errors.New("neither dest nor template is set")
+	}
+	return ioutil.ReadFile(e.Dest)
+}
+
+// templateName names the template of the event in messages.
+func (e EventConfig) templateName() string {
+	if e.Template != "" {
+		return "inline"
+	}
+	return e.Dest
+}
+
+func validOutputFormat(format string) bool {
+	switch format {
+	case "", outputTemplate, outputPlain, outputJSON:
+		return true
+	}
+	return false
+}
+
+func validFormat(format string) bool {
+	switch format {
+	case "", "text", "json", "logfmt":
+		return true
+	}
+	return false
+}
+
+func (cfg *Config) validateSink(sink SinkConfig) error {
+	if sink.MinSeverity != "" {
+		if _, ok := ParseSeverity(sink.MinSeverity); !ok {
+			return fmt.Errorf("unknown min_severity %s", sink.MinSeverity)
+		}
+	}
+	if sink.Timeout < 0 {
+		return errors.New("timeout must not be negative")
+	}
+	if (len(sink.Headers) > 0 || sink.BearerToken != "" || sink.Method != "") && sink.Type != "webhook" {
+		return errors.New("only webhook sinks have a method, headers and a bearer_token")
+	}
+	if sink.BatchSize != 0 || sink.BatchTimeout != 0 || sink.BatchFormat != "" {
+		if sink.Type != "webhook" && sink.Type != "elasticsearch" {
+			return errors.New("only webhook and elasticsearch sinks can be batched")
+		}
+		if sink.BatchFormat != "" && sink.Type != "webhook" {
+			return errors.New("only webhook sinks have a batch_format")
+		}
+		if sink.BatchSize < 0 || sink.BatchTimeout < 0 {
+			return errors.New("batch_size and batch_timeout must not be negative")
+		}
+		if sink.BatchFormat != "" && sink.BatchFormat != "json" && sink.BatchFormat != "ndjson" {
+			return fmt.Errorf("unknown batch_format %s", sink.BatchFormat)
+		}
+	}
+	switch sink.Type {
+	case "log":
+	case "webhook":
+		if sink.URL == "" {
+			return errors.New("webhook sink without url")
+		}
+		if err := validateWebhookRoute(sink); err != nil {
+			return err
+		}
+		for name := range sink.Headers {
+			if sink.BearerToken != "" && strings.EqualFold(name, "Authorization") {
+				return errors.New("bearer_token and an Authorization header are mutually exclusive")
+			}
+		}
+	case "slack":
+		if cfg.Slack.Token == "" && cfg.Slack.WebhookURL == "" {
+			return errors.New("slack sink without slack token or webhook_url")
+		}
+	case "discord":
+		if cfg.Discord.WebhookURL == "" {
+			return errors.New("discord sink without discord webhook_url")
+		}
+	case "file":
+		if sink.Path == "" {
+			return errors.New("file sink without path")
+		}
+	case "syslog":
+		if cfg.Syslog.Network == "" && cfg.Syslog.Address == "" && cfg.Syslog.Facility == "" && cfg.Syslog.Tag == "" {
+			return errors.New("syslog sink without syslog configuration")
+		}
+	case "redis":
+		if cfg.Redis.Addr == "" {
+			return errors.New("redis sink without redis addr")
+		}
+	case "nats":
+		if cfg.Nats.URL == "" {
+			return errors.New("nats sink without nats url")
+		}
+	case "mqtt":
+		if cfg.MQTT.Broker == "" {
+			return errors.New("mqtt sink without mqtt broker")
+		}
+		if _, err := newMQTTSink(nil, sink.Topic); err != nil {
+			return err
+		}
+	case "tcp":
+		if cfg.TCP.Addr == "" {
+			return errors.New("tcp sink without tcp addr")
+		}
+	case "kafka":
+		if len(cfg.Kafka.Brokers) == 0 {
+			return errors.New("kafka sink without kafka brokers")
+		}
+		if sink.Topic == "" && cfg.Kafka.Topic == "" {
+			return errors.New("kafka sink without topic")
+		}
+	case "elasticsearch":
+		if sink.URL == "" {
+			return errors.New("elasticsearch sink without url")
+		}
+		if sink.Index == "" {
+			return errors.New("elasticsearch sink without index")
+		}
+	case "pagerduty":
+		if sink.RoutingKey == "" {
+			return errors.New("pagerduty sink without routing_key")
+		}
+		if sink.Resolve != "" {
+			if _, err := regexp.Compile(sink.Resolve); err != nil {
+				return fmt.Errorf("pagerduty resolve does not compile: %v", err)
+			}
+			if sink.Key == "" {
+				return errors.New("pagerduty sink with resolve but without key")
+			}
+		}
+	case "sns":
+		if sink.TopicARN == "" {
+			return errors.New("sns sink without topic_arn")
+		}
+		if _, _, err := parseSNSTopicARN(sink.TopicARN); err != nil {
+			return err
+		}
+	case "command":
+		if sink.Command == "" {
+			return errors.New("command sink without command")
+		}
+		if sink.MaxConcurrent < 0 {
+			return errors.New("max_concurrent must not be negative")
+		}
+	default:
+		return fmt.Errorf("unknown sink type %q", sink.Type)
+	}
+	return nil
+}
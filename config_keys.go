@@ -0,0 +1,111 @@
+package sest
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// unknownField matches the errors yaml.v3 reports for keys without a field.
+var unknownField = regexp.MustCompile(`^line (\d+): field (\S+) not found in type (.+)$`)
+
+// explainUnknownKeys rewrites the errors about unknown keys in a config
+// decoded into v, suggesting the known key closest to a misspelled one.
+func explainUnknownKeys(err error, v interface{}) error {
+	var typeErr *yaml.TypeError
+	if !errors.As(err, &typeErr) {
+		return err
+	}
+	keys := configKeys(reflect.TypeOf(v))
+	explained := make([]string, len(typeErr.Errors))
+	for i, msg := range typeErr.Errors {
+		m := unknownField.FindStringSubmatch(msg)
+		if m == nil {
+			explained[i] = msg
+			continue
+		}
+		explained[i] = fmt.Sprintf("line %s: unknown key %s", m[1], m[2])
+		if suggestion := closestKey(m[2], keys[m[3]]); suggestion != "" {
+			explained[i] += fmt.Sprintf(", did you mean %s?", suggestion)
+		}
+	}
+	return &yaml.TypeError{Errors: explained}
+}
+
+// configKeys returns the keys of the structs reachable from t, by the name
+// yaml.v3 gives their type in errors.
+func configKeys(t reflect.Type) map[string][]string {
+	keys := make(map[string][]string)
+	var walk func(reflect.Type)
+	walk = func(t reflect.Type) {
+		switch t.Kind() {
+		case reflect.Pointer, reflect.Slice, reflect.Map:
+			walk(t.Elem())
+			return
+		case reflect.Struct:
+		default:
+			return
+		}
+		if _, ok := keys[t.String()]; ok {
+			return
+		}
+		var names []string
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = strings.ToLower(field.Name)
+			}
+			names = append(names, name)
+		}
+		keys[t.String()] = names
+		for i := 0; i < t.NumField(); i++ {
+			walk(t.Field(i).Type)
+		}
+	}
+	walk(t)
+	return keys
+}
+
+// closestKey returns the key closest to a misspelled one, if any is close
+// enough to be meant.
+func closestKey(key string, keys []string) string {
+	best, bestDist := "", len(key)/3+2
+	for _, k := range keys {
+		if d := editDistance(strings.ToLower(key), k); d < bestDist {
+			best, bestDist = k, d
+		}
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance of a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,92 @@
+package sest
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigUnknownKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		// errs are parts of the error, in order.
+		errs         []string
+		noSuggestion bool
+	}{
+		{
+			name:    "top-level key",
+			content: "pol_interval: 10ms\n",
+			errs:    []string{"line 1: unknown key pol_interval, did you mean poll_interval?"},
+		},
+		{
+			name:    "input key",
+			content: "input:\n  directores: [logs]\n",
+			errs:    []string{"line 2: unknown key directores, did you mean directories?"},
+		},
+		{
+			name:    "event key",
+			content: "events:\n  failed:\n    src: 'a'\n    template: 'a'\n    channelname: logins\n",
+			errs:    []string{"line 5: unknown key channelname, did you mean channel_name?"},
+		},
+		{
+			name:    "sink key",
+			content: "events:\n  failed:\n    src: 'a'\n    sinks:\n      - type: webhook\n        ulr: http://localhost\n",
+			errs:    []string{"line 6: unknown key ulr, did you mean url?"},
+		},
+		{
+			name:    "case",
+			content: "Poll_Interval: 10ms\n",
+			errs:    []string{"line 1: unknown key Poll_Interval, did you mean poll_interval?"},
+		},
+		{
+			name:         "nothing close",
+			content:      "colour: blue\n",
+			errs:         []string{"line 1: unknown key colour"},
+			noSuggestion: true,
+		},
+		{
+			name:    "several keys",
+			content: "pol_interval: 10ms\nevents:\n  failed:\n    srcs: 'a'\n",
+			errs:    []string{"line 1: unknown key pol_interval", "line 4: unknown key srcs, did you mean src?"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadConfig(writeConfig(t, "config.yml", tt.content))
+			if err == nil {
+				t.Fatal("LoadConfig() succeeded despite unknown keys")
+			}
+			msg := err.Error()
+			for _, want := range tt.errs {
+				i := strings.Index(msg, want)
+				if i < 0 {
+					t.Fatalf("LoadConfig() = %v, want an error containing %q", err, want)
+				}
+				msg = msg[i+len(want):]
+			}
+			if tt.noSuggestion && strings.Contains(err.Error(), "did you mean") {
+				t.Errorf("LoadConfig() = %v, want no suggestion", err)
+			}
+		})
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{a: "", b: "", want: 0},
+		{a: "src", b: "src", want: 0},
+		{a: "", b: "src", want: 3},
+		{a: "srcs", b: "src", want: 1},
+		{a: "ulr", b: "url", want: 2},
+		{a: "channelname", b: "channel_name", want: 1},
+		{a: "kitten", b: "sitting", want: 3},
+	}
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
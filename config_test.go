@@ -0,0 +1,383 @@
+package sest
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResolveRelativePaths(t *testing.T) {
+	configDir := t.TempDir()
+	tests := []struct {
+		name string
+		// os limits the case to windows or the other, posix systems, if
+		// set.
+		os   string
+		path string
+		want string
+	}{
+		{name: "relative", path: "app.log", want: filepath.Join(configDir, "app.log")},
+		{name: "relative with directories", path: filepath.Join("logs", "app.log"), want: filepath.Join(configDir, "logs", "app.log")},
+		{name: "parent directory", path: filepath.Join("..", "app.log"), want: filepath.Join(filepath.Dir(configDir), "app.log")},
+		{name: "posix absolute", os: "posix", path: "/var/log/app.log", want: "/var/log/app.log"},
+		{name: "windows relative with backslashes", os: "windows", path: `logs\app.log`, want: filepath.Join(configDir, "logs", "app.log")},
+		{name: "windows absolute", os: "windows", path: `C:\logs\app.log`, want: `C:\logs\app.log`},
+		{name: "windows absolute with slashes", os: "windows", path: `C:/logs/app.log`, want: `C:\logs\app.log`},
+		{name: "windows unc", os: "windows", path: `\\server\share\app.log`, want: `\\server\share\app.log`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.os != "" && (tt.os == "windows") != (runtime.GOOS == "windows") {
+				t.Skipf("only on %s", tt.os)
+			}
+			cfg := Config{StateFile: tt.path, OutputFile: tt.path}
+			cfg.Input.Files = []string{tt.path}
+			cfg.Input.Directories = []string{tt.path}
+			alert := AlertConfig{
+				FiringDest:   tt.path,
+				FiringSinks:  []SinkConfig{{Type: "file", Path: tt.path}},
+				ResolveDest:  tt.path,
+				ResolveSinks: []SinkConfig{{Type: "file", Path: tt.path}},
+			}
+			cfg.Events = map[string]EventConfig{"e": {Dest: tt.path, Sinks: []SinkConfig{{Type: "file", Path: tt.path}}, Alert: alert}}
+			cfg.ResolveRelativePaths(configDir)
+
+			for name, got := range map[string]string{
+				"input file":      cfg.Input.Files[0],
+				"input directory": cfg.Input.Directories[0],
+				"dest":            cfg.Events["e"].Dest,
+				"sink path":       cfg.Events["e"].Sinks[0].Path,
+				"firing dest":     cfg.Events["e"].Alert.FiringDest,
+				"firing sink":     cfg.Events["e"].Alert.FiringSinks[0].Path,
+				"resolve dest":    cfg.Events["e"].Alert.ResolveDest,
+				"resolve sink":    cfg.Events["e"].Alert.ResolveSinks[0].Path,
+				"output file":     cfg.OutputFile,
+				"state file":      cfg.StateFile,
+			} {
+				if got != tt.want {
+					t.Errorf("%s = %q, want %q", name, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+// TestResolveRelativePathsToRelativeDir checks that paths are resolved to
+// absolute ones, like the paths the watcher reports, if the config is found
+// by a relative path.
+func TestResolveRelativePathsToRelativeDir(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cfg Config
+	cfg.Input.Files = []string{"app.log"}
+	cfg.ResolveRelativePaths(filepath.Join(".", "configs"))
+	if want := filepath.Join(wd, "configs", "app.log"); cfg.Input.Files[0] != want {
+		t.Errorf("input file = %q, want %q", cfg.Input.Files[0], want)
+	}
+}
+
+// withEvent returns a func changing the event e of the config TestValidate
+// starts from.
+func withEvent(configure func(e *EventConfig)) func(cfg *Config) {
+	return func(cfg *Config) {
+		e := cfg.Events["e"]
+		configure(&e)
+		cfg.Events["e"] = e
+	}
+}
+
+// withSink returns a func giving the event e of the config TestValidate
+// starts from the sink.
+func withSink(sink SinkConfig) func(cfg *Config) {
+	return withEvent(func(e *EventConfig) { e.Sinks = []SinkConfig{sink} })
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(cfg *Config)
+		// err is a part of the error, none if empty.
+		err string
+	}{
+		{name: "valid", configure: func(cfg *Config) {}},
+		{name: "input filter", configure: func(cfg *Config) { cfg.Input.Filter = "(" }, err: "input filter ( does not compile"},
+		{name: "input exclude", configure: func(cfg *Config) { cfg.Input.Exclude = "[" }, err: "input exclude [ does not compile"},
+		{name: "negative max read", configure: func(cfg *Config) { cfg.Input.MaxRead = -1 }, err: "max_read must not be negative"},
+		{name: "unknown encoding", configure: func(cfg *Config) { cfg.Input.Encoding = "ebcdic" }, err: "unknown input encoding ebcdic"},
+		{name: "multiline start", configure: func(cfg *Config) { cfg.Input.Multiline.Start = "(" }, err: "could not compile multiline start ("},
+		{name: "multiline continuation", configure: func(cfg *Config) {
+			cfg.Input.Multiline.Start = "^E"
+			cfg.Input.Multiline.Continuation = "["
+		}, err: "could not compile multiline continuation ["},
+		{name: "alternative does not compile", configure: withEvent(func(e *EventConfig) { e.Src = Patterns{"a", "("} }), err: "src does not compile"},
+		{name: "empty alternative", configure: withEvent(func(e *EventConfig) { e.Src = Patterns{"a", ""} }), err: "src contains an empty regex"},
+		{name: "group missing from an alternative in strict mode", configure: withEvent(func(e *EventConfig) {
+			e.Src = Patterns{`(?P<user>\w+) failed`, `failed`}
+			e.Template = "{{.user}}"
+			e.Strict = true
+		}), err: "src 2: template refers to .user"},
+		{name: "dest and template", configure: withEvent(func(e *EventConfig) { e.Dest = "event.tmpl" }), err: "dest and template are mutually exclusive"},
+		{name: "no template", configure: withEvent(func(e *EventConfig) { e.Template = "" }), err: "either dest or template is required"},
+		{name: "missing dest", configure: withEvent(func(e *EventConfig) {
+			e.Template = ""
+			e.Dest = filepath.Join(t.TempDir(), "missing.tmpl")
+		}), err: "template: open"},
+		{name: "inline template does not parse", configure: withEvent(func(e *EventConfig) { e.Template = "{{.group0" }), err: "template does not parse: template: inline"},
+		{name: "unknown output format", configure: func(cfg *Config) { cfg.OutputFormat = "xml" }, err: "unknown output_format xml"},
+		{name: "unknown event output format", configure: withEvent(func(e *EventConfig) { e.OutputFormat = "xml" }), err: "unknown output_format xml"},
+		{name: "template with a plain output format", configure: withEvent(func(e *EventConfig) { e.OutputFormat = outputPlain }), err: "dest and template are not used with output_format plain"},
+		{name: "json output format without a template", configure: withEvent(func(e *EventConfig) {
+			e.OutputFormat = outputJSON
+			e.Template = ""
+		})},
+		{name: "negative dedup window", configure: withEvent(func(e *EventConfig) { e.DedupWindow = -time.Second }), err: "dedup_window must not be negative"},
+		{name: "unknown dedup key", configure: withEvent(func(e *EventConfig) {
+			e.DedupWindow = time.Second
+			e.DedupKey = "user"
+		}), err: "dedup_key user is not a capture group"},
+		{name: "negative rate limit", configure: withEvent(func(e *EventConfig) { e.RateLimit.Burst = -1 }), err: "rate_limit must not be negative"},
+		{name: "negative retry", configure: func(cfg *Config) { cfg.Retry.MaxElapsed = -time.Second }, err: "retry must not be negative"},
+		{name: "batched file sink", configure: withSink(SinkConfig{Type: "file", Path: "out.log", BatchSize: 10}), err: "only webhook and elasticsearch sinks can be batched"},
+		{name: "negative batch size", configure: withSink(SinkConfig{Type: "webhook", URL: "http://localhost", BatchSize: -1}), err: "batch_size and batch_timeout must not be negative"},
+		{name: "unknown batch format", configure: withSink(SinkConfig{Type: "webhook", URL: "http://localhost", BatchFormat: "xml"}), err: "unknown batch_format xml"},
+		{name: "negative sink timeout", configure: withSink(SinkConfig{Type: "file", Path: "out.log", Timeout: -time.Second}), err: "timeout must not be negative"},
+		{name: "headers of a file sink", configure: withSink(SinkConfig{Type: "file", Path: "out.log", Headers: map[string]string{"X-Key": "a"}}), err: "only webhook sinks have a method, headers and a bearer_token"},
+		{name: "bearer token of a log sink", configure: withSink(SinkConfig{Type: "log", BearerToken: "t0k3n"}), err: "only webhook sinks have a method, headers and a bearer_token"},
+		{name: "bearer token and authorization header", configure: withSink(SinkConfig{Type: "webhook", URL: "http://localhost", BearerToken: "t0k3n", Headers: map[string]string{"authorization": "Basic a"}}), err: "bearer_token and an Authorization header are mutually exclusive"},
+		{name: "webhook headers", configure: withSink(SinkConfig{Type: "webhook", URL: "http://localhost", BearerToken: "t0k3n", Headers: map[string]string{"X-Key": "a"}})},
+		{name: "unsupported webhook method", configure: withSink(SinkConfig{Type: "webhook", URL: "http://localhost", Method: "get"}), err: `unsupported webhook method "GET"`},
+		{name: "relative webhook url", configure: withSink(SinkConfig{Type: "webhook", URL: "localhost/events"}), err: "not an absolute http or https url"},
+		{name: "webhook url does not parse", configure: withSink(SinkConfig{Type: "webhook", URL: "http://localhost/{{.group1"}), err: "webhook url does not parse"},
+		{name: "batched templated webhook url", configure: withSink(SinkConfig{Type: "webhook", URL: "http://localhost/{{.group1}}", BatchSize: 10}), err: "batched webhook sinks cannot have a templated url or method"},
+		{name: "templated webhook url and method", configure: withSink(SinkConfig{Type: "webhook", URL: "{{.url}}", Method: "{{.method}}"})},
+		{name: "negative sample rate", configure: withEvent(func(e *EventConfig) { e.SampleRate = -0.1 }), err: "sample_rate must be between 0 and 1"},
+		{name: "sample rate above 1", configure: withEvent(func(e *EventConfig) { e.SampleRate = 1.5 }), err: "sample_rate must be between 0 and 1"},
+		{name: "sample key without rate", configure: withEvent(func(e *EventConfig) { e.SampleKey = "user" }), err: "sample_key requires a sample_rate"},
+		{name: "sample key not a group", configure: withEvent(func(e *EventConfig) { e.Src, e.SampleRate, e.SampleKey = Patterns{`(?P<user>\w+)`}, 0.5, "host" }), err: "sample_key host is not a capture group of src"},
+		{name: "sample key group number out of range", configure: withEvent(func(e *EventConfig) { e.Src, e.SampleRate, e.SampleKey = Patterns{`(\w+)`}, 0.5, "2" }), err: "sample_key 2 is not a capture group of src"},
+		{name: "sample key", configure: withEvent(func(e *EventConfig) { e.Src, e.SampleRate, e.SampleKey = Patterns{`(?P<user>\w+)`}, 0.5, "user" })},
+		{name: "sample key group number", configure: withEvent(func(e *EventConfig) { e.Src, e.SampleRate, e.SampleKey = Patterns{`(\w+)`}, 0.5, "1" })},
+		{name: "unknown severity level", configure: withEvent(func(e *EventConfig) { e.Severity.Level = "loud" }), err: "unknown severity level loud"},
+		{name: "severity group not a group", configure: withEvent(func(e *EventConfig) { e.Src, e.Severity.Group = Patterns{`(?P<level>\w+)`}, "lvl" }), err: "severity group lvl is not a capture group of src"},
+		{name: "severity group number out of range", configure: withEvent(func(e *EventConfig) { e.Src, e.Severity.Group = Patterns{`(\w+)`}, "2" }), err: "severity group 2 is not a capture group of src"},
+		{name: "severity group", configure: withEvent(func(e *EventConfig) { e.Src, e.Severity.Group = Patterns{`(?P<level>\w+)`}, "level" })},
+		{name: "severity group number", configure: withEvent(func(e *EventConfig) { e.Src, e.Severity.Group = Patterns{`(\w+)`}, "1" })},
+		{name: "invalid schedule", configure: withEvent(func(e *EventConfig) { e.Schedule.Windows = []ScheduleWindow{{Days: []string{"someday"}}} }), err: "schedule window 1: unknown day someday"},
+		{name: "schedule", configure: withEvent(func(e *EventConfig) {
+			e.Schedule = ScheduleConfig{Timezone: "UTC", Windows: []ScheduleWindow{{Days: []string{"mon-fri"}, From: "09:00", To: "17:00"}}}
+		})},
+		{name: "alert without resolve_after", configure: withEvent(func(e *EventConfig) { e.Alert.FiringTemplate = "fired" }), err: "alert requires a resolve_after"},
+		{name: "firing dest and template", configure: withEvent(func(e *EventConfig) {
+			e.Alert = AlertConfig{ResolveAfter: time.Minute, FiringDest: "fired.tmpl", FiringTemplate: "fired"}
+		}), err: "alert firing_dest and firing_template are mutually exclusive"},
+		{name: "firing template does not parse", configure: withEvent(func(e *EventConfig) {
+			e.Alert = AlertConfig{ResolveAfter: time.Minute, FiringTemplate: "{{if}}"}
+		}), err: "alert firing template does not parse"},
+		{name: "missing firing dest", configure: withEvent(func(e *EventConfig) {
+			e.Alert = AlertConfig{ResolveAfter: time.Minute, FiringDest: filepath.Join(t.TempDir(), "fired.tmpl")}
+		}), err: "alert firing template"},
+		{name: "strict firing template with resolved data", configure: withEvent(func(e *EventConfig) {
+			e.Strict = true
+			e.Alert = AlertConfig{ResolveAfter: time.Minute, FiringTemplate: "{{.State}} since {{.FiredAt}}"}
+		}), err: "alert firing template"},
+		{name: "invalid firing sink", configure: withEvent(func(e *EventConfig) {
+			e.Alert = AlertConfig{ResolveAfter: time.Minute, FiringSinks: []SinkConfig{{Type: "webhook"}}}
+		}), err: "alert firing sink 1: webhook sink without url"},
+		{name: "resolve dest and template", configure: withEvent(func(e *EventConfig) {
+			e.Alert = AlertConfig{ResolveAfter: time.Minute, ResolveDest: "resolved.tmpl", ResolveTemplate: "resolved"}
+		}), err: "alert resolve_dest and resolve_template are mutually exclusive"},
+		{name: "alert notices", configure: withEvent(func(e *EventConfig) {
+			e.Strict = true
+			e.Alert = AlertConfig{
+				ResolveAfter:    time.Minute,
+				FiringTemplate:  "{{.State}}",
+				FiringSinks:     []SinkConfig{{Type: "log"}},
+				ResolveTemplate: "{{.State}} after {{.Duration}}",
+				ResolveSinks:    []SinkConfig{{Type: "log"}},
+			}
+		})},
+		{name: "sink timeout", configure: withSink(SinkConfig{Type: "file", Path: "out.log", Timeout: time.Second})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Config{Events: map[string]EventConfig{"e": {Src: Patterns{"a"}, Template: "b"}}}
+			tt.configure(&cfg)
+			err := cfg.Validate()
+			if tt.err == "" && err != nil {
+				t.Errorf("Validate() = %v", err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Errorf("Validate() = %v, want an error containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestLoadTemplate(t *testing.T) {
+	dest := filepath.Join(t.TempDir(), "event.tmpl")
+	if err := os.WriteFile(dest, []byte("from {{.Filename}}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		event EventConfig
+		want  string
+		err   bool
+	}{
+		{name: "inline", event: EventConfig{Template: "user {{.group1}}"}, want: "user {{.group1}}"},
+		{name: "file", event: EventConfig{Dest: dest}, want: "from {{.Filename}}"},
+		{name: "missing file", event: EventConfig{Dest: dest + ".missing"}, err: true},
+		{name: "none", event: EventConfig{}, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.event.loadTemplate()
+			if (err != nil) != tt.err || string(got) != tt.want {
+				t.Errorf("loadTemplate() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+// writeConfig writes content to the config file name in a directory of its
+// own and returns its path.
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestLoadConfigFormats(t *testing.T) {
+	yamlConfig := `
+input:
+  files: [app.log]
+poll_interval: 10ms
+events:
+  failed:
+    src: 'login of (\w+) failed'
+    template: '{{.group1}}'
+    event_type: LoginFailed
+`
+	jsonConfig := `{
+  "input": {"files": ["app.log"]},
+  "poll_interval": "10ms",
+  "events": {
+    "failed": {
+      "src": "login of (\\w+) failed",
+      "template": "{{.group1}}",
+      "event_type": "LoginFailed"
+    }
+  }
+}`
+	tests := []struct {
+		name    string
+		content string
+		// err is a part of the error, none if empty.
+		err string
+	}{
+		{name: "config.yml", content: yamlConfig},
+		{name: "config.yaml", content: yamlConfig},
+		{name: "config.json", content: jsonConfig},
+		{name: "config.JSON", content: jsonConfig},
+		// Files without a known extension are YAML, a superset of JSON.
+		{name: "config", content: jsonConfig},
+		{name: "config.conf", content: yamlConfig},
+		{name: "yaml.json", content: yamlConfig, err: "invalid JSON"},
+		{name: "trailing comma.json", content: `{"poll_interval": "10ms",}`, err: "invalid JSON"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := LoadConfig(writeConfig(t, tt.name, tt.content))
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("LoadConfig() = %v, want an error containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			event := cfg.Events["failed"]
+			if len(cfg.Input.Files) != 1 || cfg.Input.Files[0] != "app.log" || cfg.PollInterval != 10*time.Millisecond ||
+				len(event.Src) != 1 || event.Src[0] != `login of (\w+) failed` || event.Template != "{{.group1}}" || event.EventType != "LoginFailed" {
+				t.Errorf("LoadConfig() = %+v", cfg)
+			}
+		})
+	}
+}
+
+func TestLoadConfigDuplicateKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		err     string
+	}{
+		{
+			name: "event",
+			file: "config.yml",
+			content: `
+events:
+  failed:
+    src: 'a'
+    template: 'a'
+  failed:
+    src: 'b'
+    template: 'b'
+`,
+			err: `line 6: key "failed" already defined at line 3`,
+		},
+		{
+			name: "top-level key",
+			file: "config.yml",
+			content: `
+poll_interval: 10ms
+poll_interval: 20ms
+`,
+			err: `line 3: key "poll_interval" already defined at line 2`,
+		},
+		{
+			name: "event key",
+			file: "config.yml",
+			content: `
+events:
+  failed:
+    src: 'a'
+    src: 'b'
+`,
+			err: `line 5: key "src" already defined at line 4`,
+		},
+		{
+			name:    "json",
+			file:    "config.json",
+			content: `{"events": {"failed": {"src": "a"}, "failed": {"src": "b"}}}`,
+			err:     `line 1: key "failed" already defined at line 1`,
+		},
+		{
+			name: "json event key",
+			file: "config.json",
+			content: `{
+  "events": {
+    "failed": {"src": "a", "template": "a", "src": "b"}
+  }
+}`,
+			err: `line 3: key "src" already defined at line 3`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadConfig(writeConfig(t, tt.file, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("LoadConfig() = %v, want an error containing %q", err, tt.err)
+			}
+		})
+	}
+}
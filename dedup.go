@@ -0,0 +1,128 @@
+package sest
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// deduplicator suppresses repeats of an event within a time window. It is
+// safe for concurrent use, as files are matched concurrently.
+type deduplicator struct {
+	mu     sync.Mutex
+	window time.Duration
+	seen   map[string]*dedupEntry
+	pruned time.Time
+}
+
+// dedupEntry is the window opened by the last delivered event with a
+// fingerprint and the number of repeats suppressed since.
+type dedupEntry struct {
+	start      time.Time
+	suppressed int
+}
+
+// newDeduplicator returns nil if window is zero, disabling deduplication.
+func newDeduplicator(window time.Duration) *deduplicator {
+	if window <= 0 {
+		return nil
+	}
+	return &deduplicator{window: window, seen: make(map[string]*dedupEntry)}
+}
+
+// check records an occurrence of fingerprint. It reports whether the
+// occurrence repeats an event delivered within the window, and otherwise how
+// many repeats were suppressed in the previous window.
+func (d *deduplicator) check(eventType, fingerprint string, now time.Time) (duplicate bool, suppressed int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.prune(eventType, now)
+
+	entry, ok := d.seen[fingerprint]
+	if !ok {
+		d.seen[fingerprint] = &dedupEntry{start: now}
+		return false, 0
+	}
+	if now.Sub(entry.start) < d.window {
+		entry.suppressed++
+		return true, 0
+	}
+	suppressed = entry.suppressed
+	*entry = dedupEntry{start: now}
+	return false, suppressed
+}
+
+// prune forgets the fingerprints that have not been delivered for two
+// windows, keeping the suppressed counts of recently expired windows for the
+// next delivery. It runs at most once per window.
+func (d *deduplicator) prune(eventType string, now time.Time) {
+	if now.Sub(d.pruned) < d.window {
+		return
+	}
+	d.pruned = now
+	for fingerprint, entry := range d.seen {
+		if now.Sub(entry.start) < 2*d.window {
+			continue
+		}
+		if entry.suppressed > 0 {
+			slog.Info("Suppressed duplicates of event", "event_type", eventType, "count", entry.suppressed)
+		}
+		delete(d.seen, fingerprint)
+	}
+}
+
+// dedupGroup resolves the dedup key of an event, the name or number of a
+// capture group, to the group's index. An empty key returns -1, which
+// makes the rendered output the fingerprint.
+func dedupGroup(key string, names []string) (int, error) {
+	if key == "" {
+		return -1, nil
+	}
+	if i, err := strconv.Atoi(key); err == nil && i >= 0 && i < len(names) {
+		return i, nil
+	}
+	for i, name := range names {
+		if name != "" && name == key {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("dedup_key %s is not a capture group of src", key)
+}
+
+// renderUnique renders a match unless it renders only white space, which
+// lets templates filter matches, or repeats an event delivered within the
+// dedup window of e. ok is false if the match is skipped or cannot be
+// rendered.
+func (e Event) renderUnique(filename string, text []byte, submatches []int, doc map[string]interface{}) (rendered RenderedEvent, ok bool, err error) {
+	rendered, err = e.render(filename, text, submatches, doc, 0)
+	if err != nil {
+		return rendered, false, err
+	}
+	if len(bytes.TrimSpace(rendered.Body)) == 0 {
+		slog.Debug("Skipping empty event", "event_type", e.EventType, "file", filename)
+		emptyEvents.WithLabelValues(e.EventType).Inc()
+		return RenderedEvent{}, false, nil
+	}
+	if e.dedup == nil {
+		return rendered, true, nil
+	}
+
+	fingerprint := string(rendered.Body)
+	if e.dedupGroup >= 0 {
+		fingerprint = ""
+		if start := submatches[2*e.dedupGroup]; start >= 0 {
+			fingerprint = string(text[start:submatches[2*e.dedupGroup+1]])
+		}
+	}
+	duplicate, suppressed := e.dedup.check(e.EventType, fingerprint, time.Now())
+	if duplicate {
+		return RenderedEvent{}, false, nil
+	}
+	if suppressed > 0 {
+		rendered, err = e.render(filename, text, submatches, doc, suppressed)
+	}
+	return rendered, err == nil, err
+}
@@ -0,0 +1,195 @@
+package sest
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestDeduplicator(t *testing.T) {
+	type step struct {
+		// at is the time of the occurrence since the first one.
+		at          time.Duration
+		fingerprint string
+		duplicate   bool
+		suppressed  int
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "repeats within the window",
+			steps: []step{
+				{at: 0, fingerprint: "a"},
+				{at: time.Second, fingerprint: "a", duplicate: true},
+				{at: 59 * time.Second, fingerprint: "a", duplicate: true},
+			},
+		},
+		{
+			name: "suppressed count after the window",
+			steps: []step{
+				{at: 0, fingerprint: "a"},
+				{at: time.Second, fingerprint: "a", duplicate: true},
+				{at: 2 * time.Second, fingerprint: "a", duplicate: true},
+				{at: time.Minute, fingerprint: "a", suppressed: 2},
+				// The window starts over with the delivered event.
+				{at: time.Minute + time.Second, fingerprint: "a", duplicate: true},
+			},
+		},
+		{
+			name: "fingerprints apart",
+			steps: []step{
+				{at: 0, fingerprint: "a"},
+				{at: 0, fingerprint: "b"},
+				{at: time.Second, fingerprint: "a", duplicate: true},
+				{at: time.Second, fingerprint: "b", duplicate: true},
+				{at: time.Second, fingerprint: "c"},
+			},
+		},
+		{
+			name: "repeats of an expired window are kept until the next delivery",
+			steps: []step{
+				{at: 0, fingerprint: "a"},
+				{at: time.Second, fingerprint: "a", duplicate: true},
+				{at: 90 * time.Second, fingerprint: "b"},
+				{at: 100 * time.Second, fingerprint: "a", suppressed: 1},
+			},
+		},
+		{
+			name: "forgotten after two windows",
+			steps: []step{
+				{at: 0, fingerprint: "a"},
+				{at: time.Second, fingerprint: "a", duplicate: true},
+				{at: 3 * time.Minute, fingerprint: "a"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newDeduplicator(time.Minute)
+			start := time.Now()
+			for i, s := range tt.steps {
+				duplicate, suppressed := d.check("E", s.fingerprint, start.Add(s.at))
+				if duplicate != s.duplicate || suppressed != s.suppressed {
+					t.Errorf("occurrence %d of %s at %v: check() = %v, %d, want %v, %d", i, s.fingerprint, s.at, duplicate, suppressed, s.duplicate, s.suppressed)
+				}
+			}
+		})
+	}
+}
+
+func TestNewDeduplicatorDisabled(t *testing.T) {
+	if d := newDeduplicator(0); d != nil {
+		t.Errorf("newDeduplicator(0) = %v, want nil", d)
+	}
+}
+
+func TestDedupGroup(t *testing.T) {
+	names := []string{"", "user", ""}
+	tests := []struct {
+		key  string
+		want int
+		err  bool
+	}{
+		{key: "", want: -1},
+		{key: "0", want: 0},
+		{key: "2", want: 2},
+		{key: "user", want: 1},
+		{key: "3", err: true},
+		{key: "host", err: true},
+	}
+	for _, tt := range tests {
+		got, err := dedupGroup(tt.key, names)
+		if (err != nil) != tt.err || (!tt.err && got != tt.want) {
+			t.Errorf("dedupGroup(%q) = %d, %v, want %d", tt.key, got, err, tt.want)
+		}
+	}
+}
+
+func TestRenderUnique(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		key      string
+		lines    []string
+		// delivered are the bodies delivered for lines, in order.
+		delivered []string
+	}{
+		{
+			name:      "rendered body",
+			template:  "{{.user}} from {{.host}}",
+			lines:     []string{"login of alice from a", "login of alice from a", "login of alice from b"},
+			delivered: []string{"alice from a", "alice from b"},
+		},
+		{
+			name:      "dedup key",
+			template:  "{{.user}} from {{.host}}",
+			key:       "user",
+			lines:     []string{"login of alice from a", "login of alice from b", "login of bob from a"},
+			delivered: []string{"alice from a", "bob from a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := testEvent(t, `login of (?P<user>\w+) from (?P<host>\w+)`, tt.template, false)
+			e.dedup = newDeduplicator(time.Hour)
+			group, err := dedupGroup(tt.key, e.GroupNames)
+			if err != nil {
+				t.Fatal(err)
+			}
+			e.dedupGroup = group
+
+			var delivered []string
+			for _, line := range tt.lines {
+				rendered, ok, err := e.renderUnique("app.log", []byte(line), e.Regex.FindSubmatchIndex([]byte(line)), nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if ok {
+					delivered = append(delivered, string(rendered.Body))
+				}
+			}
+			if !reflect.DeepEqual(delivered, tt.delivered) {
+				t.Errorf("delivered %q, want %q", delivered, tt.delivered)
+			}
+		})
+	}
+}
+
+// TestRenderUniqueSkipsEmpty checks that matches whose template renders only
+// white space are skipped and counted.
+func TestRenderUniqueSkipsEmpty(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		line     string
+		skipped  bool
+	}{
+		{name: "condition met", template: `{{if eq .level "error"}}{{.message}}{{end}}`, line: "error disk full", skipped: false},
+		{name: "condition not met", template: `{{if eq .level "error"}}{{.message}}{{end}}`, line: "info disk full", skipped: true},
+		{name: "white space only", template: "{{if eq .level \"error\"}}{{.message}}{{end}} \n\t", line: "info disk full", skipped: true},
+		{name: "empty group", template: `{{.message}}`, line: "info ", skipped: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := testEvent(t, `(?P<level>\w+) (?P<message>.*)`, tt.template, false)
+			e.EventType = "SkipTest"
+			skips := emptyEvents.WithLabelValues(e.EventType)
+			before := testutil.ToFloat64(skips)
+			_, ok, err := e.renderUnique("app.log", []byte(tt.line), e.Regex.FindSubmatchIndex([]byte(tt.line)), nil)
+			if err != nil || ok == tt.skipped {
+				t.Errorf("renderUnique() = %v, %v, want skipped %v", ok, err, tt.skipped)
+			}
+			want := 0.0
+			if tt.skipped {
+				want = 1
+			}
+			if got := testutil.ToFloat64(skips) - before; got != want {
+				t.Errorf("counted %v skips, want %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package sest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// discordMaxContent is the number of characters Discord accepts as the
+	// content of a message.
+	discordMaxContent = 2000
+	// discordRateLimitRetries is how often a rate limited message is
+	// retried, after the delay Discord asks for, or discordRateLimitDelay
+	// if it names none.
+	discordRateLimitRetries = 3
+	discordRateLimitDelay   = time.Second
+)
+
+// discordSink posts rendered events to a Discord channel through a webhook.
+// Bodies longer than Discord accepts are split into several messages,
+// preferably at line breaks.
+type discordSink struct {
+	client     *http.Client
+	webhookURL string
+	username   string
+	avatarURL  string
+}
+
+type discordMessage struct {
+	Content   string `json:"content"`
+	Username  string `json:"username,omitempty"`
+	AvatarURL string `json:"avatar_url,omitempty"`
+}
+
+// discordRateLimit is the response of Discord to rate limited requests.
+type discordRateLimit struct {
+	Message string `json:"message"`
+	// RetryAfter is the number of seconds to wait before retrying.
+	RetryAfter float64 `json:"retry_after"`
+}
+
+func newDiscordSink(client *http.Client, webhookURL, username, avatarURL string) *discordSink {
+	if webhookURL == "" {
+		return nil
+	}
+	return &discordSink{client: client, webhookURL: webhookURL, username: username, avatarURL: avatarURL}
+}
+
+// Deliver posts the messages of an event in order. If one of them fails, the
+// event is retried as a whole, reposting the messages before it.
+func (s *discordSink) Deliver(ctx context.Context, e RenderedEvent) error {
+	content := strings.TrimSpace(string(e.Body))
+	for _, part := range splitDiscordContent(content, discordMaxContent) {
+		payload, err := json.Marshal(discordMessage{Content: part, Username: s.username, AvatarURL: s.avatarURL})
+		if err != nil {
+			return err
+		}
+		if err := s.postWithRetries(ctx, payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitDiscordContent splits content into parts of at most max characters,
+// at the last line break of a part, or else its last space, if any.
+func splitDiscordContent(content string, max int) []string {
+	var parts []string
+	for utf8.RuneCountInString(content) > max {
+		end := 0
+		for n := 0; n < max; n++ {
+			_, size := utf8.DecodeRuneInString(content[end:])
+			end += size
+		}
+		cut := strings.LastIndexByte(content[:end], '\n')
+		if cut <= 0 {
+			cut = strings.LastIndexByte(content[:end], ' ')
+		}
+		if cut <= 0 {
+			cut = end
+		}
+		parts = append(parts, strings.TrimRight(content[:cut], " \r\n"))
+		content = strings.TrimLeft(content[cut:], " \r\n")
+	}
+	return append(parts, content)
+}
+
+// postWithRetries posts a message, waiting as long as Discord asks for if it
+// is rate limited. Delays beyond the deadline of ctx fail right away.
+func (s *discordSink) postWithRetries(ctx context.Context, payload []byte) error {
+	for retries := 0; ; retries++ {
+		delay, err := s.post(ctx, payload)
+		if delay == 0 || retries == discordRateLimitRetries {
+			return err
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+			return err
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
+
+// post posts a message and returns the delay to retry it after if it was
+// rate limited, zero otherwise.
+func (s *discordSink) post(ctx context.Context, payload []byte) (time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.webhookURL, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		delay := discordRetryAfter(resp.Header, body)
+		return delay, fmt.Errorf("discord rate limited, retry after %v", delay)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		err := fmt.Errorf("discord responded with status %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 {
+			return 0, permanent(err)
+		}
+		return 0, err
+	}
+	return 0, nil
+}
+
+// discordRetryAfter returns the delay a rate limited response asks for, from
+// its body, which is more precise, or else its Retry-After header.
+func discordRetryAfter(header http.Header, body []byte) time.Duration {
+	var limit discordRateLimit
+	if json.Unmarshal(body, &limit) == nil && limit.RetryAfter > 0 {
+		return time.Duration(limit.RetryAfter * float64(time.Second))
+	}
+	if seconds, err := strconv.ParseFloat(header.Get("Retry-After"), 64); err == nil && seconds > 0 {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	return discordRateLimitDelay
+}
+
+func (s *discordSink) String() string {
+	return "discord"
+}
@@ -0,0 +1,131 @@
+package sest
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Defaults of the dispatch config.
+const (
+	defaultDispatchBuffer  = 1000
+	defaultDispatchWorkers = 1
+)
+
+// dispatcher delivers rendered events from a buffered queue on worker
+// goroutines, so slow sinks do not hold up reading the input files. Events
+// are enqueued concurrently by the goroutines matching the input, while the
+// events are only replaced when none of them is running.
+//
+// Deliveries run under the context of the dispatcher, which is only cancelled
+// once the shutdown timeout passed on close, so shutting down delivers the
+// queued events rather than abandoning them. Each attempt is bounded by the
+// delivery timeout on top of that.
+type dispatcher struct {
+	queue   chan delivery
+	workers int
+	drop    bool
+	timeout time.Duration
+	// shutdownTimeout bounds close, after which ctx is cancelled.
+	shutdownTimeout time.Duration
+	ctx             context.Context
+	cancel          context.CancelFunc
+	// pending counts the queued deliveries of the current events, so the
+	// sinks of replaced events are closed only once they are delivered.
+	pending *sync.WaitGroup
+	done    sync.WaitGroup
+}
+
+type delivery struct {
+	event    Event
+	rendered RenderedEvent
+	pending  *sync.WaitGroup
+}
+
+func newDispatcher(cfg DispatchConfig) *dispatcher {
+	d := &dispatcher{
+		workers:         cfg.Workers,
+		drop:            cfg.OnFull == "drop",
+		timeout:         cfg.Timeout,
+		shutdownTimeout: cfg.ShutdownTimeout,
+		pending:         &sync.WaitGroup{},
+	}
+	d.ctx, d.cancel = context.WithCancel(context.Background())
+	if d.workers <= 0 {
+		d.workers = defaultDispatchWorkers
+	}
+	buffer := cfg.Buffer
+	if buffer <= 0 {
+		buffer = defaultDispatchBuffer
+	}
+	d.queue = make(chan delivery, buffer)
+	return d
+}
+
+// start starts the workers.
+func (d *dispatcher) start() {
+	for i := 0; i < d.workers; i++ {
+		d.done.Add(1)
+		go func() {
+			defer d.done.Done()
+			for dl := range d.queue {
+				deliver(d.ctx, dl.event, dl.rendered, d.timeout)
+				dl.pending.Done()
+			}
+		}()
+	}
+}
+
+// enqueue queues a rendered event for delivery. If the queue is full it waits
+// for a free slot, or drops the event if the dispatcher is configured to.
+func (d *dispatcher) enqueue(e Event, rendered RenderedEvent) {
+	dl := delivery{event: e, rendered: rendered, pending: d.pending}
+	d.pending.Add(1)
+	if !d.drop {
+		d.queue <- dl
+		return
+	}
+	select {
+	case d.queue <- dl:
+	default:
+		d.pending.Done()
+		dispatchDropped.WithLabelValues(e.EventType).Inc()
+		slog.Warn("Dispatch queue is full, dropping event", "event_type", e.EventType, "file", rendered.Filename)
+	}
+}
+
+// replace closes the sinks of events once their queued deliveries are done.
+// It is called when the events are replaced by the ones of a new config.
+func (d *dispatcher) replace(events []Event) {
+	pending := d.pending
+	d.pending = &sync.WaitGroup{}
+	go func() {
+		pending.Wait()
+		closeSinks(events)
+	}()
+}
+
+// close delivers the queued events and stops the workers, cancelling the
+// deliveries once the shutdown timeout has passed.
+func (d *dispatcher) close() {
+	close(d.queue)
+	defer d.cancel()
+	if d.shutdownTimeout <= 0 {
+		d.done.Wait()
+		return
+	}
+
+	done := make(chan struct{})
+	go func() {
+		d.done.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(d.shutdownTimeout):
+		slog.Warn("Delivering the queued events timed out, cancelling the deliveries", "queued", len(d.queue), "shutdown_timeout", d.shutdownTimeout)
+		d.cancel()
+		<-done
+	}
+}
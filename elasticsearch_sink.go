@@ -0,0 +1,170 @@
+package sest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// defaultElasticsearchBatchSize is the number of events indexed at once if
+// the sink config sets no batch_size.
+const defaultElasticsearchBatchSize = 100
+
+// indexDate matches the time layouts in braces in an index name.
+var indexDate = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// elasticsearchIndexer indexes batches of events into Elasticsearch with the
+// _bulk API. The fields of an event are the document, along with its
+// @timestamp, event_type, filename, line and severity, unless fields have
+// these names.
+type elasticsearchIndexer struct {
+	client   *http.Client
+	url      string
+	index    string
+	username string
+	password string
+}
+
+// newElasticsearchSink returns a sink indexing events in batches as
+// configured by spec.
+func newElasticsearchSink(client *http.Client, spec SinkConfig, retry retryPolicy, deadLetter *fileSink) *batchSink {
+	if spec.BatchSize <= 0 {
+		spec.BatchSize = defaultElasticsearchBatchSize
+	}
+	target := &elasticsearchIndexer{
+		client:   client,
+		url:      strings.TrimSuffix(spec.URL, "/") + "/_bulk",
+		index:    spec.Index,
+		username: spec.Username,
+		password: spec.Password,
+	}
+	return newBatchSink(target, spec, retry, deadLetter)
+}
+
+// indexName returns the index for events indexed at t, replacing the time
+// layouts in braces, e.g. events-{2006.01.02}, with the date.
+func indexName(index string, t time.Time) string {
+	return indexDate.ReplaceAllStringFunc(index, func(layout string) string {
+		return t.Format(layout[1 : len(layout)-1])
+	})
+}
+
+type bulkAction struct {
+	Index struct {
+		Index string `json:"_index"`
+	} `json:"index"`
+}
+
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int `json:"status"`
+		Error  *struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	} `json:"items"`
+}
+
+func (s *elasticsearchIndexer) sendBatch(ctx context.Context, batch []RenderedEvent) []batchFailure {
+	now := time.Now().UTC()
+	var action bulkAction
+	action.Index.Index = indexName(s.index, now)
+
+	var payload bytes.Buffer
+	enc := json.NewEncoder(&payload)
+	for _, e := range batch {
+		doc := make(map[string]string, len(e.Fields)+5)
+		doc["@timestamp"] = now.Format(time.RFC3339Nano)
+		doc["event_type"] = e.EventType
+		doc["filename"] = e.Filename
+		doc["line"] = e.Line
+		if severity := e.Severity.String(); severity != "" {
+			doc["severity"] = severity
+		}
+		for name, value := range e.Fields {
+			doc[name] = value
+		}
+		if err := enc.Encode(action); err != nil {
+			return failAll(batch, permanent(err))
+		}
+		if err := enc.Encode(doc); err != nil {
+			return failAll(batch, permanent(err))
+		}
+	}
+
+	body, err := s.post(ctx, payload.Bytes())
+	if err != nil {
+		return failAll(batch, err)
+	}
+	var resp bulkResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return failAll(batch, fmt.Errorf("could not decode bulk response: %v", err))
+	}
+	if !resp.Errors {
+		return nil
+	}
+	if len(resp.Items) != len(batch) {
+		return failAll(batch, fmt.Errorf("bulk response has %d items for %d events", len(resp.Items), len(batch)))
+	}
+
+	// Items rejected for load, 429 or a server error, are worth retrying;
+	// others, like mapping errors, are not.
+	var failures []batchFailure
+	for i, item := range resp.Items {
+		result := item["index"]
+		if result.Status >= 200 && result.Status <= 299 {
+			continue
+		}
+		err := fmt.Errorf("indexing failed with status %d", result.Status)
+		if result.Error != nil {
+			err = fmt.Errorf("indexing failed with status %d: %s: %s", result.Status, result.Error.Type, result.Error.Reason)
+		}
+		if result.Status != http.StatusTooManyRequests && result.Status < 500 {
+			err = permanent(err)
+		}
+		failures = append(failures, batchFailure{event: batch[i], err: err})
+	}
+	return failures
+}
+
+// post sends a bulk request and returns the response body.
+func (s *elasticsearchIndexer) post(ctx context.Context, payload []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if s.username != "" {
+		req.SetBasicAuth(s.username, s.password)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		err := fmt.Errorf("elasticsearch responded with status %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+			return nil, permanent(err)
+		}
+		return nil, err
+	}
+	return body, nil
+}
+
+func (s *elasticsearchIndexer) String() string {
+	return "elasticsearch " + strings.TrimSuffix(s.url, "/_bulk")
+}
@@ -0,0 +1,209 @@
+package sest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// textEncoding is an encoding other than UTF-8 the input may be written in.
+// Lines are split in the encoding, so offsets keep counting the bytes of the
+// file, and then transcoded to UTF-8 for matching.
+type textEncoding struct {
+	encoding encoding.Encoding
+	// unit is the size of a code unit in bytes, order the byte order of
+	// code units of two bytes.
+	unit  int
+	order binary.ByteOrder
+	// newline and bom are the encoded line feed and byte order mark, if
+	// the encoding has one.
+	newline []byte
+	bom     []byte
+}
+
+var (
+	utf16LE = &textEncoding{
+		encoding: unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM),
+		unit:     2,
+		order:    binary.LittleEndian,
+		newline:  []byte{'\n', 0},
+		bom:      []byte{0xFF, 0xFE},
+	}
+	utf16BE = &textEncoding{
+		encoding: unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM),
+		unit:     2,
+		order:    binary.BigEndian,
+		newline:  []byte{0, '\n'},
+		bom:      []byte{0xFE, 0xFF},
+	}
+)
+
+// textEncodings maps the names of the input encodings to them. UTF-8 needs
+// no transcoding, so it maps to nil.
+var textEncodings = map[string]*textEncoding{
+	"":             nil,
+	"utf-8":        nil,
+	"utf8":         nil,
+	"utf-16le":     utf16LE,
+	"utf-16be":     utf16BE,
+	"latin1":       {encoding: charmap.ISO8859_1, unit: 1, newline: []byte{'\n'}},
+	"iso-8859-1":   {encoding: charmap.ISO8859_1, unit: 1, newline: []byte{'\n'}},
+	"windows-1252": {encoding: charmap.Windows1252, unit: 1, newline: []byte{'\n'}},
+}
+
+func lookupEncoding(name string) (*textEncoding, bool) {
+	enc, ok := textEncodings[strings.ToLower(name)]
+	return enc, ok
+}
+
+// lastLineEnd returns the index behind the last newline in buf, 0 if there
+// is none.
+func (e *textEncoding) lastLineEnd(buf []byte) int {
+	if e.unit == 1 {
+		return bytes.LastIndexByte(buf, '\n') + 1
+	}
+	end := 0
+	for i := 0; i+e.unit <= len(buf); i += e.unit {
+		if bytes.Equal(buf[i:i+e.unit], e.newline) {
+			end = i + e.unit
+		}
+	}
+	return end
+}
+
+// firstLineEnd returns the index behind the first newline in buf, -1 if
+// there is none.
+func (e *textEncoding) firstLineEnd(buf []byte) int {
+	for i := 0; i+e.unit <= len(buf); i += e.unit {
+		if bytes.Equal(buf[i:i+e.unit], e.newline) {
+			return i + e.unit
+		}
+	}
+	return -1
+}
+
+// cut returns where to cut buf at most n bytes in, without cutting a
+// character in two.
+func (e *textEncoding) cut(buf []byte, n int) int {
+	n -= n % e.unit
+	if e.unit == 2 && n >= 2 {
+		if u := e.order.Uint16(buf[n-2 : n]); u >= 0xD800 && u < 0xDC00 {
+			// The last code unit is the first half of a surrogate pair.
+			n -= 2
+		}
+	}
+	return n
+}
+
+// encoding returns the encoding of the file, nil for UTF-8.
+func (f *LogFile) encoding() *textEncoding {
+	if f.detected != nil {
+		return f.detected
+	}
+	enc, _ := lookupEncoding(f.Encoding)
+	return enc
+}
+
+// skipBOM skips the byte order mark at the start of the file. Without an
+// encoding configured, a UTF-16 byte order mark switches the file to UTF-16.
+func (f *LogFile) skipBOM(buf []byte) []byte {
+	if f.offset.Load() != 0 {
+		f.detectBOM()
+		return buf
+	}
+	bom := utf8BOM
+	if enc := f.encoding(); enc != nil {
+		bom = enc.bom
+	} else if f.Encoding == "" {
+		for _, enc := range []*textEncoding{utf16LE, utf16BE} {
+			if bytes.HasPrefix(buf, enc.bom) {
+				f.detected, bom = enc, enc.bom
+			}
+		}
+	}
+	if len(bom) == 0 || !bytes.HasPrefix(buf, bom) {
+		return buf
+	}
+	f.offset.Add(int64(len(bom)))
+	return buf[len(bom):]
+}
+
+// detectBOM looks for a UTF-16 byte order mark at the start of a file
+// opened at a persisted offset, which has skipped it already.
+func (f *LogFile) detectBOM() {
+	if f.Encoding != "" || f.detected != nil || f.bomChecked || isCompressed(f.Filename) {
+		return
+	}
+	f.bomChecked = true
+	head := make([]byte, 2)
+	if n, _ := f.file.ReadAt(head, 0); n < len(head) {
+		return
+	}
+	for _, enc := range []*textEncoding{utf16LE, utf16BE} {
+		if bytes.Equal(head, enc.bom) {
+			f.detected = enc
+		}
+	}
+}
+
+// decodeLines is the part of readToEnd for files in another encoding than
+// UTF-8. It transcodes the complete lines at the start of buf and holds back
+// the rest. A line longer than the max line length even in the encoding is
+// cut off, without waiting for its newline.
+func (f *LogFile) decodeLines(buf []byte, enc *textEncoding) ([]byte, error) {
+	consumed := 0
+	if f.discardingRaw {
+		end := enc.firstLineEnd(buf)
+		if end < 0 {
+			f.partial = nil
+			f.offset.Add(int64(len(buf)))
+			return nil, nil
+		}
+		consumed = end
+		f.discardingRaw = false
+	}
+
+	rest := buf[consumed:]
+	end := enc.lastLineEnd(rest)
+	// A line of more than UTFMax bytes per allowed character is too long in
+	// any encoding.
+	cut := false
+	if max := f.MaxLineLength; max > 0 && len(rest)-end > utf8.UTFMax*max {
+		end += enc.cut(rest[end:], utf8.UTFMax*max)
+		cut = true
+	}
+	decoded, err := enc.encoding.NewDecoder().Bytes(rest[:end])
+	if err != nil {
+		return nil, err
+	}
+	if cut {
+		decoded = append(decoded, '\n')
+		f.discardingRaw = !f.SplitLongLines
+	}
+
+	lines, _, long := f.splitter.lines(decoded)
+	f.partial = append([]byte(nil), rest[end:]...)
+	f.offset.Add(int64(consumed + end))
+	reportLongLines(f.Filename, long, f.MaxLineLength)
+	return lines, nil
+}
+
+// decodeStream transcodes a stream in the named encoding to UTF-8. A byte
+// order mark at the start of the stream is skipped, and switches the
+// encoding to UTF-16 if it is one.
+func decodeStream(in io.Reader, name string) io.Reader {
+	var fallback transform.Transformer = transform.Nop
+	if enc, _ := lookupEncoding(name); enc != nil {
+		fallback = enc.encoding.NewDecoder()
+	}
+	return transform.NewReader(in, unicode.BOMOverride(fallback))
+}
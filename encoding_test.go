@@ -0,0 +1,114 @@
+package sest
+
+import (
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// encode encodes s in enc.
+func encode(t *testing.T, enc encoding.Encoding, s string) string {
+	t.Helper()
+	encoded, err := enc.NewEncoder().String(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return encoded
+}
+
+func TestLogFileEncodings(t *testing.T) {
+	le := unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)
+	be := unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)
+	tests := []struct {
+		name     string
+		encoding string
+		// writes are appended to the file one by one, each followed by a
+		// read returning reads at the same index.
+		writes []string
+		reads  []string
+	}{
+		{name: "utf-8 bom", writes: []string{"\xEF\xBB\xBFa\nb\n"}, reads: []string{"a\nb\n"}},
+		{name: "utf-8 bom in two writes", writes: []string{"\xEF\xBB\xBFa", "\n"}, reads: []string{"", "a\n"}},
+		{name: "utf-8 bom after the start", writes: []string{"a\n", "\xEF\xBB\xBFb\n"}, reads: []string{"a\n", "\xEF\xBB\xBFb\n"}},
+		{name: "utf-16le detected", writes: []string{"\xFF\xFE" + encode(t, le, "grüße\r\nb\n")}, reads: []string{"grüße\nb\n"}},
+		{name: "utf-16be detected", writes: []string{"\xFE\xFF" + encode(t, be, "grüße\nb\n")}, reads: []string{"grüße\nb\n"}},
+		{name: "utf-16le configured", encoding: "UTF-16LE", writes: []string{encode(t, le, "a\nb\n")}, reads: []string{"a\nb\n"}},
+		{name: "utf-16le configured with bom", encoding: "utf-16le", writes: []string{"\xFF\xFE" + encode(t, le, "a\n")}, reads: []string{"a\n"}},
+		{
+			name:     "utf-16le code unit in two writes",
+			encoding: "utf-16le",
+			writes:   []string{encode(t, le, "ab")[:3], encode(t, le, "ab\n")[3:]},
+			reads:    []string{"", "ab\n"},
+		},
+		{
+			name:     "utf-16le newline in two writes",
+			encoding: "utf-16le",
+			writes:   []string{encode(t, le, "a\n")[:3], encode(t, le, "a\nb\n")[3:]},
+			reads:    []string{"", "a\nb\n"},
+		},
+		// A newline byte within a code unit does not end a line.
+		{name: "utf-16le newline byte in a character", encoding: "utf-16le", writes: []string{encode(t, le, "ਊ\n")}, reads: []string{"ਊ\n"}},
+		{name: "utf-16 surrogate pair", encoding: "utf-16be", writes: []string{encode(t, be, "🔥 fire\n")}, reads: []string{"🔥 fire\n"}},
+		{name: "latin1", encoding: "latin1", writes: []string{encode(t, charmap.ISO8859_1, "grüße\n")}, reads: []string{"grüße\n"}},
+		{name: "windows-1252", encoding: "windows-1252", writes: []string{encode(t, charmap.Windows1252, "5 €\r\n")}, reads: []string{"5 €\n"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "app.log")
+			appendFile(t, filename, "")
+			f, err := NewLogFile(filename, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			f.Encoding = tt.encoding
+			var size int64
+			for i, write := range tt.writes {
+				appendFile(t, filename, write)
+				readNewLines(t, f, tt.reads[i])
+				size += int64(len(write))
+			}
+			// Offsets count the bytes of the file, not of the UTF-8 lines.
+			if offset := f.GetOffset(); offset != size {
+				t.Errorf("offset %d, want the size %d", offset, size)
+			}
+		})
+	}
+}
+
+// TestLogFileEncodingResumed checks that a UTF-16 file resumed at a persisted
+// offset, past its byte order mark, is still detected as UTF-16.
+func TestLogFileEncodingResumed(t *testing.T) {
+	le := unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)
+	filename := filepath.Join(t.TempDir(), "app.log")
+	first := "\xFF\xFE" + encode(t, le, "a\n")
+	appendFile(t, filename, first+encode(t, le, "b\n"))
+	f, err := NewLogFile(filename, int64(len(first)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	readNewLines(t, f, "b\n")
+}
+
+func TestLookupEncoding(t *testing.T) {
+	tests := []struct {
+		name string
+		want *textEncoding
+		ok   bool
+	}{
+		{name: "", ok: true},
+		{name: "UTF-8", ok: true},
+		{name: "utf-16LE", want: utf16LE, ok: true},
+		{name: "utf-16be", want: utf16BE, ok: true},
+		{name: "ebcdic"},
+	}
+	for _, tt := range tests {
+		if got, ok := lookupEncoding(tt.name); got != tt.want || ok != tt.ok {
+			t.Errorf("lookupEncoding(%q) = %v, %v, want %v, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+
+package sest
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileID returns the device and inode number identifying a file.
+func fileID(fi os.FileInfo) (device, inode uint64, ok bool) {
+	stat, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return uint64(stat.Dev), uint64(stat.Ino), true
+}
@@ -0,0 +1,11 @@
+//go:build windows
+
+package sest
+
+import "os"
+
+// fileID is not supported on Windows, where os.FileInfo does not expose a
+// file index.
+func fileID(fi os.FileInfo) (device, inode uint64, ok bool) {
+	return 0, 0, false
+}
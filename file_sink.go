@@ -0,0 +1,84 @@
+package sest
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// fileSink appends rendered events to a file.
+type fileSink struct {
+	mu       sync.Mutex
+	Filename string
+	file     *os.File
+}
+
+func newFileSink(filename string) *fileSink {
+	return &fileSink{Filename: filename}
+}
+
+// Deliver appends the event body followed by a newline and syncs the file to
+// disk. The file is (re)opened whenever the path no longer refers to the open
+// file, e.g. after it was rotated away.
+func (o *fileSink) Deliver(ctx context.Context, e RenderedEvent) error {
+	return o.writeLine(e.Body)
+}
+
+// writeLine appends b followed by a newline and syncs the file to disk.
+func (o *fileSink) writeLine(b []byte) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if err := o.reopenIfRotated(); err != nil {
+		return err
+	}
+
+	line := make([]byte, 0, len(b)+1)
+	line = append(line, b...)
+	line = append(line, '\n')
+	if _, err := o.file.Write(line); err != nil {
+		return err
+	}
+	return o.file.Sync()
+}
+
+func (o *fileSink) reopenIfRotated() error {
+	if o.file != nil {
+		current, err := o.file.Stat()
+		if err != nil {
+			return err
+		}
+		onDisk, err := os.Stat(o.Filename)
+		if err == nil && os.SameFile(current, onDisk) {
+			return nil
+		}
+		o.file.Close()
+		o.file = nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(o.Filename), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(o.Filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	o.file = f
+	return nil
+}
+
+func (o *fileSink) Close() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.file == nil {
+		return nil
+	}
+	err := o.file.Close()
+	o.file = nil
+	return err
+}
+
+func (o *fileSink) String() string {
+	return "file " + o.Filename
+}
@@ -0,0 +1,53 @@
+package sest
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// Defaults of the HTTP config.
+const (
+	defaultHTTPTimeout             = 10 * time.Second
+	defaultHTTPMaxIdleConns        = 100
+	defaultHTTPMaxIdleConnsPerHost = 10
+	defaultHTTPIdleConnTimeout     = 90 * time.Second
+)
+
+// newHTTPClient returns the client shared by the HTTP based sinks of a
+// config. Its transport keeps connections alive, so events posted to the same
+// host reuse them instead of connecting, and handshaking, for every event.
+// tlsConfig, if not nil, configures the TLS connections.
+func newHTTPClient(cfg Config, tlsConfig *tls.Config) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = defaultHTTPMaxIdleConns
+	if cfg.HTTP.MaxIdleConns > 0 {
+		transport.MaxIdleConns = cfg.HTTP.MaxIdleConns
+	}
+	transport.MaxIdleConnsPerHost = defaultHTTPMaxIdleConnsPerHost
+	if cfg.HTTP.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = cfg.HTTP.MaxIdleConnsPerHost
+	}
+	transport.IdleConnTimeout = defaultHTTPIdleConnTimeout
+	if cfg.HTTP.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = cfg.HTTP.IdleConnTimeout
+	}
+
+	transport.TLSClientConfig = tlsConfig
+
+	client := &http.Client{Transport: transport, Timeout: defaultHTTPTimeout}
+	if cfg.HTTP.Timeout > 0 {
+		client.Timeout = cfg.HTTP.Timeout
+	}
+	return client
+}
+
+// validateHTTP checks the HTTP config.
+func (cfg *Config) validateHTTP() error {
+	h := cfg.HTTP
+	if h.Timeout < 0 || h.IdleConnTimeout < 0 || h.MaxIdleConns < 0 || h.MaxIdleConnsPerHost < 0 {
+		return errors.New("http timeouts and idle connections must not be negative")
+	}
+	return nil
+}
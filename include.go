@@ -0,0 +1,157 @@
+package sest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// configFragment is the part of the config a fragment may set.
+type configFragment struct {
+	Input struct {
+		Files       []string
+		Directories []string
+	}
+	Events map[string]EventConfig
+}
+
+// decodeConfigFile decodes a YAML config file, or a JSON one if its name ends
+// in .json, into v. Keys v has no field for and keys given twice in a mapping
+// are errors, so that a misspelled or repeated key is not silently ignored.
+func decodeConfigFile(filename string, v interface{}) error {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	if strings.EqualFold(filepath.Ext(filename), ".json") {
+		// JSON is valid YAML, so it is decoded like YAML once it is known
+		// to be JSON, which keeps durations and the other YAML decoding.
+		var doc interface{}
+		if err := json.Unmarshal(content, &doc); err != nil {
+			return fmt.Errorf("invalid JSON: %w", err)
+		}
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return err
+	}
+	if err := duplicateKey(&doc); err != nil {
+		return err
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(v); err != nil && err != io.EOF {
+		return explainUnknownKeys(err, v)
+	}
+	return nil
+}
+
+// duplicateKey reports the first key given twice in a mapping of node or of
+// the nodes below it.
+func duplicateKey(node *yaml.Node) error {
+	if node.Kind == yaml.MappingNode {
+		lines := make(map[string]int, len(node.Content)/2)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i]
+			// Merge keys may be repeated, and other keys than scalars
+			// are left to the decoder.
+			if key.Kind != yaml.ScalarNode || key.Tag == "!!merge" {
+				continue
+			}
+			if line, ok := lines[key.Value]; ok {
+				return fmt.Errorf("line %d: key %q already defined at line %d", key.Line, key.Value, line)
+			}
+			lines[key.Value] = key.Line
+		}
+	}
+	for _, child := range node.Content {
+		if err := duplicateKey(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// include merges the fragments matching the Include patterns into the config
+// loaded from configFile, in the order of their paths. Events defined more
+// than once are reported together.
+func (c *Config) include(configFile string) error {
+	configDir := filepath.Dir(configFile)
+	var fragments []string
+	for _, pattern := range c.Include {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(configDir, pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return fmt.Errorf("include %s: %w", pattern, err)
+		}
+		fragments = append(fragments, matches...)
+	}
+	sort.Strings(fragments)
+
+	definedIn := make(map[string]string, len(c.Events))
+	for key := range c.Events {
+		definedIn[key] = configFile
+	}
+	var errs []error
+	loaded := make(map[string]bool, len(fragments))
+	for _, fragment := range fragments {
+		// Overlapping patterns may match a fragment, or the config file
+		// itself, more than once.
+		if loaded[fragment] || samePath(fragment, configFile) {
+			continue
+		}
+		loaded[fragment] = true
+		f, err := loadFragment(fragment)
+		if err != nil {
+			return fmt.Errorf("config fragment %s: %w", fragment, err)
+		}
+		c.Input.Stdin = c.Input.Stdin || f.Input.Stdin
+		c.Input.Files = append(c.Input.Files, f.Input.Files...)
+		c.Input.Directories = append(c.Input.Directories, f.Input.Directories...)
+		if c.Events == nil && len(f.Events) > 0 {
+			c.Events = make(map[string]EventConfig, len(f.Events))
+		}
+		for _, key := range sortedKeys(f.Events) {
+			if other, ok := definedIn[key]; ok {
+				errs = append(errs, fmt.Errorf("event %s is defined in both %s and %s", key, other, fragment))
+				continue
+			}
+			definedIn[key] = fragment
+			c.Events[key] = f.Events[key]
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// loadFragment loads a config fragment, resolving its relative paths against
+// its own directory.
+func loadFragment(filename string) (Config, error) {
+	var f configFragment
+	if err := decodeConfigFile(filename, &f); err != nil {
+		return Config{}, err
+	}
+	var c Config
+	c.Input.Files = f.Input.Files
+	c.Input.Directories = f.Input.Directories
+	c.Events = f.Events
+	c.extractStdin()
+	c.ResolveRelativePaths(filepath.Dir(filename))
+	return c, nil
+}
+
+func samePath(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
@@ -0,0 +1,290 @@
+package sest
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/radovskyb/watcher"
+)
+
+func createWatcher(cfg Config, filter *inputFilter) *watcher.Watcher {
+	w := watcher.New()
+
+	w.FilterOps(watcher.Write, watcher.Create, watcher.Remove, watcher.Rename, watcher.Move)
+	w.AddFilterHook(filter.hook)
+
+	for _, p := range watchedPaths(cfg) {
+		addWatchedPath(w, p)
+	}
+
+	return w
+}
+
+type watchedPath struct {
+	Name      string
+	Recursive bool
+}
+
+// watchedPaths returns the paths to add to the watcher, each of them once.
+// Without a depth limit recursive directories are left to the watcher, which
+// also picks up subdirectories created later on. With a limit every directory
+// down to the limit is watched on its own. Files in a watched directory are
+// not watched on their own as well.
+func watchedPaths(cfg Config) []watchedPath {
+	var dirs []watchedPath
+	for _, directory := range cfg.Input.Directories {
+		if cfg.Input.Recursive && cfg.Input.MaxDepth <= 0 {
+			dirs = append(dirs, watchedPath{Name: filepath.Clean(directory), Recursive: true})
+			continue
+		}
+		subdirs, err := getDirsFromDir(directory, inputDepth(cfg))
+		if err != nil {
+			slog.Warn("Could not list directory", "directory", directory, "err", err)
+			continue
+		}
+		for _, dir := range subdirs {
+			dirs = append(dirs, watchedPath{Name: filepath.Clean(dir)})
+		}
+	}
+
+	paths := make([]watchedPath, 0, len(cfg.Input.Files)+len(dirs))
+	seen := make(map[string]bool, cap(paths))
+	for _, dir := range dirs {
+		if !seen[dir.Name] {
+			seen[dir.Name] = true
+			paths = append(paths, dir)
+		}
+	}
+	for _, filename := range cfg.Input.Files {
+		filename = filepath.Clean(filename)
+		if seen[filename] || inWatchedDir(filename, dirs) {
+			continue
+		}
+		seen[filename] = true
+		paths = append(paths, watchedPath{Name: filename})
+	}
+	return paths
+}
+
+// inWatchedDir reports whether the watcher sees filename as part of one of
+// the watched directories.
+func inWatchedDir(filename string, dirs []watchedPath) bool {
+	for _, dir := range dirs {
+		if filepath.Dir(filename) == dir.Name {
+			return true
+		}
+		if dir.Recursive && strings.HasPrefix(filename, dir.Name+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+func addWatchedPath(w *watcher.Watcher, p watchedPath) error {
+	var err error
+	if p.Recursive {
+		err = w.AddRecursive(p.Name)
+	} else {
+		err = w.Add(p.Name)
+	}
+	if err != nil {
+		slog.Warn("Could not watch path", "path", p.Name, "err", err)
+	}
+	return err
+}
+
+// inputDepth returns how many directory levels are listed for each input
+// directory, zero meaning unlimited.
+func inputDepth(cfg Config) int {
+	if !cfg.Input.Recursive {
+		return 1
+	}
+	if cfg.Input.MaxDepth <= 0 {
+		return 0
+	}
+	return cfg.Input.MaxDepth + 1
+}
+
+func createLogFileList(cfg Config, offsets *offsetStore) map[string]*LogFile {
+	logFiles := make(map[string]*LogFile)
+
+	for _, filename := range inputFilenames(cfg) {
+		logFile, err := openLogFile(filename, offsets, cfg.Input.StartAt == "end")
+		if err != nil {
+			slog.Warn("Could not watch file", "file", filename, "err", err)
+			continue
+		}
+		// In lazy open mode files are opened by their first read.
+		if cfg.Input.LazyOpen {
+			logFile.Suspend()
+		}
+		logFiles[filename] = logFile
+	}
+
+	return logFiles
+}
+
+// openLogFile opens a file at its persisted offset. Without one it starts at
+// the end of the file if atEnd is set, and at the beginning otherwise.
+func openLogFile(filename string, offsets *offsetStore, atEnd bool) (*LogFile, error) {
+	if offsets != nil {
+		if offset, ok := offsets.Offset(filename); ok {
+			return NewLogFile(filename, offset)
+		}
+	}
+	if atEnd {
+		return NewLogFile(filename, OffsetEnd)
+	}
+	return NewLogFile(filename, 0)
+}
+
+// inputFilenames lists the configured files and the files in the configured
+// directories that pass the input filter, each of them once.
+func inputFilenames(cfg Config) []string {
+	filenames := make([]string, len(cfg.Input.Files))
+	copy(filenames, cfg.Input.Files)
+
+	for _, path := range cfg.Input.Directories {
+		files, err := getFilesFromDir(path, inputDepth(cfg))
+		if err != nil {
+			continue
+		}
+		filenames = append(filenames, files...)
+	}
+
+	nameFilter, err := newFileFilter(cfg)
+	if err != nil {
+		slog.Error("Invalid input filter", "err", err)
+	}
+	return filter(unique(filenames), nameFilter.accepts)
+}
+
+// unique removes repeated filenames, e.g. files listed explicitly that are
+// also found in a watched directory, warning about them. Reading them twice
+// would match every line twice.
+func unique(filenames []string) []string {
+	seen := make(map[string]bool, len(filenames))
+	var result []string
+	for _, filename := range filenames {
+		filename = filepath.Clean(filename)
+		if seen[filename] {
+			slog.Warn("File is part of the input more than once, reading it once", "file", filename)
+			continue
+		}
+		seen[filename] = true
+		result = append(result, filename)
+	}
+	return result
+}
+
+// fileFilter selects input files by their path: a file is read if it matches
+// the include filter, if any, and does not match the exclude filter. The zero
+// value accepts every file.
+type fileFilter struct {
+	include *regexp.Regexp
+	exclude *regexp.Regexp
+}
+
+// newFileFilter compiles the input filters of cfg. If a filter does not
+// compile, it is left out of the returned filter.
+func newFileFilter(cfg Config) (fileFilter, error) {
+	var f fileFilter
+	var errs []error
+	if cfg.Input.Filter != "" {
+		re, err := regexp.Compile(cfg.Input.Filter)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("could not compile input filter %s: %w", cfg.Input.Filter, err))
+		}
+		f.include = re
+	}
+	if cfg.Input.Exclude != "" {
+		re, err := regexp.Compile(cfg.Input.Exclude)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("could not compile input exclude %s: %w", cfg.Input.Exclude, err))
+		}
+		f.exclude = re
+	}
+	return f, errors.Join(errs...)
+}
+
+func (f fileFilter) accepts(filename string) bool {
+	if f.include != nil && !f.include.MatchString(filename) {
+		return false
+	}
+	return f.exclude == nil || !f.exclude.MatchString(filename)
+}
+
+// getFilesFromDir lists the files in dirPath and its subdirectories, down to
+// depth levels (the directory itself being level one). A depth of zero or less
+// lists the whole tree.
+func getFilesFromDir(dirPath string, depth int) ([]string, error) {
+	entries, err := ioutil.ReadDir(dirPath)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{}
+
+	for _, entry := range entries {
+		entryPath := filepath.Join(dirPath, entry.Name())
+		if !entry.IsDir() {
+			files = append(files, entryPath)
+			continue
+		}
+		if depth == 1 {
+			continue
+		}
+		subFiles, err := getFilesFromDir(entryPath, depth-1)
+		if err != nil {
+			slog.Warn("Could not list directory", "directory", entryPath, "err", err)
+			continue
+		}
+		files = append(files, subFiles...)
+	}
+
+	return files, nil
+}
+
+// getDirsFromDir returns dirPath and its subdirectories down to depth levels,
+// following the same rules as getFilesFromDir.
+func getDirsFromDir(dirPath string, depth int) ([]string, error) {
+	dirs := []string{dirPath}
+	if depth == 1 {
+		return dirs, nil
+	}
+
+	entries, err := ioutil.ReadDir(dirPath)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		entryPath := filepath.Join(dirPath, entry.Name())
+		subDirs, err := getDirsFromDir(entryPath, depth-1)
+		if err != nil {
+			slog.Warn("Could not list directory", "directory", entryPath, "err", err)
+			continue
+		}
+		dirs = append(dirs, subDirs...)
+	}
+
+	return dirs, nil
+}
+
+func filter(vs []string, f func(string) bool) []string {
+	vsf := make([]string, 0)
+	for _, v := range vs {
+		if f(v) {
+			vsf = append(vsf, v)
+		}
+	}
+	return vsf
+}
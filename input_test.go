@@ -0,0 +1,230 @@
+package sest
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestInputFilenamesFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  string
+		exclude string
+		want    []string
+	}{
+		{name: "no filters", want: []string{"app.log", "app.log.1.gz", "app.tmp", "db.log"}},
+		{name: "include", filter: `\.log$`, want: []string{"app.log", "db.log"}},
+		{name: "exclude", exclude: `\.(gz|tmp)$`, want: []string{"app.log", "db.log"}},
+		// Excluded files are dropped even if they match the include filter.
+		{name: "include and exclude", filter: `app`, exclude: `\.(gz|tmp)$`, want: []string{"app.log"}},
+		{name: "exclude everything", filter: `\.log$`, exclude: `.`, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, name := range []string{"app.log", "app.log.1.gz", "app.tmp", "db.log"} {
+				appendFile(t, filepath.Join(dir, name), "")
+			}
+			var cfg Config
+			cfg.Input.Directories = []string{dir}
+			cfg.Input.Filter = tt.filter
+			cfg.Input.Exclude = tt.exclude
+
+			var got []string
+			for _, filename := range inputFilenames(cfg) {
+				got = append(got, filepath.Base(filename))
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("inputFilenames() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRunnerExcludesCreatedFiles checks that the exclude filter also applies
+// to files created in a watched directory while running.
+func TestRunnerExcludesCreatedFiles(t *testing.T) {
+	dir := t.TempDir()
+	logs := filepath.Join(dir, "logs")
+	if err := os.Mkdir(logs, 0755); err != nil {
+		t.Fatal(err)
+	}
+	cfg := loadTestConfig(t, dir, `
+input:
+  directories: [logs]
+  filter: 'app'
+  exclude: '\.tmp$'
+poll_interval: 10ms
+events:
+  line:
+    src: 'line (\w+)'
+    template: '{{.group1}}'
+`)
+	ctx, cancel := context.WithCancel(context.Background())
+	events, done := startRunner(t, ctx, cfg)
+	defer func() {
+		cancel()
+		<-done
+	}()
+	// The files are created after the directory is watched.
+	time.Sleep(50 * time.Millisecond)
+	appendFile(t, filepath.Join(logs, "app.tmp"), "line excluded\n")
+	appendFile(t, filepath.Join(logs, "app.log"), "")
+	time.Sleep(50 * time.Millisecond)
+	appendFile(t, filepath.Join(logs, "app.log"), "line included\n")
+	if e := nextEvent(t, events); string(e.Body) != "included" {
+		t.Errorf("got event %q, want only the one of app.log", e.Body)
+	}
+}
+
+func TestInputFilenamesOverlap(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"app.log", "db.log"} {
+		appendFile(t, filepath.Join(dir, name), "")
+	}
+	tests := []struct {
+		name        string
+		files       []string
+		directories []string
+		want        []string
+	}{
+		{name: "file in a directory", files: []string{"app.log"}, directories: []string{"."}, want: []string{"app.log", "db.log"}},
+		{name: "file listed twice", files: []string{"app.log", "app.log"}, want: []string{"app.log"}},
+		{name: "unclean path", files: []string{"./logs/../app.log"}, directories: []string{"."}, want: []string{"app.log", "db.log"}},
+		{name: "directory listed twice", directories: []string{".", "./"}, want: []string{"app.log", "db.log"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg Config
+			for _, name := range tt.files {
+				cfg.Input.Files = append(cfg.Input.Files, dir+string(filepath.Separator)+name)
+			}
+			for _, name := range tt.directories {
+				cfg.Input.Directories = append(cfg.Input.Directories, dir+string(filepath.Separator)+name)
+			}
+			var got []string
+			for _, filename := range inputFilenames(cfg) {
+				rel, err := filepath.Rel(dir, filename)
+				if err != nil || filename != filepath.Join(dir, rel) {
+					t.Errorf("got %s, want a clean path in %s", filename, dir)
+				}
+				got = append(got, rel)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("inputFilenames() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWatchedPaths(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "logs", "nested"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name        string
+		files       []string
+		directories []string
+		recursive   bool
+		maxDepth    int
+		want        []watchedPath
+	}{
+		{
+			name:  "files",
+			files: []string{"app.log", "logs/app.log"},
+			want:  []watchedPath{{Name: "app.log"}, {Name: "logs/app.log"}},
+		},
+		{
+			name:        "file in a watched directory",
+			files:       []string{"logs/app.log", "app.log"},
+			directories: []string{"logs"},
+			want:        []watchedPath{{Name: "logs"}, {Name: "app.log"}},
+		},
+		{
+			name:        "file below a watched directory",
+			files:       []string{"logs/nested/app.log"},
+			directories: []string{"logs"},
+			want:        []watchedPath{{Name: "logs"}, {Name: "logs/nested/app.log"}},
+		},
+		{
+			name:        "file below a recursive directory",
+			files:       []string{"logs/nested/app.log"},
+			directories: []string{"logs"},
+			recursive:   true,
+			want:        []watchedPath{{Name: "logs", Recursive: true}},
+		},
+		{
+			name:        "file below a directory within the max depth",
+			files:       []string{"logs/nested/app.log"},
+			directories: []string{"logs"},
+			recursive:   true,
+			maxDepth:    1,
+			want:        []watchedPath{{Name: "logs"}, {Name: "logs/nested"}},
+		},
+		{
+			name:        "directories listed twice",
+			directories: []string{"logs", "logs/", "logs/nested"},
+			recursive:   true,
+			maxDepth:    1,
+			want:        []watchedPath{{Name: "logs"}, {Name: "logs/nested"}},
+		},
+		{
+			name:  "file listed twice",
+			files: []string{"app.log", "./app.log"},
+			want:  []watchedPath{{Name: "app.log"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg Config
+			for _, name := range tt.files {
+				cfg.Input.Files = append(cfg.Input.Files, dir+string(filepath.Separator)+filepath.FromSlash(name))
+			}
+			for _, name := range tt.directories {
+				cfg.Input.Directories = append(cfg.Input.Directories, dir+string(filepath.Separator)+filepath.FromSlash(name))
+			}
+			cfg.Input.Recursive = tt.recursive
+			cfg.Input.MaxDepth = tt.maxDepth
+			want := make([]watchedPath, len(tt.want))
+			for i, p := range tt.want {
+				want[i] = watchedPath{Name: filepath.Join(dir, filepath.FromSlash(p.Name)), Recursive: p.Recursive}
+			}
+			if got := watchedPaths(cfg); !reflect.DeepEqual(got, want) {
+				t.Errorf("watchedPaths() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+// TestRunnerOverlappingInput checks that lines of a file that is both listed
+// and in a watched directory are matched once.
+func TestRunnerOverlappingInput(t *testing.T) {
+	logFile, events := runTestConfig(t, `
+input:
+  files: [app.log]
+  directories: [.]
+  filter: '\.log$'
+poll_interval: 10ms
+events:
+  line:
+    src: 'line (\w+)'
+    template: '{{.group1}}'
+`)
+	appendFile(t, logFile, "line one\n")
+	if e := nextEvent(t, events); string(e.Body) != "one" {
+		t.Errorf("got event %q, want one", e.Body)
+	}
+	select {
+	case e := <-events:
+		t.Errorf("got event %q again", e.Body)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
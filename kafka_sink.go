@@ -0,0 +1,100 @@
+package sest
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// defaultKafkaBatchTimeout is how long the producer waits for more messages
+// to send with a message, if the config sets no batch_timeout. Deliveries
+// wait for their batch, so it is kept short; concurrent deliveries from
+// several dispatch workers share batches.
+const defaultKafkaBatchTimeout = 10 * time.Millisecond
+
+var kafkaAcks = map[string]kafka.RequiredAcks{
+	"":       kafka.RequireAll,
+	"all":    kafka.RequireAll,
+	"leader": kafka.RequireOne,
+	"none":   kafka.RequireNone,
+}
+
+// newKafkaWriter creates the producer shared by the Kafka sinks of a config,
+// connecting with TLS if tlsConfig is not nil.
+func newKafkaWriter(cfg Config, tlsConfig *tls.Config) *kafka.Writer {
+	timeout := cfg.Kafka.BatchTimeout
+	if timeout <= 0 {
+		timeout = defaultKafkaBatchTimeout
+	}
+	w := &kafka.Writer{
+		Addr:         kafka.TCP(cfg.Kafka.Brokers...),
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafkaAcks[strings.ToLower(cfg.Kafka.Acks)],
+		BatchSize:    cfg.Kafka.BatchSize,
+		BatchTimeout: timeout,
+	}
+	if tlsConfig != nil {
+		w.Transport = &kafka.Transport{TLS: tlsConfig}
+	}
+	return w
+}
+
+// kafkaSink produces rendered events to a Kafka topic. Messages are keyed
+// by a capture group, if configured, so that events with the same key end up
+// in the same partition; others are spread across the partitions. The event
+// type and channel name are passed in headers.
+type kafkaSink struct {
+	writer *kafka.Writer
+	topic  string
+	// key is the name or number of the capture group used as the message
+	// key, empty for none.
+	key string
+}
+
+func (s *kafkaSink) Deliver(ctx context.Context, e RenderedEvent) error {
+	return s.writer.WriteMessages(ctx, s.message(e))
+}
+
+// message builds the message of a rendered event.
+func (s *kafkaSink) message(e RenderedEvent) kafka.Message {
+	msg := kafka.Message{
+		Topic: s.topic,
+		Value: e.Body,
+		Headers: []kafka.Header{
+			{Key: "event_type", Value: []byte(e.EventType)},
+			{Key: "channel_name", Value: []byte(e.ChannelName)},
+		},
+	}
+	if s.key != "" {
+		if key, ok := messageKey(s.key, e); ok {
+			msg.Key = []byte(key)
+		}
+	}
+	return msg
+}
+
+// messageKey looks up a capture group by name or number.
+func messageKey(group string, e RenderedEvent) (string, bool) {
+	if value, ok := e.Fields[group]; ok {
+		return value, true
+	}
+	if i, err := strconv.Atoi(group); err == nil && i >= 0 && i < len(e.Groups) {
+		return e.Groups[i], true
+	}
+	return "", false
+}
+
+// Close flushes the messages of the shared producer. Closing it repeatedly,
+// once per event using it, is harmless.
+func (s *kafkaSink) Close() error {
+	return s.writer.Close()
+}
+
+func (s *kafkaSink) String() string {
+	return fmt.Sprintf("kafka %s", s.topic)
+}
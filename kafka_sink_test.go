@@ -0,0 +1,44 @@
+package sest
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestKafkaMessage(t *testing.T) {
+	e := RenderedEvent{
+		EventType:   "LoginFailed",
+		ChannelName: "logins",
+		Groups:      []string{"login of alice failed", "alice"},
+		Fields:      map[string]string{"user": "alice"},
+		Body:        []byte("body"),
+	}
+	tests := []struct {
+		name string
+		key  string
+		want []byte
+	}{
+		{name: "no key"},
+		{name: "named group", key: "user", want: []byte("alice")},
+		{name: "numbered group", key: "1", want: []byte("alice")},
+		{name: "missing group", key: "host"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &kafkaSink{topic: "events", key: tt.key}
+			msg := s.message(e)
+			if msg.Topic != "events" || string(msg.Value) != "body" || !reflect.DeepEqual(msg.Key, tt.want) {
+				t.Errorf("message() = %+v, want body to events with key %q", msg, tt.want)
+			}
+			headers := []kafka.Header{
+				{Key: "event_type", Value: []byte("LoginFailed")},
+				{Key: "channel_name", Value: []byte("logins")},
+			}
+			if !reflect.DeepEqual(msg.Headers, headers) {
+				t.Errorf("message() has headers %v, want %v", msg.Headers, headers)
+			}
+		})
+	}
+}
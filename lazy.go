@@ -0,0 +1,64 @@
+package sest
+
+import (
+	"log/slog"
+	"sort"
+	"time"
+)
+
+const (
+	// defaultIdleTimeout is how long a file is kept open without being read
+	// in lazy open mode, if the config sets no idle timeout.
+	defaultIdleTimeout = time.Minute
+	// idleCheckInterval is how often idle files are looked for.
+	idleCheckInterval = time.Second
+)
+
+func (r *Runner) idleTimeout() time.Duration {
+	if r.cfg.Input.IdleTimeout <= 0 {
+		return defaultIdleTimeout
+	}
+	return r.cfg.Input.IdleTimeout
+}
+
+// suspendIdleFiles closes the files that have not been read for the idle
+// timeout in lazy open mode. They are reopened by their next write.
+func (r *Runner) suspendIdleFiles() {
+	if !r.cfg.Input.LazyOpen {
+		return
+	}
+	deadline := time.Now().Add(-r.idleTimeout())
+	for _, file := range r.files {
+		if !r.isReading(file) && file.IsOpen() && !file.IsPipe() && file.lastUsed.Before(deadline) {
+			slog.Debug("Closing idle file", "file", file.Filename)
+			file.Suspend()
+		}
+	}
+}
+
+// limitOpenFiles closes the least recently read files while more than
+// MaxOpenFiles are open in lazy open mode. Named pipes are not counted, as
+// they cannot be closed without losing lines, and neither are the files being
+// read at the moment, which are closed once they are read if need be.
+func (r *Runner) limitOpenFiles() {
+	max := r.cfg.Input.MaxOpenFiles
+	if !r.cfg.Input.LazyOpen || max <= 0 {
+		return
+	}
+	var open []*LogFile
+	for _, file := range r.files {
+		if !r.isReading(file) && file.IsOpen() && !file.IsPipe() {
+			open = append(open, file)
+		}
+	}
+	if len(open) <= max {
+		return
+	}
+	sort.Slice(open, func(i, j int) bool {
+		return open[i].lastUsed.Before(open[j].lastUsed)
+	})
+	for _, file := range open[:len(open)-max] {
+		slog.Debug("Closing least recently read file", "file", file.Filename)
+		file.Suspend()
+	}
+}
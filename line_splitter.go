@@ -0,0 +1,102 @@
+package sest
+
+import (
+	"bytes"
+	"log/slog"
+)
+
+// truncationMarker is appended to lines truncated to the max line length.
+const truncationMarker = " [truncated]"
+
+// lineSplitter splits the bytes read from an input into complete lines,
+// guarding against lines of unbounded length, which would otherwise be
+// buffered until their newline shows up.
+type lineSplitter struct {
+	// max is the maximum length of a line, 0 for no limit. Longer lines are
+	// split into pieces of max bytes if split is set, and truncated
+	// otherwise.
+	max   int
+	split bool
+	// discarding is set while the rest of a truncated line is skipped.
+	discarding bool
+}
+
+// reportLongLines counts the lines of a file that exceeded the max line
+// length, warning about them.
+func reportLongLines(filename string, count, max int) {
+	if count == 0 {
+		return
+	}
+	longLines.WithLabelValues(filename).Add(float64(count))
+	slog.Warn("Lines exceed the max line length", "file", filename, "count", count, "max_line_length", max)
+}
+
+func newLineSplitter(cfg Config) lineSplitter {
+	return lineSplitter{max: cfg.Input.MaxLineLength, split: cfg.Input.LongLines == "split"}
+}
+
+// lines returns the complete lines at the start of buf, ending in LF even if
+// they end in CRLF in buf, and the number of bytes of buf they take up. The
+// rest of buf is an unterminated line held back until it is completed, which
+// is shorter than the max line length. long counts the lines that exceeded
+// it.
+func (s *lineSplitter) lines(buf []byte) (lines []byte, consumed, long int) {
+	if s.max <= 0 && !s.discarding {
+		end := bytes.LastIndexByte(buf, '\n') + 1
+		return bytes.ReplaceAll(buf[:end], []byte("\r\n"), []byte("\n")), end, 0
+	}
+
+	for consumed < len(buf) {
+		rest := buf[consumed:]
+		end := bytes.IndexByte(rest, '\n')
+		if s.discarding {
+			if end < 0 {
+				consumed = len(buf)
+				break
+			}
+			consumed += end + 1
+			s.discarding = false
+			continue
+		}
+		if end < 0 {
+			if s.max <= 0 || len(rest) <= s.max {
+				break
+			}
+			// The line is too long already, without waiting for the rest.
+			long++
+			if s.split {
+				for len(rest) > s.max {
+					lines = append(append(lines, rest[:s.max]...), '\n')
+					rest = rest[s.max:]
+					consumed += s.max
+				}
+				break
+			}
+			lines = append(append(append(lines, rest[:s.max]...), truncationMarker...), '\n')
+			consumed = len(buf)
+			s.discarding = true
+			break
+		}
+
+		line := bytes.TrimSuffix(rest[:end], []byte{'\r'})
+		consumed += end + 1
+		if s.max <= 0 || len(line) <= s.max {
+			lines = append(append(lines, line...), '\n')
+			continue
+		}
+		long++
+		if !s.split {
+			lines = append(append(append(lines, line[:s.max]...), truncationMarker...), '\n')
+			continue
+		}
+		for len(line) > 0 {
+			n := s.max
+			if n > len(line) {
+				n = len(line)
+			}
+			lines = append(append(lines, line[:n]...), '\n')
+			line = line[n:]
+		}
+	}
+	return lines, consumed, long
+}
@@ -0,0 +1,49 @@
+package sest
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// BenchmarkLineSplitter compares splitting a chunk read from a file into its
+// lines with the line splitter, with and without a max line length, to
+// splitting it with bytes.Split, which does not bound the line length.
+func BenchmarkLineSplitter(b *testing.B) {
+	var buf []byte
+	for i := 0; i < 1000; i++ {
+		buf = append(buf, fmt.Sprintf("Oct 14 12:00:00 host sshd[%d]: login of alice from 10.0.0.1 failed\r\n", i)...)
+	}
+	buf = append(buf, "Oct 14 12:00:01 host sshd[1000]: partial"...)
+
+	for _, bm := range []struct {
+		name  string
+		split func() int
+	}{
+		{"lineSplitter", func() int {
+			var s lineSplitter
+			lines, _, _ := s.lines(buf)
+			return len(splitLines(lines))
+		}},
+		{"lineSplitter with max line length", func() int {
+			s := lineSplitter{max: 4096}
+			lines, _, _ := s.lines(buf)
+			return len(splitLines(lines))
+		}},
+		{"bytes.Split", func() int {
+			end := bytes.LastIndexByte(buf, '\n')
+			lines := bytes.ReplaceAll(buf[:end], []byte("\r\n"), []byte("\n"))
+			return len(bytes.Split(lines, []byte{'\n'}))
+		}},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			b.SetBytes(int64(len(buf)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if n := bm.split(); n != 1000 {
+					b.Fatalf("got %d lines, want 1000", n)
+				}
+			}
+		})
+	}
+}
@@ -1,61 +1,475 @@
-package main
+package sest
 
 import (
+	"bytes"
+	"compress/gzip"
+	"errors"
 	"io"
-	"log"
+	"log/slog"
 	"os"
+	"strings"
+	"sync/atomic"
+	"time"
 )
 
+// LogFile reads the lines appended to a file, following it across rotation
+// and truncation. GetOffset may be called concurrently with the other
+// methods, which must not be called concurrently with each other.
 type LogFile struct {
-	file     *os.File
+	file *os.File
+	// gz decompresses files with a .gz suffix. It is created on the first
+	// read, as the file may still be empty when it is opened.
+	gz *gzip.Reader
+	// Filename is the path the file is read from.
 	Filename string
-	offset   int64
+	// offset points behind the last complete line handed out. Bytes read
+	// past it are kept in partial until their line is terminated.
+	offset  atomic.Int64
+	partial []byte
+	// rotated describes the file read before the last rotation, which was
+	// read up to rotatedOffset.
+	rotated       os.FileInfo
+	rotatedOffset int64
+	// lastRead is when ReadNewLines last returned lines, lastUsed when it
+	// was last called.
+	lastRead time.Time
+	lastUsed time.Time
+	// opened is when the file was opened, and stale is set while nothing
+	// has been written to it for the stale threshold.
+	opened time.Time
+	stale  bool
+	// suspended describes the file closed by Suspend, which is reopened by
+	// the next read.
+	suspended os.FileInfo
+	// blocks holds the multiline block that may be continued by the next
+	// lines read.
+	blocks blockBuffer
+	// MaxRead bounds the bytes read by a call of ReadNewLines, which reads
+	// DefaultMaxRead bytes at most if it is zero. A single line longer than
+	// that is still returned as a whole.
+	MaxRead int64
+	// more is set if the last read stopped at MaxRead.
+	more bool
+	// MaxLineLength bounds the length of the lines returned, unless it is
+	// zero. Longer lines are split into pieces of MaxLineLength bytes if
+	// SplitLongLines is set, and truncated, with a marker, otherwise.
+	MaxLineLength  int
+	SplitLongLines bool
+	splitter       lineSplitter
+	// Encoding is the encoding of the file, UTF-8 if it is empty.
+	// detected is the encoding found in the byte order mark, if Encoding
+	// is empty, and discardingRaw is set while the rest of a line cut off
+	// before decoding is skipped.
+	Encoding      string
+	detected      *textEncoding
+	bomChecked    bool
+	discardingRaw bool
+	// pipe is the named pipe read by Stream, nil for regular files. It is
+	// the same as file, but not reset by Close.
+	pipe *os.File
 }
 
+// DefaultMaxRead is the number of bytes ReadNewLines reads at most if MaxRead
+// is not set.
+const DefaultMaxRead int64 = 1 << 20
+
+// OffsetEnd makes NewLogFile start at the end of the file, so only lines
+// appended later on are read.
+const OffsetEnd int64 = -1
+
+// NewLogFile opens filename for reading new lines from initialOffset on, or
+// from the end of the file if initialOffset is OffsetEnd. Files with a .gz
+// suffix are decompressed, their offsets count decompressed bytes. Named pipes
+// are opened for Stream, ignoring initialOffset.
 func NewLogFile(filename string, initialOffset int64) (*LogFile, error) {
+	if isPipe(filename) {
+		return openPipe(filename)
+	}
+	f, offset, err := openAt(filename, initialOffset)
+	if err != nil {
+		return nil, err
+	}
+
+	logFile := &LogFile{
+		file:     f,
+		Filename: filename,
+		opened:   time.Now(),
+	}
+	logFile.offset.Store(offset)
+	return logFile, nil
+}
+
+// openAt opens filename and seeks to offset, or to the end if offset is
+// OffsetEnd. It returns the offset reached.
+func openAt(filename string, offset int64) (*os.File, int64, error) {
 	f, err := os.Open(filename)
+	if err != nil {
+		return nil, 0, err
+	}
 
+	if isCompressed(filename) {
+		// The decompressed stream cannot be seeked, the offset is skipped
+		// when it is first read.
+		return f, offset, nil
+	}
+	if offset == OffsetEnd {
+		offset, err = f.Seek(0, io.SeekEnd)
+	} else if offset > 0 {
+		offset, err = f.Seek(offset, io.SeekStart)
+	} else {
+		offset = 0
+	}
 	if err != nil {
-		return nil, err
+		f.Close()
+		return nil, 0, err
 	}
+	return f, offset, nil
+}
 
-	var offset int64
-	if initialOffset > 0 {
-		offset, err = f.Seek(initialOffset, os.SEEK_SET)
-		if err != nil {
+// ReadNewLines returns the complete lines written to the file since the last
+// call, reading at most MaxRead bytes; More reports whether there are more to
+// read. A trailing line without newline is held back until it is completed by
+// a later write. Lines ending in CRLF are returned ending in LF, so matches
+// and capture groups never contain the carriage return. When the file has been
+// rotated, i.e. the path now refers to a different file, the remainder of the
+// old file is read before switching over to the new one. Named pipes are
+// read by Stream instead, ReadNewLines returns nothing for them.
+func (f *LogFile) ReadNewLines() ([]byte, error) {
+	if f.pipe != nil {
+		return nil, nil
+	}
+	f.lastUsed = time.Now()
+	if f.suspended != nil {
+		if err := f.resume(); err != nil {
 			return nil, err
 		}
 	}
+	rotated, err := f.isRotated()
+	if err != nil {
+		return nil, err
+	}
 
-	logFile := &LogFile{
-		file:     f,
-		Filename: filename,
-		offset:   offset,
+	lines, err := f.readToEnd()
+	if len(lines) > 0 {
+		f.lastRead = time.Now()
+	}
+	if err != nil || !rotated || f.more {
+		return lines, err
 	}
 
-	return logFile, nil
+	// The old file will not grow anymore, so its unterminated last line is
+	// complete.
+	if len(f.partial) > 0 {
+		lines = append(lines, bytes.TrimSuffix(f.partial, []byte{'\r'})...)
+		lines = append(lines, '\n')
+	}
+
+	slog.Info("File was rotated, reopening", "file", f.Filename)
+	if err := f.reopen(); err != nil {
+		return lines, err
+	}
+	rest, err := f.readToEnd()
+	if len(rest) > 0 {
+		f.lastRead = time.Now()
+	}
+	return append(lines, rest...), err
 }
 
-func (f *LogFile) ReadNewLines() ([]byte, error) {
+// ReadLines is like ReadNewLines, but returns the lines one by one, without
+// their newlines. The offset still advances to the end of the last complete
+// line.
+func (f *LogFile) ReadLines() ([][]byte, error) {
+	chunk, err := f.ReadNewLines()
+	return splitLines(chunk), err
+}
+
+// splitLines splits text into its lines, without their newlines. The lines
+// share the memory of text.
+func splitLines(text []byte) [][]byte {
+	var lines [][]byte
+	for len(text) > 0 {
+		end := bytes.IndexByte(text, '\n')
+		if end < 0 {
+			return append(lines, text)
+		}
+		lines = append(lines, text[:end])
+		text = text[end+1:]
+	}
+	return lines
+}
+
+// More reports whether the last call of ReadNewLines stopped at MaxRead,
+// before reaching the end of the file.
+func (f *LogFile) More() bool {
+	return f.more
+}
+
+func (f *LogFile) maxRead() int64 {
+	if f.MaxRead <= 0 {
+		return DefaultMaxRead
+	}
+	return f.MaxRead
+}
+
+// readToEnd reads the next chunk of the file and holds back its trailing
+// partial line, limiting the length of the lines and transcoding them to
+// UTF-8.
+func (f *LogFile) readToEnd() ([]byte, error) {
+	f.more = false
+	var buf []byte
+	var err error
+	if isCompressed(f.Filename) {
+		buf, err = f.readCompressed()
+	} else {
+		buf, err = f.readPlain()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	buf = f.skipBOM(buf)
+	f.splitter.max, f.splitter.split = f.MaxLineLength, f.SplitLongLines
+	if enc := f.encoding(); enc != nil {
+		return f.decodeLines(buf, enc)
+	}
+	lines, consumed, long := f.splitter.lines(buf)
+	f.partial = append([]byte(nil), buf[consumed:]...)
+	f.offset.Add(int64(consumed))
+	reportLongLines(f.Filename, long, f.MaxLineLength)
+	return lines, nil
+}
+
+// readPlain returns the partial line followed by the bytes appended to the
+// file since the last read, up to MaxRead of them.
+func (f *LogFile) readPlain() ([]byte, error) {
 	stat, err := f.file.Stat()
 	if err != nil {
 		return nil, err
 	}
-	bytesToRead := stat.Size() - f.offset
-	buf := make([]byte, bytesToRead)
-	n, err := f.file.Read(buf)
-	f.offset = stat.Size()
-	log.Printf("Read: %d, try: %d, err: %v", n, bytesToRead, err)
+	readOffset := f.offset.Load() + int64(len(f.partial))
+	if stat.Size() < readOffset {
+		slog.Info("File was truncated, reading from the start", "file", f.Filename)
+		if _, err := f.file.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		f.offset.Store(0)
+		f.partial = nil
+		readOffset = 0
+	}
+	bytesToRead := stat.Size() - readOffset
+	if max := f.maxRead(); bytesToRead > max {
+		bytesToRead = max
+		f.more = true
+	}
+	buf := make([]byte, len(f.partial)+int(bytesToRead))
+	copy(buf, f.partial)
+	n, err := f.file.Read(buf[len(f.partial):])
+	slog.Debug("Read file", "file", f.Filename, "read", n, "try", bytesToRead, "err", err)
 	if err != nil && err != io.EOF {
 		return nil, err
 	}
-	return buf, nil
+	return buf[:len(f.partial)+n], nil
 }
 
+// readCompressed returns the partial line followed by the next chunk of the
+// decompressed stream. Compressed files are expected to be complete, as a
+// stream cut off while it is being written cannot be resumed.
+func (f *LogFile) readCompressed() ([]byte, error) {
+	if f.gz == nil {
+		if _, err := f.file.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		gz, err := gzip.NewReader(f.file)
+		if err == io.EOF {
+			// Nothing has been written yet.
+			return f.partial, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if f.offset.Load() == OffsetEnd {
+			skipped, err := io.Copy(io.Discard, gz)
+			if err != nil {
+				return nil, err
+			}
+			f.gz = gz
+			f.offset.Store(skipped)
+			return f.partial, nil
+		}
+		skipped, err := io.CopyN(io.Discard, gz, f.offset.Load())
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if skipped < f.offset.Load() {
+			slog.Warn("File is shorter than its offset, reading from the start", "file", f.Filename)
+			f.gz = nil
+			f.offset.Store(0)
+			f.partial = nil
+			return f.readCompressed()
+		}
+		f.gz = gz
+	}
+
+	max := f.maxRead()
+	data, err := io.ReadAll(io.LimitReader(f.gz, max))
+	if err != nil {
+		return nil, err
+	}
+	f.more = int64(len(data)) == max
+	return append(f.partial, data...), nil
+}
+
+// isRotated reports whether the path of the log file refers to another file
+// than the open one. A missing path is not considered a rotation yet, as the
+// new file may not have been created.
+func (f *LogFile) isRotated() (bool, error) {
+	onDisk, err := os.Stat(f.Filename)
+	if err != nil {
+		return false, nil
+	}
+	current, err := f.file.Stat()
+	if err != nil {
+		return false, err
+	}
+	return !os.SameFile(current, onDisk), nil
+}
+
+// reopen switches over to the file now found at the path, remembering how far
+// the rotated file has been read.
+func (f *LogFile) reopen() error {
+	stat, statErr := f.file.Stat()
+	readOffset := f.offset.Load() + int64(len(f.partial))
+	if err := f.Reset(0); err != nil {
+		return err
+	}
+	if statErr == nil {
+		f.rotated = stat
+		f.rotatedOffset = readOffset
+	}
+	return nil
+}
+
+// Reset closes the open file and reopens the path, continuing to read at
+// offset, or at the end if offset is OffsetEnd. A partially read line is
+// discarded. If the path cannot be opened the open file is kept. Named pipes
+// cannot be reset.
+func (f *LogFile) Reset(offset int64) error {
+	if f.pipe != nil {
+		return errors.New("cannot reset a named pipe")
+	}
+	file, offset, err := openAt(f.Filename, offset)
+	if err != nil {
+		return err
+	}
+	if f.file != nil {
+		f.file.Close()
+	}
+	f.file = file
+	f.gz = nil
+	f.offset.Store(offset)
+	f.partial = nil
+	f.more = false
+	f.splitter.discarding = false
+	f.detected = nil
+	f.bomChecked = false
+	f.discardingRaw = false
+	return nil
+}
+
+// Suspend closes the open file to free its descriptor, keeping the offset. The
+// next read reopens the path and continues at the offset, or at the start of
+// the file now found there if the file was rotated in the meantime. A
+// partially read line is read again. Named pipes are not suspended.
+func (f *LogFile) Suspend() {
+	if f.pipe != nil || f.file == nil {
+		return
+	}
+	stat, err := f.file.Stat()
+	if err != nil {
+		return
+	}
+	f.Close()
+	f.gz = nil
+	f.partial = nil
+	f.more = false
+	f.suspended = stat
+}
+
+// IsOpen reports whether the file is open, i.e. neither suspended nor closed.
+func (f *LogFile) IsOpen() bool {
+	return f.file != nil
+}
+
+// resume reopens a suspended file.
+func (f *LogFile) resume() error {
+	offset := f.offset.Load()
+	if onDisk, err := os.Stat(f.Filename); err == nil && !os.SameFile(onDisk, f.suspended) {
+		slog.Info("File was rotated while closed, reading the new one from the start", "file", f.Filename)
+		f.rotated, f.rotatedOffset = f.suspended, offset
+		offset = 0
+	}
+	if err := f.Reset(offset); err != nil {
+		return err
+	}
+	f.suspended = nil
+	return nil
+}
+
+// stat describes the open or suspended file.
+func (f *LogFile) stat() (os.FileInfo, error) {
+	if f.suspended != nil {
+		return f.suspended, nil
+	}
+	return f.file.Stat()
+}
+
+// LastRead returns when ReadNewLines last returned lines, or the zero time if
+// it has not.
+func (f *LogFile) LastRead() time.Time {
+	return f.lastRead
+}
+
+// GetOffset returns the offset behind the last complete line read.
 func (f *LogFile) GetOffset() int64 {
-	return f.offset
+	return f.offset.Load()
+}
+
+// IsFile reports whether info describes the open or suspended file.
+func (f *LogFile) IsFile(info os.FileInfo) bool {
+	stat, err := f.stat()
+	if err != nil {
+		return false
+	}
+	return os.SameFile(stat, info)
+}
+
+// OffsetOf returns how far the file described by info has been read, if it is
+// the open file or the one read before the last rotation.
+func (f *LogFile) OffsetOf(info os.FileInfo) (int64, bool) {
+	if f.IsFile(info) {
+		return f.offset.Load(), true
+	}
+	if f.rotated != nil && os.SameFile(f.rotated, info) {
+		return f.rotatedOffset, true
+	}
+	return 0, false
+}
+
+// FileID returns the device and inode number of the open or suspended file.
+func (f *LogFile) FileID() (device, inode uint64, ok bool) {
+	stat, err := f.stat()
+	if err != nil {
+		return 0, 0, false
+	}
+	return fileID(stat)
+}
+
+// isCompressed reports whether filename names a gzip-compressed file.
+func isCompressed(filename string) bool {
+	return strings.HasSuffix(filename, ".gz")
 }
 
+// Close closes the open file.
 func (f *LogFile) Close() {
 	if f.file != nil {
 		f.file.Close()
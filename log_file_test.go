@@ -0,0 +1,531 @@
+package sest
+
+import (
+	"compress/gzip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// appendFile appends text to filename, creating the file if need be.
+func appendFile(t *testing.T, filename, text string) {
+	t.Helper()
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(text); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readNewLines reads the new lines of f and checks that they are want.
+func readNewLines(t *testing.T, f *LogFile, want string) {
+	t.Helper()
+	lines, err := f.ReadNewLines()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(lines) != want {
+		t.Errorf("ReadNewLines() = %q, want %q", lines, want)
+	}
+}
+
+func TestLogFileRotation(t *testing.T) {
+	tests := []struct {
+		name    string
+		initial string
+		// read is what the first read returns, before the rotation.
+		read string
+		// rotated is appended to the rotated file after the rename. If
+		// missing is set, it is read before the new file is created.
+		rotated string
+		missing bool
+		created string
+		want    string
+	}{
+		{name: "renamed and created", initial: "a\nb\n", read: "a\nb\n", created: "c\n", want: "c\n"},
+		{name: "rotated file written to", initial: "a\n", read: "a\n", rotated: "b\n", created: "c\n", want: "b\nc\n"},
+		{name: "unterminated last line", initial: "a\nb", read: "a\n", created: "c\n", want: "b\nc\n"},
+		{name: "unterminated crlf line", initial: "a\r\nb\r", read: "a\n", created: "c\r\n", want: "b\nc\n"},
+		{name: "created later", initial: "a\n", read: "a\n", rotated: "b\n", missing: true, created: "c\n", want: "c\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "app.log")
+			appendFile(t, filename, tt.initial)
+			f, err := NewLogFile(filename, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			readNewLines(t, f, tt.read)
+
+			if err := os.Rename(filename, filename+".1"); err != nil {
+				t.Fatal(err)
+			}
+			appendFile(t, filename+".1", tt.rotated)
+			if tt.missing {
+				readNewLines(t, f, tt.rotated)
+			}
+			appendFile(t, filename, tt.created)
+			readNewLines(t, f, tt.want)
+			if offset := f.GetOffset(); offset != int64(len(tt.created)) {
+				t.Errorf("offset %d, want %d in the new file", offset, len(tt.created))
+			}
+
+			// The new file is followed from now on.
+			appendFile(t, filename, "d\n")
+			readNewLines(t, f, "d\n")
+		})
+	}
+}
+
+func TestLogFileTruncation(t *testing.T) {
+	tests := []struct {
+		name    string
+		initial string
+		read    string
+		// truncated is the content of the file after truncating it.
+		truncated string
+		want      string
+		offset    int64
+	}{
+		{name: "emptied and written", initial: "a\nb\n", read: "a\nb\n", truncated: "c\n", want: "c\n", offset: 2},
+		{name: "emptied", initial: "a\nb\n", read: "a\nb\n", want: "", offset: 0},
+		{name: "partial line dropped", initial: "a\nbbbbbb", read: "a\n", truncated: "c\n", want: "c\n", offset: 2},
+		// Truncation is noticed by the file shrinking below the offset.
+		{name: "rewritten to the same size", initial: "a\n", read: "a\n", truncated: "b\n", want: "", offset: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "app.log")
+			appendFile(t, filename, tt.initial)
+			f, err := NewLogFile(filename, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			readNewLines(t, f, tt.read)
+
+			if err := os.WriteFile(filename, []byte(tt.truncated), 0644); err != nil {
+				t.Fatal(err)
+			}
+			readNewLines(t, f, tt.want)
+			if offset := f.GetOffset(); offset != tt.offset {
+				t.Errorf("offset %d, want %d", offset, tt.offset)
+			}
+		})
+	}
+}
+
+func TestLogFileReset(t *testing.T) {
+	tests := []struct {
+		name    string
+		initial string
+		read    string
+		// rename moves the file away before the reset, replacing it with
+		// replaced unless missing is set.
+		rename   bool
+		missing  bool
+		replaced string
+		offset   int64
+		// err is set if the reset fails.
+		err bool
+		// after is appended to the file at the path after the reset, want
+		// is the read that follows.
+		after string
+		want  string
+	}{
+		{name: "rewind", initial: "a\nb\n", read: "a\nb\n", offset: 0, want: "a\nb\n"},
+		{name: "to an offset", initial: "a\nb\n", read: "a\nb\n", offset: 2, want: "b\n"},
+		{name: "to the end", initial: "a\nb", read: "a\n", offset: OffsetEnd, after: "c\n", want: "c\n"},
+		{name: "partial line discarded", initial: "a\nb", read: "a\n", offset: 2, after: "c\n", want: "bc\n"},
+		{name: "reopen after rename", initial: "a\n", read: "a\n", rename: true, replaced: "b\n", offset: 0, after: "c\n", want: "b\nc\n"},
+		{name: "reopen at an offset after rename", initial: "a\n", read: "a\n", rename: true, replaced: "b\nc\n", offset: 2, want: "c\n"},
+		// The open file is kept if the path is missing.
+		{name: "missing path", initial: "a\n", read: "a\n", rename: true, missing: true, offset: 0, err: true, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "app.log")
+			appendFile(t, filename, tt.initial)
+			f, err := NewLogFile(filename, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			readNewLines(t, f, tt.read)
+
+			if tt.rename {
+				if err := os.Rename(filename, filename+".1"); err != nil {
+					t.Fatal(err)
+				}
+				if !tt.missing {
+					appendFile(t, filename, tt.replaced)
+				}
+			}
+			if err := f.Reset(tt.offset); (err != nil) != tt.err {
+				t.Fatalf("Reset(%d) = %v", tt.offset, err)
+			}
+			if tt.after != "" {
+				appendFile(t, filename, tt.after)
+			}
+			readNewLines(t, f, tt.want)
+		})
+	}
+}
+
+func TestLogFilePartialLines(t *testing.T) {
+	tests := []struct {
+		name string
+		// writes are appended to the file one by one, each followed by a
+		// read returning reads at the same index.
+		writes []string
+		reads  []string
+		offset int64
+	}{
+		{name: "line in two writes", writes: []string{"first ha", "lf\n"}, reads: []string{"", "first half\n"}, offset: 11},
+		{name: "complete lines before the partial one", writes: []string{"a\nb\nc", "c\n"}, reads: []string{"a\nb\n", "cc\n"}, offset: 7},
+		{name: "line in three writes", writes: []string{"a", "b", "c\nd\n"}, reads: []string{"", "", "abc\nd\n"}, offset: 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "app.log")
+			appendFile(t, filename, "")
+			f, err := NewLogFile(filename, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			for i, write := range tt.writes {
+				appendFile(t, filename, write)
+				readNewLines(t, f, tt.reads[i])
+			}
+			if offset := f.GetOffset(); offset != tt.offset {
+				t.Errorf("offset %d, want %d", offset, tt.offset)
+			}
+		})
+	}
+}
+
+func TestLogFileLineEndings(t *testing.T) {
+	tests := []struct {
+		name          string
+		maxLineLength int
+		// writes are appended to the file one by one, each followed by a
+		// read returning reads at the same index.
+		writes []string
+		reads  []string
+	}{
+		{name: "crlf", writes: []string{"a\r\nb\r\n"}, reads: []string{"a\nb\n"}},
+		{name: "mixed", writes: []string{"a\nb\r\nc\n"}, reads: []string{"a\nb\nc\n"}},
+		{name: "crlf in two writes", writes: []string{"a\r", "\nb\r\n"}, reads: []string{"", "a\nb\n"}},
+		{name: "lone carriage return", writes: []string{"a\rb\r\n"}, reads: []string{"a\rb\n"}},
+		{name: "crlf with max line length", maxLineLength: 10, writes: []string{"a\r\nb\nc\r\n"}, reads: []string{"a\nb\nc\n"}},
+		{name: "crlf in two writes with max line length", maxLineLength: 10, writes: []string{"a\r", "\nb\r\n"}, reads: []string{"", "a\nb\n"}},
+		// The carriage return does not count towards the line length.
+		{name: "crlf at max line length", maxLineLength: 3, writes: []string{"abc\r\n"}, reads: []string{"abc\n"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "app.log")
+			appendFile(t, filename, "")
+			f, err := NewLogFile(filename, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			f.MaxLineLength = tt.maxLineLength
+			var size int64
+			for i, write := range tt.writes {
+				appendFile(t, filename, write)
+				readNewLines(t, f, tt.reads[i])
+				size += int64(len(write))
+			}
+			// The offset counts the carriage returns that were stripped.
+			if offset := f.GetOffset(); offset != size {
+				t.Errorf("offset %d, want the size %d", offset, size)
+			}
+		})
+	}
+}
+
+func TestLogFileMaxRead(t *testing.T) {
+	var large strings.Builder
+	for i := 0; large.Len() < int(3*DefaultMaxRead+DefaultMaxRead/2); i++ {
+		fmt.Fprintf(&large, "line %d of a large file\n", i)
+	}
+	tests := []struct {
+		name    string
+		content string
+		maxRead int64
+		// reads is the number of reads needed, each returning at most
+		// limit bytes, max read and the partial line of the read before.
+		reads int
+		limit int
+	}{
+		{name: "large file", content: large.String(), reads: 4, limit: int(DefaultMaxRead) + 32},
+		{name: "small chunks", content: "aaa\nbbb\nccc\nddd\n", maxRead: 9, reads: 2, limit: 8},
+		{name: "chunk at a line end", content: "aaa\nbbb\n", maxRead: 4, reads: 2, limit: 4},
+		// A line longer than max read is returned as a whole.
+		{name: "long line", content: "a\n" + strings.Repeat("b", 20) + "\nc\n", maxRead: 8, reads: 4, limit: 21},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "app.log")
+			appendFile(t, filename, tt.content)
+			f, err := NewLogFile(filename, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			f.MaxRead = tt.maxRead
+
+			var got strings.Builder
+			reads := 0
+			for reads == 0 || f.More() {
+				lines, err := f.ReadNewLines()
+				if err != nil {
+					t.Fatal(err)
+				}
+				reads++
+				if len(lines) > tt.limit || len(lines) > 0 && lines[len(lines)-1] != '\n' {
+					t.Errorf("read %d returned %d bytes ending in %q, want complete lines of at most %d bytes", reads, len(lines), lines[len(lines)-1:], tt.limit)
+				}
+				got.Write(lines)
+			}
+			if reads != tt.reads {
+				t.Errorf("read %d times, want %d", reads, tt.reads)
+			}
+			if got.String() != tt.content {
+				t.Errorf("read %d bytes, want the %d bytes of the file", got.Len(), len(tt.content))
+			}
+			if offset := f.GetOffset(); offset != int64(len(tt.content)) {
+				t.Errorf("offset %d, want the size %d", offset, len(tt.content))
+			}
+		})
+	}
+}
+
+// writeGzip writes each of members to filename as a gzip member of its own,
+// like compressed files concatenated.
+func writeGzip(t *testing.T, filename string, members ...string) {
+	t.Helper()
+	f, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for _, member := range members {
+		gz := gzip.NewWriter(f)
+		if _, err := gz.Write([]byte(member)); err != nil {
+			t.Fatal(err)
+		}
+		if err := gz.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLogFileGzip(t *testing.T) {
+	tests := []struct {
+		name    string
+		members []string
+		// offset is the initial offset, in decompressed bytes.
+		offset  int64
+		maxRead int64
+		want    string
+	}{
+		{name: "from the start", members: []string{"a\nb\n"}, want: "a\nb\n"},
+		{name: "from an offset", members: []string{"a\nb\nc\n"}, offset: 2, want: "b\nc\n"},
+		{name: "from the end", members: []string{"a\nb\n"}, offset: OffsetEnd, want: ""},
+		{name: "offset beyond the end", members: []string{"a\nb\n"}, offset: 100, want: "a\nb\n"},
+		{name: "concatenated members", members: []string{"a\nb", "b\nc\n"}, want: "a\nbb\nc\n"},
+		{name: "offset in a later member", members: []string{"a\n", "b\n"}, offset: 2, want: "b\n"},
+		// Every read returns at most maxRead decompressed bytes.
+		{name: "bounded reads", members: []string{"aaa\nbbb\nccc\n"}, maxRead: 5, want: "aaa\nbbb\nccc\n"},
+		{name: "empty", members: nil, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "app.log.1.gz")
+			writeGzip(t, filename, tt.members...)
+			f, err := NewLogFile(filename, tt.offset)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			f.MaxRead = tt.maxRead
+			var got []byte
+			for reads := 0; reads == 0 || f.More(); reads++ {
+				lines, err := f.ReadNewLines()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if tt.maxRead > 0 && int64(len(lines)) > tt.maxRead {
+					t.Errorf("read %d bytes, want at most %d", len(lines), tt.maxRead)
+				}
+				got = append(got, lines...)
+			}
+			if string(got) != tt.want {
+				t.Errorf("read %q, want %q", got, tt.want)
+			}
+			size := int64(len(strings.Join(tt.members, "")))
+			if offset := f.GetOffset(); offset != size {
+				t.Errorf("offset %d, want the decompressed size %d", offset, size)
+			}
+		})
+	}
+}
+
+// TestLogFileGzipResume checks that a compressed file read up to an offset is
+// resumed from it by a new LogFile, like after a restart.
+func TestLogFileGzipResume(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.log.1.gz")
+	writeGzip(t, filename, "aaa\nbbb\nccc\n")
+	f, err := NewLogFile(filename, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.MaxRead = 6
+	readNewLines(t, f, "aaa\n")
+	offset := f.GetOffset()
+	f.Close()
+
+	f, err = NewLogFile(filename, offset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	readNewLines(t, f, "bbb\nccc\n")
+}
+
+// TestLogFileConcurrentReads reads several files on goroutines of their own,
+// like the readers of a Runner, while they are written to in pieces, one of
+// them is rotated and the others are suspended now and then. Meanwhile the
+// offsets are checkpointed on another goroutine. Run it with -race.
+func TestLogFileConcurrentReads(t *testing.T) {
+	const (
+		files = 4
+		lines = 200
+	)
+	dir := t.TempDir()
+	logFiles := make([]*LogFile, files)
+	for i := range logFiles {
+		filename := filepath.Join(dir, fmt.Sprintf("%d.log", i))
+		if err := os.WriteFile(filename, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		f, err := NewLogFile(filename, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		logFiles[i] = f
+	}
+
+	// Every line is written in two pieces, so reads see partial lines. The
+	// first file is rotated halfway.
+	var writers sync.WaitGroup
+	for i, f := range logFiles {
+		writers.Add(1)
+		go func(i int, filename string) {
+			defer writers.Done()
+			out, err := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND, 0)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			for n := 0; n < lines; n++ {
+				if i == 0 && n == lines/2 {
+					out.Close()
+					if err := os.Rename(filename, filename+".1"); err != nil {
+						t.Error(err)
+						return
+					}
+					if out, err = os.Create(filename); err != nil {
+						t.Error(err)
+						return
+					}
+				}
+				fmt.Fprintf(out, "file %d line %d", i, n)
+				runtime.Gosched()
+				fmt.Fprint(out, "\n")
+			}
+			out.Close()
+		}(i, f.Filename)
+	}
+	written := make(chan struct{})
+	go func() {
+		writers.Wait()
+		close(written)
+	}()
+
+	checkpointed := make(chan struct{})
+	go func() {
+		defer close(checkpointed)
+		for {
+			for _, f := range logFiles {
+				if offset := f.GetOffset(); offset < 0 {
+					t.Errorf("%s has offset %d", f.Filename, offset)
+				}
+			}
+			select {
+			case <-written:
+				return
+			default:
+				runtime.Gosched()
+			}
+		}
+	}()
+
+	var readers sync.WaitGroup
+	got := make([][]string, files)
+	for i, f := range logFiles {
+		readers.Add(1)
+		go func(i int, f *LogFile) {
+			defer readers.Done()
+			deadline := time.Now().Add(10 * time.Second)
+			for reads := 0; len(got[i]) < lines && time.Now().Before(deadline); reads++ {
+				chunk, err := f.ReadNewLines()
+				if err != nil {
+					t.Errorf("%s: %v", f.Filename, err)
+					return
+				}
+				for _, line := range splitLines(chunk) {
+					got[i] = append(got[i], string(line))
+				}
+				if i > 0 && reads%7 == 0 {
+					f.Suspend()
+				}
+				runtime.Gosched()
+			}
+		}(i, f)
+	}
+	readers.Wait()
+	<-checkpointed
+
+	for i, f := range logFiles {
+		want := make([]string, lines)
+		for n := range want {
+			want[n] = fmt.Sprintf("file %d line %d", i, n)
+		}
+		if strings.Join(got[i], "\n") != strings.Join(want, "\n") {
+			t.Errorf("%s: got %d lines %q, want %d lines in order", f.Filename, len(got[i]), got[i], lines)
+		}
+		stat, err := os.Stat(f.Filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if offset := f.GetOffset(); offset != stat.Size() {
+			t.Errorf("%s: offset %d, want the size %d", f.Filename, offset, stat.Size())
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package sest
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// parseLogfmt decodes a logfmt line, i.e. space separated key=value pairs
+// whose values may be double quoted with Go string escapes. Keys without a
+// value are decoded with an empty value.
+func parseLogfmt(line []byte) (map[string]interface{}, error) {
+	doc := make(map[string]interface{})
+	i := 0
+	for {
+		for i < len(line) && isLogfmtSpace(line[i]) {
+			i++
+		}
+		if i == len(line) {
+			break
+		}
+
+		start := i
+		for i < len(line) && line[i] != '=' && !isLogfmtSpace(line[i]) {
+			i++
+		}
+		key := string(line[start:i])
+		if key == "" {
+			return nil, fmt.Errorf("missing key at offset %d", start)
+		}
+		if i == len(line) || line[i] != '=' {
+			doc[key] = ""
+			continue
+		}
+		i++
+
+		if i < len(line) && line[i] == '"' {
+			end, err := quotedEnd(line, i)
+			if err != nil {
+				return nil, err
+			}
+			value, err := strconv.Unquote(string(line[i:end]))
+			if err != nil {
+				return nil, fmt.Errorf("invalid quoted value of %s: %v", key, err)
+			}
+			doc[key] = value
+			i = end
+			continue
+		}
+		start = i
+		for i < len(line) && !isLogfmtSpace(line[i]) {
+			i++
+		}
+		doc[key] = string(line[start:i])
+	}
+	if len(doc) == 0 {
+		return nil, errors.New("no key=value pairs")
+	}
+	return doc, nil
+}
+
+// quotedEnd returns the offset behind the quoted string starting at line[start].
+func quotedEnd(line []byte, start int) (int, error) {
+	for i := start + 1; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1, nil
+		}
+	}
+	return 0, fmt.Errorf("unterminated quote at offset %d", start)
+}
+
+func isLogfmtSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
@@ -0,0 +1,173 @@
+package sest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"text/template"
+)
+
+// Render executes the template of the event for a match in text, as returned
+// by e.Regex.FindSubmatchIndex.
+func (e Event) Render(filename string, text []byte, submatches []int) (RenderedEvent, error) {
+	return e.render(filename, text, submatches, nil, 0)
+}
+
+// render renders the body of the event in its output format, executing its
+// template by default, passing on the decoded fields of a JSON line, if any,
+// and the number of duplicates suppressed before the match.
+func (e Event) render(filename string, text []byte, submatches []int, doc map[string]interface{}, suppressed int) (RenderedEvent, error) {
+	fields := matchFields(e, text, submatches, doc)
+	groups := matchGroups(text, submatches)
+	rendered := RenderedEvent{
+		EventType:   e.EventType,
+		ChannelName: e.ChannelName,
+		Filename:    filename,
+		Line:        string(lineAt(text, submatches[0], submatches[1])),
+		Groups:      groups,
+		Fields:      fields,
+		Suppressed:  suppressed,
+		Severity:    e.severity.of(fields, groups),
+	}
+
+	var err error
+	switch e.output {
+	case outputPlain:
+		rendered.Body = []byte(rendered.Line)
+	case outputJSON:
+		rendered.Body, err = json.Marshal(fields)
+	default:
+		rendered.Body, err = e.execute(rendered, text, submatches, doc)
+	}
+	if err != nil {
+		return RenderedEvent{}, err
+	}
+	return rendered, nil
+}
+
+// execute executes the template of the event for a match.
+func (e Event) execute(rendered RenderedEvent, text []byte, submatches []int, doc map[string]interface{}) ([]byte, error) {
+	t := e.compiled
+	if t == nil {
+		var err error
+		if t, err = e.parse(); err != nil {
+			return nil, err
+		}
+	}
+
+	var tpl bytes.Buffer
+	data := templateData(e, rendered.Filename, text, submatches)
+	for key, value := range doc {
+		if _, ok := data[key]; !ok {
+			data[key] = value
+		}
+	}
+	for key, value := range e.Tags {
+		if _, ok := data[key]; !ok {
+			data[key] = value
+		}
+	}
+	data["Suppressed"] = rendered.Suppressed
+	data["Severity"] = rendered.Severity.String()
+	if err := t.Execute(&tpl, data); err != nil {
+		return nil, fmt.Errorf("%v (template: %q)", err, snippet(e.Template))
+	}
+	return tpl.Bytes(), nil
+}
+
+// parse parses the template of the event with the template functions.
+func (e Event) parse() (*template.Template, error) {
+	t := template.New(e.EventType).Funcs(templateFunctions)
+	if e.location != nil {
+		t.Funcs(template.FuncMap{"timestamp": timestampIn(e.location)})
+	}
+	if e.Strict {
+		t.Option("missingkey=error")
+	}
+	return t.Parse(string(e.Template))
+}
+
+// templateData builds the data a template is executed with for a match: the
+// capture groups as group0 (the whole match), group1, ... and under their
+// names, plus the Filename, EventType, ChannelName and the Line containing the
+// match.
+// Render adds the number of Suppressed duplicates, the Severity and the fields
+// of JSON lines that are not shadowed by these.
+// Groups that did not participate in the match are empty.
+func templateData(e Event, filename string, text []byte, submatches []int) map[string]interface{} {
+	data := make(map[string]interface{}, len(submatches)+4)
+
+	names := e.GroupNames
+	for i := 0; 2*i+1 < len(submatches); i++ {
+		var value string
+		if start, end := submatches[2*i], submatches[2*i+1]; start >= 0 {
+			value = string(text[start:end])
+		}
+		data["group"+strconv.Itoa(i)] = value
+		if i < len(names) && names[i] != "" {
+			data[names[i]] = value
+		}
+	}
+
+	data["Filename"] = filename
+	data["EventType"] = e.EventType
+	data["ChannelName"] = e.ChannelName
+	data["Line"] = string(lineAt(text, submatches[0], submatches[1]))
+	return data
+}
+
+// matchGroups extracts all capture groups of a match.
+func matchGroups(text []byte, submatches []int) []string {
+	groups := make([]string, len(submatches)/2)
+	for i := range groups {
+		if start, end := submatches[2*i], submatches[2*i+1]; start >= 0 {
+			groups[i] = string(text[start:end])
+		}
+	}
+	return groups
+}
+
+// matchFields extracts the named capture groups of a match. Groups that did
+// not participate in the match are omitted. The decoded fields of a JSON line
+// are added unless a group has the same name, and the tags of the event unless
+// a group or field has the same name.
+func matchFields(e Event, text []byte, submatches []int, doc map[string]interface{}) map[string]string {
+	fields := make(map[string]string, len(e.Tags)+len(doc))
+	for key, value := range e.Tags {
+		fields[key] = value
+	}
+	for key, value := range doc {
+		fields[key] = fieldString(value)
+	}
+	for i, name := range e.GroupNames {
+		if name == "" || 2*i+1 >= len(submatches) || submatches[2*i] < 0 {
+			continue
+		}
+		fields[name] = string(text[submatches[2*i]:submatches[2*i+1]])
+	}
+	return fields
+}
+
+// lineAt returns the line(s) of text containing text[start:end], without the
+// trailing newline.
+func lineAt(text []byte, start, end int) []byte {
+	lineStart := bytes.LastIndexByte(text[:start], '\n') + 1
+	if end > start && text[end-1] == '\n' {
+		return text[lineStart : end-1]
+	}
+	lineEnd := len(text)
+	if i := bytes.IndexByte(text[end:], '\n'); i >= 0 {
+		lineEnd = end + i
+	}
+	return text[lineStart:lineEnd]
+}
+
+// snippet shortens a template for log messages.
+func snippet(template []byte) string {
+	const maxLen = 80
+	if len(template) <= maxLen {
+		return string(template)
+	}
+	return string(template[:maxLen]) + "..."
+}
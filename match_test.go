@@ -0,0 +1,177 @@
+package sest
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// testEvent returns an event matching src and rendering tmpl, parsed like
+// createEventList parses it.
+func testEvent(t testing.TB, src, tmpl string, strict bool) Event {
+	t.Helper()
+	re := regexp.MustCompile(src)
+	e := Event{Regex: re, GroupNames: re.SubexpNames(), Template: []byte(tmpl), EventType: "E", Strict: strict}
+	compiled, err := e.parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.compiled = compiled
+	return e
+}
+
+// render renders the first match of e in text.
+func render(t testing.TB, e Event, text string) (RenderedEvent, error) {
+	t.Helper()
+	submatches := e.Regex.FindSubmatchIndex([]byte(text))
+	if submatches == nil {
+		t.Fatalf("%s does not match %q", e.Regex, text)
+	}
+	return e.Render("app.log", []byte(text), submatches)
+}
+
+func TestRenderTemplateErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		strict   bool
+		want     string
+		// err is a part of the error, if rendering fails.
+		err string
+	}{
+		{name: "valid", template: "user {{.group1}}", want: "user alice"},
+		{name: "missing key", template: "{{.missing}}", want: "<no value>"},
+		{name: "missing key in strict mode", template: "{{.missing}}", strict: true, err: `map has no entry for key "missing"`},
+		{name: "bad function argument", template: "{{index .group1 5}}", err: "index out of range"},
+		{name: "failing function", template: `{{printf "%s" (slice .group1 9)}}`, err: "slice"},
+		{name: "long template in the error", template: "{{index .group1 5}}" + strings.Repeat(" ", 100), err: `(template: "{{index .group1 5}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := testEvent(t, `login of (\w+) failed`, tt.template, tt.strict)
+			rendered, err := render(t, e, "login of alice failed")
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("Render() = %q, %v, want an error containing %q", rendered.Body, err, tt.err)
+				}
+				return
+			}
+			if err != nil || string(rendered.Body) != tt.want {
+				t.Errorf("Render() = %q, %v, want %q", rendered.Body, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderTemplateData(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		template string
+		text     string
+		want     string
+	}{
+		{name: "positional groups", src: `(\w+) from (\S+)`, template: "{{.group0}}|{{.group1}}|{{.group2}}", text: "alice from 10.0.0.1", want: "alice from 10.0.0.1|alice|10.0.0.1"},
+		{name: "named groups", src: `(?P<user>\w+) from (?P<ip>\S+)`, template: "{{.user}}@{{.ip}} {{.group1}}", text: "alice from 10.0.0.1", want: "alice@10.0.0.1 alice"},
+		{name: "group not in the match", src: `(\w+)( from (\S+))?`, template: "[{{.group3}}]", text: "alice", want: "[]"},
+		{name: "match details", src: `failed`, template: "{{.Filename}} {{.EventType}} {{.Line}}", text: "first\nlogin failed\nlast", want: "app.log E login failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rendered, err := render(t, testEvent(t, tt.src, tt.template, true), tt.text)
+			if err != nil || string(rendered.Body) != tt.want {
+				t.Errorf("Render() = %q, %v, want %q", rendered.Body, err, tt.want)
+			}
+		})
+	}
+}
+
+// TestRenderEventTypeAndChannelName checks that the event type and channel
+// name are passed to templates and kept in the rendered event for the sinks.
+func TestRenderEventTypeAndChannelName(t *testing.T) {
+	tests := []struct {
+		name        string
+		channelName string
+		template    string
+		want        string
+	}{
+		{name: "event type", template: "{{.EventType}}", want: "E"},
+		{name: "channel name", channelName: "logins", template: "{{.ChannelName}}: {{.group1}}", want: "logins: alice"},
+		{name: "no channel name", template: "[{{.ChannelName}}]", want: "[]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := testEvent(t, `login of (\w+) failed`, tt.template, false)
+			e.ChannelName = tt.channelName
+			rendered, err := render(t, e, "login of alice failed")
+			if err != nil || string(rendered.Body) != tt.want {
+				t.Errorf("Render() = %q, %v, want %q", rendered.Body, err, tt.want)
+			}
+			if rendered.EventType != "E" || rendered.ChannelName != tt.channelName {
+				t.Errorf("rendered event type %q and channel name %q, want E and %q", rendered.EventType, rendered.ChannelName, tt.channelName)
+			}
+		})
+	}
+}
+
+func TestRenderOutputFormats(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		text   string
+		want   string
+	}{
+		{name: "template", output: outputTemplate, text: "login of alice failed from a\n", want: "user alice"},
+		{name: "plain", output: outputPlain, text: "info\nlogin of alice failed from a\ninfo\n", want: "login of alice failed from a"},
+		{name: "plain without newline", output: outputPlain, text: "login of alice failed from a", want: "login of alice failed from a"},
+		{name: "json", output: outputJSON, text: "login of alice failed from a\n", want: `{"host":"a","user":"alice"}`},
+		{name: "json with an unmatched group", output: outputJSON, text: "login of alice failed\n", want: `{"user":"alice"}`},
+		{name: "json escaping", output: outputJSON, text: "login of \"al\\ice\" failed\n", want: `{"user":"\"al\\ice\""}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := testEvent(t, `login of (?P<user>\S+) failed(?: from (?P<host>\w+))?`, "user {{.user}}", false)
+			e.output = tt.output
+			rendered, err := render(t, e, tt.text)
+			if err != nil || string(rendered.Body) != tt.want {
+				t.Errorf("Render() = %s, %v, want %s", rendered.Body, err, tt.want)
+			}
+		})
+	}
+}
+
+// BenchmarkRender compares rendering matches with the template parsed once,
+// as createEventList does, to parsing it for every match.
+func BenchmarkRender(b *testing.B) {
+	re := regexp.MustCompile(`login of (?P<user>\w+) from (\S+) failed`)
+	text := []byte("Oct 14 12:00:00 host sshd[1]: login of alice from 10.0.0.1 failed\n")
+	submatches := re.FindSubmatchIndex(text)
+	event := Event{
+		Regex:      re,
+		GroupNames: re.SubexpNames(),
+		Template:   []byte(`{"user": "{{.user}}", "ip": "{{.group2}}", "line": {{printf "%q" .Line}}}`),
+		EventType:  "LoginFailed",
+	}
+	compiled, err := event.parse()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, bm := range []struct {
+		name     string
+		compiled bool
+	}{{"precompiled", true}, {"parsed per match", false}} {
+		b.Run(bm.name, func(b *testing.B) {
+			e := event
+			if bm.compiled {
+				e.compiled = compiled
+			}
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := e.Render("auth.log", text, submatches); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package sest
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	linesRead = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sest_lines_read_total",
+		Help: "Number of lines read from an input file.",
+	}, []string{"file"})
+	bytesRead = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sest_bytes_read_total",
+		Help: "Number of bytes read from an input file.",
+	}, []string{"file"})
+	longLines = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sest_long_lines_total",
+		Help: "Number of lines truncated or split because they exceeded the max line length.",
+	}, []string{"file"})
+	fileOffset = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "sest_file_offset_bytes",
+		Help: "Offset up to which an input file has been read.",
+	}, []string{"file"})
+	staleFiles = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "sest_file_stale",
+		Help: "Whether nothing has been written to an input file for its stale_after threshold (1) or not (0).",
+	}, []string{"file"})
+	staleTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sest_file_stale_total",
+		Help: "Number of times an input file went stale.",
+	}, []string{"file"})
+	matches = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sest_matches_total",
+		Help: "Number of matches of an event.",
+	}, []string{"event_type"})
+	offSchedule = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sest_off_schedule_total",
+		Help: "Number of matches of an event dropped outside of its schedule.",
+	}, []string{"event_type"})
+	sampledOut = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sest_sampled_out_total",
+		Help: "Number of matches of an event dropped by its sample_rate.",
+	}, []string{"event_type"})
+	emptyEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sest_empty_events_total",
+		Help: "Number of matches skipped because their template rendered empty.",
+	}, []string{"event_type"})
+	deliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sest_sink_deliveries_total",
+		Help: "Number of deliveries to a sink, by result (success or failure).",
+	}, []string{"sink", "result"})
+	natsErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sest_nats_errors_total",
+		Help: "Number of failed NATS connects and publishes, by kind (connect, or publish, including lost connections).",
+	}, []string{"kind"})
+	mqttErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sest_mqtt_errors_total",
+		Help: "Number of failed MQTT connects and publishes, by kind (connect or publish).",
+	}, []string{"kind"})
+	dispatchDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sest_dispatch_dropped_total",
+		Help: "Number of events dropped because the dispatch queue was full.",
+	}, []string{"event_type"})
+)
@@ -0,0 +1,83 @@
+package sest
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// missingCheckInterval is how often the configured files that could
+	// not be opened are checked for being due to be retried.
+	missingCheckInterval = time.Second
+	missingMinBackoff    = time.Second
+	missingMaxBackoff    = time.Minute
+)
+
+// missingFile is the retry state of a configured input file that does not
+// exist or could not be opened.
+type missingFile struct {
+	backoff time.Duration
+	retryAt time.Time
+}
+
+// openMissingFiles retries opening the configured files that are not being
+// read, e.g. because sest started before the application created its log,
+// backing off exponentially while a file stays missing. Files in a watched
+// directory are usually picked up by their create event first.
+func (r *Runner) openMissingFiles() {
+	now := time.Now()
+	configured := make(map[string]bool, len(r.cfg.Input.Files))
+	for _, filename := range r.cfg.Input.Files {
+		filename = filepath.Clean(filename)
+		configured[filename] = true
+		if r.files[filename] != nil || !r.accepts(filename) {
+			delete(r.missing, filename)
+			continue
+		}
+		m := r.missing[filename]
+		if m == nil {
+			m = &missingFile{}
+			r.missing[filename] = m
+		}
+		if now.Before(m.retryAt) {
+			continue
+		}
+		if _, err := os.Stat(filename); err == nil {
+			// Adding the file looks through the files being read for
+			// one it was rotated away from.
+			r.waitReads()
+			r.addFile(filename)
+		}
+		if r.files[filename] != nil {
+			delete(r.missing, filename)
+			r.watchAppeared(filename)
+			continue
+		}
+		if m.backoff == 0 {
+			m.backoff = missingMinBackoff
+		} else if m.backoff *= 2; m.backoff > missingMaxBackoff {
+			m.backoff = missingMaxBackoff
+		}
+		m.retryAt = now.Add(m.backoff)
+	}
+	for filename := range r.missing {
+		if !configured[filename] {
+			delete(r.missing, filename)
+		}
+	}
+}
+
+// watchAppeared adds a configured file that appeared to the watcher, which
+// could not watch it while it was missing. Files in a watched directory are
+// watched with it.
+func (r *Runner) watchAppeared(filename string) {
+	for _, p := range watchedPaths(r.cfg) {
+		if p.Name == filename {
+			// The watcher holds its lock while sending events, so it
+			// must not be modified from the goroutine receiving them.
+			go addWatchedPath(r.watcher, p)
+			return
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package sest
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestRunnerOpensMissingFiles checks that a configured file that appears
+// after startup is read once, while the other files are being read. Run it
+// with -race.
+func TestRunnerOpensMissingFiles(t *testing.T) {
+	dir := t.TempDir()
+	busy := []string{filepath.Join(dir, "a.log"), filepath.Join(dir, "b.log"), filepath.Join(dir, "c.log")}
+	for _, filename := range busy {
+		appendFile(t, filename, "")
+	}
+	cfg := loadTestConfig(t, dir, `
+input:
+  files: [a.log, b.log, c.log, late.log]
+  # Reading the files reopens them, which closes the others.
+  lazy_open: true
+  max_open_files: 1
+poll_interval: 10ms
+events:
+  line:
+    src: 'line (\S+)'
+    template: '{{.group1}}'
+`)
+	var late atomic.Int32
+	r, err := New(cfg, OnMatch(func(e RenderedEvent) {
+		if string(e.Body) == "late" {
+			late.Add(1)
+		}
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- r.Run(ctx) }()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// The other files are written to and rotated until the late one was
+	// read.
+	stop := make(chan struct{})
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			case <-time.After(time.Millisecond):
+			}
+			filename := busy[i%len(busy)]
+			// Rotating the files reopens them while they are read.
+			if i%10 == 9 {
+				os.Rename(filename, filename+".1")
+			}
+			appendFile(t, filename, strings.Repeat(fmt.Sprintf("line busy-%d\n", i), 100))
+		}
+	}()
+	appendFile(t, filepath.Join(dir, "late.log"), "line late\n")
+
+	for deadline := time.Now().Add(10 * time.Second); late.Load() == 0; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			close(stop)
+			t.Fatal("the file that appeared was not read")
+		}
+	}
+	close(stop)
+	<-written
+	time.Sleep(200 * time.Millisecond)
+	if n := late.Load(); n != 1 {
+		t.Errorf("read the file that appeared %d times, want once", n)
+	}
+}
@@ -0,0 +1,247 @@
+package sest
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+const (
+	mqttTimeout          = 5 * time.Second
+	mqttMinBackoff       = time.Second
+	mqttMaxBackoff       = time.Minute
+	mqttDefaultKeepAlive = time.Minute
+)
+
+// mqttClient is the connection to an MQTT broker shared by the MQTT sinks of
+// a config, speaking MQTT 3.1.1 through the paho client. It connects on the
+// first publish, backing off exponentially while the broker stays
+// unreachable. Once connected, paho reestablishes a broken connection itself
+// and resumes the QoS 1 and 2 messages in flight on the new one, which the
+// broker of a persistent session knows to be duplicates. Paho reports a
+// resumed message delivered as soon as it resumes it.
+type mqttClient struct {
+	mu      sync.Mutex
+	client  mqtt.Client
+	addr    string
+	qos     byte
+	retain  bool
+	backoff time.Duration
+	retryAt time.Time
+}
+
+// newMQTTClient returns the client of the MQTT config of cfg, connecting with
+// TLS if tlsConfig is not nil.
+func newMQTTClient(cfg Config, tlsConfig *tls.Config) (*mqttClient, error) {
+	m := cfg.MQTT
+	addr, useTLS, err := parseMQTTBroker(m.Broker)
+	if err != nil {
+		return nil, err
+	}
+	if useTLS && tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	}
+	clientID := m.ClientID
+	if clientID == "" {
+		clientID = "sest"
+		if hostname, err := os.Hostname(); err == nil {
+			clientID += "-" + hostname
+		}
+	}
+	keepAlive := m.KeepAlive
+	if keepAlive <= 0 {
+		keepAlive = mqttDefaultKeepAlive
+	}
+
+	opts := mqtt.NewClientOptions().
+		SetClientID(clientID).
+		SetUsername(m.Username).
+		SetPassword(m.Password).
+		SetCleanSession(m.CleanSession).
+		SetKeepAlive(keepAlive).
+		SetPingTimeout(mqttTimeout).
+		SetConnectTimeout(mqttTimeout).
+		SetWriteTimeout(mqttTimeout).
+		SetProtocolVersion(4).
+		SetAutoReconnect(true).
+		SetMaxReconnectInterval(mqttMaxBackoff).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			mqttErrors.WithLabelValues("connect").Inc()
+			slog.Warn("Lost the connection to the mqtt broker, reconnecting", "broker", addr, "err", err)
+		})
+	if tlsConfig != nil {
+		opts.AddBroker("ssl://" + addr).SetTLSConfig(tlsConfig)
+	} else {
+		opts.AddBroker("tcp://" + addr)
+	}
+	return &mqttClient{client: mqtt.NewClient(opts), addr: addr, qos: byte(m.QoS), retain: m.Retain}, nil
+}
+
+// parseMQTTBroker returns the address of a broker URL, host:port or
+// tcp://host[:port], or ssl://, tls:// or mqtts://host[:port] for TLS.
+func parseMQTTBroker(broker string) (addr string, useTLS bool, err error) {
+	if !strings.Contains(broker, "://") {
+		broker = "tcp://" + broker
+	}
+	u, err := url.Parse(broker)
+	if err != nil {
+		return "", false, fmt.Errorf("invalid mqtt broker: %v", err)
+	}
+	port := "1883"
+	switch u.Scheme {
+	case "tcp", "mqtt":
+	case "ssl", "tls", "mqtts":
+		useTLS, port = true, "8883"
+	default:
+		return "", false, fmt.Errorf("invalid mqtt broker scheme %s, expected tcp or ssl", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return "", false, errors.New("mqtt broker without host")
+	}
+	if u.Port() != "" {
+		port = u.Port()
+	}
+	return net.JoinHostPort(u.Hostname(), port), useTLS, nil
+}
+
+// publish sends payload to topic at the QoS of the client and waits until
+// the broker acknowledged it at QoS 1 and 2, or until ctx is done.
+func (c *mqttClient) publish(ctx context.Context, topic string, payload []byte) error {
+	if err := c.connect(); err != nil {
+		return err
+	}
+	if c.qos == 0 && !c.client.IsConnectionOpen() {
+		// Paho drops QoS 0 messages while it reconnects, without an error.
+		return errors.New("mqtt broker not connected, reconnecting")
+	}
+	token := c.client.Publish(topic, c.qos, c.retain, payload)
+	select {
+	case <-token.Done():
+		return token.Error()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// connect connects to the broker unless paho is connected or reconnecting
+// already. Paho gives up connecting after mqttTimeout.
+func (c *mqttClient) connect() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.client.IsConnected() {
+		return nil
+	}
+	if now := time.Now(); now.Before(c.retryAt) {
+		return fmt.Errorf("mqtt broker unreachable, reconnecting in %v", c.retryAt.Sub(now).Round(time.Millisecond))
+	}
+
+	token := c.client.Connect()
+	<-token.Done()
+	if err := token.Error(); err != nil {
+		mqttErrors.WithLabelValues("connect").Inc()
+		if c.backoff == 0 {
+			c.backoff = mqttMinBackoff
+		} else if c.backoff *= 2; c.backoff > mqttMaxBackoff {
+			c.backoff = mqttMaxBackoff
+		}
+		c.retryAt = time.Now().Add(c.backoff)
+		return fmt.Errorf("could not connect to the mqtt broker: %w", err)
+	}
+
+	c.backoff = 0
+	c.retryAt = time.Time{}
+	return nil
+}
+
+// Close disconnects from the broker, waiting up to mqttTimeout for messages
+// in flight. Closing it repeatedly, once per sink using it, is harmless.
+func (c *mqttClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.client.IsConnected() {
+		c.client.Disconnect(uint(mqttTimeout / time.Millisecond))
+	}
+	return nil
+}
+
+// mqttSink publishes rendered events to an MQTT topic, rendered from a
+// template with the routeData of the event, or the channel name of the event
+// if there is no topic.
+type mqttSink struct {
+	client *mqttClient
+	topic  *template.Template
+}
+
+func newMQTTSink(client *mqttClient, topic string) (*mqttSink, error) {
+	s := &mqttSink{client: client}
+	if topic != "" && !isTemplate(topic) {
+		if err := validMQTTTopic(topic); err != nil {
+			return nil, err
+		}
+	}
+	if topic != "" {
+		var err error
+		if s.topic, err = parseRouteTemplate("mqtt topic", topic); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *mqttSink) Deliver(ctx context.Context, e RenderedEvent) error {
+	topic, err := s.render(e)
+	if err != nil {
+		return permanent(err)
+	}
+	if err := s.client.publish(ctx, topic, e.Body); err != nil {
+		mqttErrors.WithLabelValues("publish").Inc()
+		return err
+	}
+	return nil
+}
+
+// render returns the topic of e, which must be a valid topic to publish to.
+func (s *mqttSink) render(e RenderedEvent) (string, error) {
+	topic := e.ChannelName
+	if s.topic != nil {
+		var b bytes.Buffer
+		if err := s.topic.Execute(&b, routeData(e)); err != nil {
+			return "", fmt.Errorf("could not render mqtt topic: %v", err)
+		}
+		topic = strings.TrimSpace(b.String())
+	}
+	if topic == "" {
+		return "", errors.New("event without channel name or topic for mqtt")
+	}
+	return topic, validMQTTTopic(topic)
+}
+
+// validMQTTTopic checks that a topic can be published to, which excludes the
+// wildcards of subscriptions.
+func validMQTTTopic(topic string) error {
+	if len(topic) > 0xffff || strings.ContainsAny(topic, "+#\x00") {
+		return fmt.Errorf("invalid mqtt topic %q", topic)
+	}
+	return nil
+}
+
+func (s *mqttSink) Close() error {
+	return s.client.Close()
+}
+
+func (s *mqttSink) String() string {
+	return "mqtt " + s.client.addr
+}
@@ -0,0 +1,269 @@
+package sest
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+// mqttBroker is a broker that acknowledges everything and records the
+// packets it receives, by connection. drop, if set, makes it close a
+// connection instead of acknowledging a packet, as if it broke.
+type mqttBroker struct {
+	ln   net.Listener
+	drop func(conn int, p packets.ControlPacket) bool
+
+	mu      sync.Mutex
+	packets [][]packets.ControlPacket
+}
+
+func newMQTTBroker(t *testing.T, drop func(conn int, p packets.ControlPacket) bool) *mqttBroker {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &mqttBroker{ln: ln, drop: drop}
+	go func() {
+		for n := 0; ; n++ {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			b.mu.Lock()
+			b.packets = append(b.packets, nil)
+			b.mu.Unlock()
+			go b.serve(n, conn)
+		}
+	}()
+	t.Cleanup(func() { ln.Close() })
+	return b
+}
+
+func (b *mqttBroker) serve(n int, conn net.Conn) {
+	defer conn.Close()
+	for {
+		p, err := packets.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+		b.mu.Lock()
+		b.packets[n] = append(b.packets[n], p)
+		b.mu.Unlock()
+		if b.drop != nil && b.drop(n, p) {
+			return
+		}
+
+		var reply packets.ControlPacket
+		switch p := p.(type) {
+		case *packets.ConnectPacket:
+			connack := packets.NewControlPacket(packets.Connack).(*packets.ConnackPacket)
+			connack.SessionPresent = n > 0 && !p.CleanSession
+			reply = connack
+		case *packets.PublishPacket:
+			switch p.Qos {
+			case 1:
+				puback := packets.NewControlPacket(packets.Puback).(*packets.PubackPacket)
+				puback.MessageID = p.MessageID
+				reply = puback
+			case 2:
+				pubrec := packets.NewControlPacket(packets.Pubrec).(*packets.PubrecPacket)
+				pubrec.MessageID = p.MessageID
+				reply = pubrec
+			}
+		case *packets.PubrelPacket:
+			pubcomp := packets.NewControlPacket(packets.Pubcomp).(*packets.PubcompPacket)
+			pubcomp.MessageID = p.MessageID
+			reply = pubcomp
+		case *packets.PingreqPacket:
+			reply = packets.NewControlPacket(packets.Pingresp)
+		case *packets.DisconnectPacket:
+			return
+		}
+		if reply != nil {
+			if err := reply.Write(conn); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// received returns the packets received on each connection, once the
+// connection numbered conn received n packets or after a second.
+func (b *mqttBroker) received(conn, n int) [][]packets.ControlPacket {
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(10 * time.Millisecond) {
+		b.mu.Lock()
+		if conn < len(b.packets) && len(b.packets[conn]) >= n || time.Now().After(deadline) {
+			received := make([][]packets.ControlPacket, len(b.packets))
+			for i, packets := range b.packets {
+				received[i] = append(received[i], packets...)
+			}
+			b.mu.Unlock()
+			return received
+		}
+		b.mu.Unlock()
+	}
+}
+
+func testMQTTSink(t *testing.T, broker *mqttBroker, configure func(*Config)) *mqttSink {
+	var cfg Config
+	cfg.MQTT.Broker = broker.ln.Addr().String()
+	cfg.MQTT.ClientID = "test"
+	configure(&cfg)
+	client, err := newMQTTClient(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink, err := newMQTTSink(client, "sest/{{.EventType}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sink.Close() })
+	return sink
+}
+
+func TestMQTTSinkPublish(t *testing.T) {
+	tests := []struct {
+		name         string
+		qos          int
+		retain       bool
+		cleanSession bool
+		username     string
+	}{
+		{name: "qos 0", qos: 0},
+		{name: "qos 1 retained", qos: 1, retain: true},
+		{name: "qos 2 clean session", qos: 2, cleanSession: true},
+		{name: "authenticated", qos: 1, username: "alice"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broker := newMQTTBroker(t, nil)
+			sink := testMQTTSink(t, broker, func(cfg *Config) {
+				cfg.MQTT.QoS = tt.qos
+				cfg.MQTT.Retain = tt.retain
+				cfg.MQTT.CleanSession = tt.cleanSession
+				cfg.MQTT.Username = tt.username
+				cfg.MQTT.Password = "secret"
+			})
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := sink.Deliver(ctx, RenderedEvent{EventType: "LoginFailed", Body: []byte("body")}); err != nil {
+				t.Fatal(err)
+			}
+			// QoS 0 messages are reported delivered once they are sent.
+			received := broker.received(0, 2)
+			if len(received) != 1 || len(received[0]) < 2 {
+				t.Fatalf("got packets %v, want a connect and a publish on one connection", received)
+			}
+			connect, ok := received[0][0].(*packets.ConnectPacket)
+			if !ok {
+				t.Fatalf("got %v, want a connect first", received[0][0])
+			}
+			if connect.ClientIdentifier != "test" || connect.CleanSession != tt.cleanSession || connect.Username != tt.username || connect.Keepalive != 60 {
+				t.Errorf("got %v, want client id test, clean session %v and username %q", connect, tt.cleanSession, tt.username)
+			}
+			publish, ok := received[0][1].(*packets.PublishPacket)
+			if !ok {
+				t.Fatalf("got %v, want a publish after the connect", received[0][1])
+			}
+			if publish.TopicName != "sest/LoginFailed" || string(publish.Payload) != "body" || publish.Qos != byte(tt.qos) || publish.Retain != tt.retain || publish.Dup {
+				t.Errorf("got %v, want body to sest/LoginFailed at qos %d, retain %v", publish, tt.qos, tt.retain)
+			}
+		})
+	}
+}
+
+// TestMQTTSinkRedeliversAcrossReconnects breaks the connection while a QoS 2
+// message is in flight and checks that the delivery is completed on the next
+// connection of the persistent session.
+func TestMQTTSinkRedeliversAcrossReconnects(t *testing.T) {
+	tests := []struct {
+		name string
+		// dropOn is the type of the packet the first connection breaks on.
+		dropOn byte
+		// resumed are the types of the packets resuming the delivery on the
+		// second connection, after its connect.
+		resumed []byte
+	}{
+		{name: "before pubrec", dropOn: packets.Publish, resumed: []byte{packets.Publish, packets.Pubrel}},
+		// Paho does not store releases, it publishes the message again as
+		// a duplicate instead, which the broker knows by its packet id.
+		{name: "before pubcomp", dropOn: packets.Pubrel, resumed: []byte{packets.Publish, packets.Pubrel}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			broker := newMQTTBroker(t, func(conn int, p packets.ControlPacket) bool {
+				return conn == 0 && packetType(p) == tt.dropOn
+			})
+			sink := testMQTTSink(t, broker, func(cfg *Config) { cfg.MQTT.QoS = 2 })
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := sink.Deliver(ctx, RenderedEvent{EventType: "E", Body: []byte("body")}); err != nil {
+				t.Fatal(err)
+			}
+
+			// Paho reports the message delivered once it resumes it.
+			received := broker.received(1, 1+len(tt.resumed))
+			if len(received) != 2 {
+				t.Fatalf("got %d connections, want 2", len(received))
+			}
+			first := received[0][1].(*packets.PublishPacket)
+			var resumed []byte
+			for _, p := range received[1][1:] {
+				resumed = append(resumed, packetType(p))
+				if p.Details().MessageID != first.MessageID {
+					t.Errorf("got %v on the second connection, want message id %d", p, first.MessageID)
+				}
+				if publish, ok := p.(*packets.PublishPacket); ok && !publish.Dup {
+					t.Errorf("got %v, want a duplicate", publish)
+				}
+			}
+			if string(resumed) != string(tt.resumed) {
+				t.Errorf("got packet types %v on the second connection, want %v", resumed, tt.resumed)
+			}
+		})
+	}
+}
+
+// packetType returns the type of the packets the client sends after its
+// connect.
+func packetType(p packets.ControlPacket) byte {
+	switch p.(type) {
+	case *packets.PublishPacket:
+		return packets.Publish
+	case *packets.PubrelPacket:
+		return packets.Pubrel
+	case *packets.DisconnectPacket:
+		return packets.Disconnect
+	case *packets.PingreqPacket:
+		return packets.Pingreq
+	}
+	return 0
+}
+
+func TestParseMQTTBroker(t *testing.T) {
+	tests := []struct {
+		broker string
+		addr   string
+		useTLS bool
+		err    bool
+	}{
+		{broker: "localhost:1884", addr: "localhost:1884"},
+		{broker: "tcp://localhost", addr: "localhost:1883"},
+		{broker: "mqtt://localhost:1884", addr: "localhost:1884"},
+		{broker: "ssl://localhost", addr: "localhost:8883", useTLS: true},
+		{broker: "mqtts://[::1]:8884", addr: "[::1]:8884", useTLS: true},
+		{broker: "ws://localhost", err: true},
+		{broker: "tcp://", err: true},
+	}
+	for _, tt := range tests {
+		addr, useTLS, err := parseMQTTBroker(tt.broker)
+		if (err != nil) != tt.err || addr != tt.addr || useTLS != tt.useTLS {
+			t.Errorf("parseMQTTBroker(%q) = %q, %v, %v", tt.broker, addr, useTLS, err)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package sest
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// defaultFlushTimeout is how long the last block of a file is held back if
+// the multiline config sets no flush timeout.
+const defaultFlushTimeout = time.Second
+
+// multiline groups the lines of a file into blocks, such as stack traces,
+// that are matched as a whole. A line matching start begins a new block and
+// the following lines matching continuation are appended to it. Lines that
+// neither start nor continue a block form a block of their own.
+type multiline struct {
+	start        *regexp.Regexp
+	continuation *regexp.Regexp
+	timeout      time.Duration
+}
+
+// newMultiline compiles the multiline config of cfg. It returns nil if
+// multiline mode is disabled.
+func newMultiline(cfg Config) (*multiline, error) {
+	mc := cfg.Input.Multiline
+	if mc.Start == "" {
+		return nil, nil
+	}
+
+	start, err := regexp.Compile(mc.Start)
+	if err != nil {
+		return nil, fmt.Errorf("could not compile multiline start %s: %w", mc.Start, err)
+	}
+	continuation := `^\s`
+	if mc.Continuation != "" {
+		continuation = mc.Continuation
+	}
+	cont, err := regexp.Compile(continuation)
+	if err != nil {
+		return nil, fmt.Errorf("could not compile multiline continuation %s: %w", continuation, err)
+	}
+	timeout := defaultFlushTimeout
+	if mc.FlushTimeout > 0 {
+		timeout = mc.FlushTimeout
+	}
+	return &multiline{start: start, continuation: cont, timeout: timeout}, nil
+}
+
+// blockBuffer holds the block of a file that may still be continued by lines
+// not written yet.
+type blockBuffer struct {
+	pending []byte
+	updated time.Time
+}
+
+// split adds complete lines to the pending block of b and returns the blocks
+// completed by them.
+func (m *multiline) split(b *blockBuffer, lines []byte, now time.Time) [][]byte {
+	var blocks [][]byte
+	for len(lines) > 0 {
+		end := bytes.IndexByte(lines, '\n') + 1
+		if end == 0 {
+			end = len(lines)
+		}
+		line := lines[:end]
+		lines = lines[end:]
+
+		text := bytes.TrimSuffix(line, []byte{'\n'})
+		switch {
+		case m.start.Match(text):
+			if b.pending != nil {
+				blocks = append(blocks, b.pending)
+			}
+			b.pending = append([]byte(nil), line...)
+		case b.pending != nil && m.continuation.Match(text):
+			b.pending = append(b.pending, line...)
+		default:
+			if b.pending != nil {
+				blocks = append(blocks, b.pending)
+				b.pending = nil
+			}
+			blocks = append(blocks, line)
+		}
+	}
+	if b.pending != nil {
+		b.updated = now
+	}
+	return blocks
+}
+
+// flush returns the pending block of b if no line has been added to it for
+// the flush timeout, or unconditionally if force is set or m is nil.
+func (m *multiline) flush(b *blockBuffer, now time.Time, force bool) []byte {
+	if b.pending == nil || (m != nil && !force && now.Sub(b.updated) < m.timeout) {
+		return nil
+	}
+	block := b.pending
+	b.pending = nil
+	return block
+}
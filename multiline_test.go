@@ -0,0 +1,150 @@
+package sest
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMultilineSplit(t *testing.T) {
+	tests := []struct {
+		name         string
+		continuation string
+		// chunks are split one by one, each returning the blocks at the
+		// same index.
+		chunks  []string
+		blocks  [][]string
+		pending string
+	}{
+		{
+			name:    "stack trace",
+			chunks:  []string{"Exception in main\n\tat a\n\tat b\nException in worker\n"},
+			blocks:  [][]string{{"Exception in main\n\tat a\n\tat b\n"}},
+			pending: "Exception in worker\n",
+		},
+		{
+			name:    "block across chunks",
+			chunks:  []string{"Exception in main\n\tat a\n", "\tat b\n", "Exception in worker\n"},
+			blocks:  [][]string{nil, nil, {"Exception in main\n\tat a\n\tat b\n"}},
+			pending: "Exception in worker\n",
+		},
+		{
+			name:   "lines outside blocks",
+			chunks: []string{"info\nException in main\n\tat a\ninfo\n\tindented\n"},
+			blocks: [][]string{{"info\n", "Exception in main\n\tat a\n", "info\n", "\tindented\n"}},
+		},
+		{
+			name:         "custom continuation",
+			continuation: `^(at |Caused by)`,
+			chunks:       []string{"Exception in main\nat a\nCaused by: b\n\tat c\n"},
+			blocks:       [][]string{{"Exception in main\nat a\nCaused by: b\n", "\tat c\n"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg Config
+			cfg.Input.Multiline.Start = `^Exception`
+			cfg.Input.Multiline.Continuation = tt.continuation
+			m, err := newMultiline(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var b blockBuffer
+			for i, chunk := range tt.chunks {
+				var got []string
+				for _, block := range m.split(&b, []byte(chunk), time.Now()) {
+					got = append(got, string(block))
+				}
+				if !reflect.DeepEqual(got, tt.blocks[i]) {
+					t.Errorf("split(%q) = %q, want %q", chunk, got, tt.blocks[i])
+				}
+			}
+			if string(b.pending) != tt.pending {
+				t.Errorf("pending %q, want %q", b.pending, tt.pending)
+			}
+		})
+	}
+}
+
+func TestMultilineFlush(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		since   time.Duration
+		force   bool
+		want    string
+	}{
+		{name: "before the timeout", timeout: time.Second, since: 999 * time.Millisecond, want: ""},
+		{name: "at the timeout", timeout: time.Second, since: time.Second, want: "Exception\n\tat a\n"},
+		{name: "default timeout", since: defaultFlushTimeout, want: "Exception\n\tat a\n"},
+		{name: "forced", timeout: time.Second, force: true, want: "Exception\n\tat a\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg Config
+			cfg.Input.Multiline.Start = `^Exception`
+			cfg.Input.Multiline.FlushTimeout = tt.timeout
+			m, err := newMultiline(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var b blockBuffer
+			m.split(&b, []byte("Exception\n\tat a\n"), now)
+			got := m.flush(&b, now.Add(tt.since), tt.force)
+			if string(got) != tt.want {
+				t.Errorf("flush() = %q, want %q", got, tt.want)
+			}
+			if tt.want != "" && b.pending != nil {
+				t.Errorf("pending %q after the flush, want none", b.pending)
+			}
+			if again := m.flush(&b, now.Add(tt.since), true); tt.want != "" && again != nil {
+				t.Errorf("flushed %q again", again)
+			}
+		})
+	}
+}
+
+// TestRunnerMultilineFlush checks that the last block of a file is matched
+// once the flush timeout passed without new lines.
+func TestRunnerMultilineFlush(t *testing.T) {
+	logFile, events := runTestConfig(t, `
+input:
+  files: [app.log]
+  multiline:
+    start: '^Exception'
+    flush_timeout: 50ms
+poll_interval: 10ms
+events:
+  trace:
+    src: '(?s)Exception in (\w+).*at (\w+)\n$'
+    template: '{{.group1}} {{.group2}}'
+`)
+	appendFile(t, logFile, "Exception in main\n\tat a\n\tat b\n")
+	if e := nextEvent(t, events); string(e.Body) != "main b" {
+		t.Errorf("got event %q, want the whole block", e.Body)
+	}
+}
+
+func TestNewMultiline(t *testing.T) {
+	tests := []struct {
+		start        string
+		continuation string
+		disabled     bool
+		err          bool
+	}{
+		{disabled: true},
+		{start: `^Exception`},
+		{start: `(`, err: true},
+		{start: `^Exception`, continuation: `[`, err: true},
+	}
+	for _, tt := range tests {
+		var cfg Config
+		cfg.Input.Multiline.Start = tt.start
+		cfg.Input.Multiline.Continuation = tt.continuation
+		m, err := newMultiline(cfg)
+		if (err != nil) != tt.err || (m == nil) != (tt.disabled || tt.err) {
+			t.Errorf("newMultiline(%q, %q) = %v, %v", tt.start, tt.continuation, m, err)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package sest
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	natsTimeout     = 5 * time.Second
+	natsMinBackoff  = time.Second
+	natsMaxBackoff  = time.Minute
+	natsDefaultPort = "4222"
+	// natsMaxReconnects is how often a broken connection is reestablished
+	// in a row, waiting natsReconnectWait in between, before it is closed
+	// and the next delivery connects anew.
+	natsMaxReconnects = 60
+	natsReconnectWait = 2 * time.Second
+)
+
+// natsSink publishes rendered events to NATS, on the subject named by the
+// channel name of the event, or else its event type, behind an optional
+// prefix. Every publish is flushed with a round trip to the server before it
+// succeeds. It connects on the first delivery, backing off exponentially
+// while NATS stays unreachable, and then leaves reconnecting to nats.go.
+// Publishes fail while it reconnects, instead of being buffered.
+type natsSink struct {
+	mu  sync.Mutex
+	url string
+	// addr is the host:port of url.
+	addr    string
+	opts    []nats.Option
+	prefix  string
+	conn    *nats.Conn
+	backoff time.Duration
+	retryAt time.Time
+}
+
+// newNatsSink returns a sink publishing to the server at rawURL, either
+// host:port or nats://[user:password@]host[:port]. Credentials in the URL
+// take precedence over user and password.
+func newNatsSink(rawURL, user, password, token, prefix string, tlsConfig *tls.Config) (*natsSink, error) {
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "nats://" + rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid nats url: %v", err)
+	}
+	switch u.Scheme {
+	case "nats":
+	case "tls":
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{}
+		}
+	default:
+		return nil, fmt.Errorf("invalid nats url scheme %s, expected nats or tls", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return nil, errors.New("nats url without host")
+	}
+	port := u.Port()
+	if port == "" {
+		port = natsDefaultPort
+	}
+	if u.User != nil {
+		user = u.User.Username()
+		password, _ = u.User.Password()
+	}
+
+	s := &natsSink{addr: net.JoinHostPort(u.Hostname(), port), prefix: prefix}
+	s.url = "nats://" + s.addr
+	s.opts = []nats.Option{
+		nats.Name("sest"),
+		nats.Timeout(natsTimeout),
+		nats.MaxReconnects(natsMaxReconnects),
+		nats.ReconnectWait(natsReconnectWait),
+		nats.ReconnectBufSize(-1),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil {
+				natsErrors.WithLabelValues("publish").Inc()
+				slog.Warn("Lost the connection to nats, reconnecting", "url", s.url, "err", err)
+			}
+		}),
+		nats.ErrorHandler(func(_ *nats.Conn, _ *nats.Subscription, err error) {
+			natsErrors.WithLabelValues("publish").Inc()
+			slog.Warn("Nats reported an error", "url", s.url, "err", err)
+		}),
+	}
+	if user != "" || password != "" {
+		s.opts = append(s.opts, nats.UserInfo(user, password))
+	}
+	if token != "" {
+		s.opts = append(s.opts, nats.Token(token))
+	}
+	if tlsConfig != nil {
+		s.url = "tls://" + s.addr
+		s.opts = append(s.opts, nats.Secure(tlsConfig))
+	}
+	return s, nil
+}
+
+// subject returns the subject of an event, which must be a valid NATS
+// subject for publishing.
+func (s *natsSink) subject(e RenderedEvent) (string, error) {
+	name := e.ChannelName
+	if name == "" {
+		name = e.EventType
+	}
+	if name == "" {
+		return "", errors.New("event without channel name or event type for the nats subject")
+	}
+	subject := s.prefix + name
+	if strings.ContainsAny(subject, " \t\r\n*>") || strings.HasPrefix(subject, ".") || strings.HasSuffix(subject, ".") || strings.Contains(subject, "..") {
+		return "", fmt.Errorf("invalid nats subject %q", subject)
+	}
+	return subject, nil
+}
+
+func (s *natsSink) Deliver(ctx context.Context, e RenderedEvent) error {
+	subject, err := s.subject(e)
+	if err != nil {
+		return permanent(err)
+	}
+	conn, err := s.connect()
+	if err != nil {
+		natsErrors.WithLabelValues("connect").Inc()
+		return err
+	}
+	if err := conn.Publish(subject, e.Body); err != nil {
+		natsErrors.WithLabelValues("publish").Inc()
+		return err
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, natsTimeout)
+		defer cancel()
+	}
+	if err := conn.FlushWithContext(ctx); err != nil {
+		natsErrors.WithLabelValues("publish").Inc()
+		return fmt.Errorf("could not flush the nats publish: %w", err)
+	}
+	return nil
+}
+
+// connect returns the connection to NATS, connecting unless nats.go is
+// connected or reconnecting already.
+func (s *natsSink) connect() (*nats.Conn, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn != nil && !s.conn.IsClosed() {
+		return s.conn, nil
+	}
+	if now := time.Now(); now.Before(s.retryAt) {
+		return nil, fmt.Errorf("nats unreachable, reconnecting in %v", s.retryAt.Sub(now).Round(time.Millisecond))
+	}
+
+	conn, err := nats.Connect(s.url, s.opts...)
+	if err != nil {
+		if s.backoff == 0 {
+			s.backoff = natsMinBackoff
+		} else if s.backoff *= 2; s.backoff > natsMaxBackoff {
+			s.backoff = natsMaxBackoff
+		}
+		s.retryAt = time.Now().Add(s.backoff)
+		return nil, fmt.Errorf("could not connect to nats: %w", err)
+	}
+
+	s.conn = conn
+	s.backoff = 0
+	s.retryAt = time.Time{}
+	return conn, nil
+}
+
+func (s *natsSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+	return nil
+}
+
+func (s *natsSink) String() string {
+	return "nats " + s.addr
+}
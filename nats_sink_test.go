@@ -0,0 +1,221 @@
+package sest
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// natsServer speaks enough of the NATS protocol to accept connections and
+// publishes, and records the connects and publishes it receives. If
+// dropAfter is set, it closes the first connection after that many
+// publishes.
+type natsServer struct {
+	ln        net.Listener
+	dropAfter int
+
+	mu        sync.Mutex
+	connects  []map[string]interface{}
+	publishes []string
+}
+
+func newNatsServer(t *testing.T, dropAfter int) *natsServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &natsServer{ln: ln, dropAfter: dropAfter}
+	go func() {
+		for n := 0; ; n++ {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(n, conn)
+		}
+	}()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+func (s *natsServer) serve(n int, conn net.Conn) {
+	defer conn.Close()
+	fmt.Fprintf(conn, "INFO {\"server_id\":\"test\",\"version\":\"2.10.0\",\"proto\":1,\"max_payload\":1048576}\r\n")
+	reader := bufio.NewReader(conn)
+	publishes := 0
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		op, args, _ := strings.Cut(strings.TrimRight(line, "\r\n"), " ")
+		switch op {
+		case "CONNECT":
+			var connect map[string]interface{}
+			json.Unmarshal([]byte(args), &connect)
+			s.mu.Lock()
+			s.connects = append(s.connects, connect)
+			s.mu.Unlock()
+		case "PING":
+			if s.dropAfter > 0 && n == 0 && publishes == s.dropAfter {
+				return
+			}
+			fmt.Fprint(conn, "PONG\r\n")
+		case "PUB":
+			fields := strings.Fields(args)
+			size, _ := strconv.Atoi(fields[len(fields)-1])
+			payload := make([]byte, size+2)
+			if _, err := io.ReadFull(reader, payload); err != nil {
+				return
+			}
+			publishes++
+			s.mu.Lock()
+			s.publishes = append(s.publishes, fields[0]+" "+string(payload[:size]))
+			s.mu.Unlock()
+		}
+	}
+}
+
+func TestNatsSinkPublish(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		user    string
+		token   string
+		prefix  string
+		event   RenderedEvent
+		publish string
+		connect map[string]string
+	}{
+		{
+			name:    "channel name",
+			prefix:  "sest.",
+			event:   RenderedEvent{ChannelName: "logins", EventType: "LoginFailed", Body: []byte("body")},
+			publish: "sest.logins body",
+		},
+		{
+			name:    "event type",
+			event:   RenderedEvent{EventType: "LoginFailed", Body: []byte("body")},
+			publish: "LoginFailed body",
+		},
+		{
+			name:    "user",
+			user:    "alice",
+			event:   RenderedEvent{EventType: "E", Body: []byte("body")},
+			publish: "E body",
+			connect: map[string]string{"user": "alice", "pass": "secret", "name": "sest"},
+		},
+		{
+			name:    "user in url",
+			url:     "nats://bob:hunter2@",
+			user:    "alice",
+			event:   RenderedEvent{EventType: "E", Body: []byte("body")},
+			publish: "E body",
+			connect: map[string]string{"user": "bob", "pass": "hunter2"},
+		},
+		{
+			name:    "token",
+			token:   "t0k3n",
+			event:   RenderedEvent{EventType: "E", Body: []byte("body")},
+			publish: "E body",
+			connect: map[string]string{"auth_token": "t0k3n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newNatsServer(t, 0)
+			password := ""
+			if tt.user != "" {
+				password = "secret"
+			}
+			sink, err := newNatsSink(tt.url+server.ln.Addr().String(), tt.user, password, tt.token, tt.prefix, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer sink.Close()
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := sink.Deliver(ctx, tt.event); err != nil {
+				t.Fatal(err)
+			}
+
+			server.mu.Lock()
+			defer server.mu.Unlock()
+			if len(server.publishes) != 1 || server.publishes[0] != tt.publish {
+				t.Errorf("got publishes %q, want %q", server.publishes, tt.publish)
+			}
+			if len(server.connects) != 1 {
+				t.Fatalf("got %d connects, want 1", len(server.connects))
+			}
+			for key, want := range tt.connect {
+				if got := server.connects[0][key]; got != want {
+					t.Errorf("connect %s = %v, want %q", key, got, want)
+				}
+			}
+		})
+	}
+}
+
+// TestNatsSinkDisconnect checks that a broken connection is counted as a
+// publish error and that publishes fail while nats.go reconnects, instead of
+// being buffered.
+func TestNatsSinkDisconnect(t *testing.T) {
+	server := newNatsServer(t, 1)
+	sink, err := newNatsSink(server.ln.Addr().String(), "", "", "", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	publishErrors := natsErrors.WithLabelValues("publish")
+	before := testutil.ToFloat64(publishErrors)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := sink.Deliver(ctx, RenderedEvent{EventType: "E", Body: []byte("first")}); err == nil {
+		t.Fatal("Deliver() succeeded, although the server closed the connection before acknowledging it")
+	}
+	if err := sink.Deliver(ctx, RenderedEvent{EventType: "E", Body: []byte("second")}); err == nil {
+		t.Error("Deliver() succeeded while reconnecting")
+	}
+	// The disconnect handler runs asynchronously.
+	for deadline := time.Now().Add(time.Second); testutil.ToFloat64(publishErrors) < before+3 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := testutil.ToFloat64(publishErrors) - before; got != 3 {
+		t.Errorf("counted %v publish errors, want 3: two failed deliveries and the disconnect", got)
+	}
+}
+
+func TestNatsSubject(t *testing.T) {
+	tests := []struct {
+		prefix string
+		event  RenderedEvent
+		want   string
+		err    bool
+	}{
+		{prefix: "sest.", event: RenderedEvent{ChannelName: "logins", EventType: "E"}, want: "sest.logins"},
+		{event: RenderedEvent{EventType: "LoginFailed"}, want: "LoginFailed"},
+		{event: RenderedEvent{}, err: true},
+		{event: RenderedEvent{ChannelName: "a b"}, err: true},
+		{event: RenderedEvent{ChannelName: "logins.*"}, err: true},
+		{prefix: "sest..", event: RenderedEvent{ChannelName: "logins"}, err: true},
+		{event: RenderedEvent{ChannelName: "logins."}, err: true},
+	}
+	for _, tt := range tests {
+		s := &natsSink{prefix: tt.prefix}
+		got, err := s.subject(tt.event)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("subject(%+v) with prefix %q = %q, %v, want %q", tt.event, tt.prefix, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package sest
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const offsetCheckpointInterval = 5 * time.Second
+
+type fileState struct {
+	Offset int64  `json:"offset"`
+	Device uint64 `json:"device,omitempty"`
+	Inode  uint64 `json:"inode,omitempty"`
+}
+
+// offsetStore persists the read offsets of log files, so a restarted process
+// resumes where the previous one stopped.
+type offsetStore struct {
+	mu       sync.Mutex
+	filename string
+	states   map[string]fileState
+}
+
+func loadOffsetStore(filename string) (*offsetStore, error) {
+	s := &offsetStore{
+		filename: filename,
+		states:   make(map[string]fileState),
+	}
+	content, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, &s.states); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Offset returns the persisted offset for a file and whether one was found.
+// Where file IDs are available the offset is looked up by the file's device
+// and inode, so a file that was renamed while we were not running keeps its
+// offset and a new file at a known path is not found.
+func (s *offsetStore) Offset(filename string) (int64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stat, err := os.Stat(filename)
+	if err != nil {
+		return 0, false
+	}
+	size := stat.Size()
+	if isCompressed(filename) {
+		// The offsets of compressed files count decompressed bytes, they
+		// are checked when the file is read.
+		size = math.MaxInt64
+	}
+	device, inode, ok := fileID(stat)
+	if !ok {
+		state, found := s.states[filename]
+		return clampOffset(state.Offset, size), found
+	}
+
+	if state, found := s.states[filename]; found && state.Device == device && state.Inode == inode {
+		return clampOffset(state.Offset, size), true
+	}
+	for _, state := range s.states {
+		if state.Device == device && state.Inode == inode {
+			return clampOffset(state.Offset, size), true
+		}
+	}
+	return 0, false
+}
+
+func clampOffset(offset, size int64) int64 {
+	if offset > size {
+		return 0
+	}
+	return offset
+}
+
+// Update records the current offsets of the given files, replacing the state
+// of files that are no longer watched.
+func (s *offsetStore) Update(files map[string]*LogFile) {
+	states := make(map[string]fileState, len(files))
+	for filename, file := range files {
+		state := fileState{Offset: file.GetOffset()}
+		state.Device, state.Inode, _ = file.FileID()
+		states[filename] = state
+	}
+
+	s.mu.Lock()
+	s.states = states
+	s.mu.Unlock()
+}
+
+// Save atomically writes the recorded offsets to the state file.
+func (s *offsetStore) Save() error {
+	s.mu.Lock()
+	content, err := json.MarshalIndent(s.states, "", "  ")
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(s.filename)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(dir, filepath.Base(s.filename)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.filename)
+}
@@ -0,0 +1,190 @@
+package sest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	pagerdutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+	// pagerdutyMaxSummary is the longest summary the Events API accepts.
+	pagerdutyMaxSummary = 1024
+	// pagerdutyRateLimitRetries is how often a rate limited request is
+	// retried, waiting pagerdutyRateLimitBackoff before the first retry and
+	// twice as long before each further one.
+	pagerdutyRateLimitRetries = 3
+	pagerdutyRateLimitBackoff = time.Second
+)
+
+// pagerdutySink triggers PagerDuty alerts through the Events API v2. The
+// rendered body is the summary and the capture groups are the custom details.
+// Events whose line matches the resolve regex resolve the alert with their
+// dedup key instead of triggering one.
+type pagerdutySink struct {
+	client     *http.Client
+	url        string
+	routingKey string
+	// key is the name or number of the capture group holding the dedup
+	// key, empty to let PagerDuty pick one.
+	key     string
+	resolve *regexp.Regexp
+	source  string
+}
+
+type pagerdutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key,omitempty"`
+	Payload     *pagerdutyPayload `json:"payload,omitempty"`
+}
+
+type pagerdutyPayload struct {
+	Summary       string            `json:"summary"`
+	Source        string            `json:"source"`
+	Severity      string            `json:"severity"`
+	Class         string            `json:"class,omitempty"`
+	CustomDetails map[string]string `json:"custom_details,omitempty"`
+}
+
+func newPagerdutySink(client *http.Client, spec SinkConfig) (*pagerdutySink, error) {
+	s := &pagerdutySink{
+		client:     client,
+		url:        spec.URL,
+		routingKey: spec.RoutingKey,
+		key:        spec.Key,
+	}
+	if s.url == "" {
+		s.url = pagerdutyEventsURL
+	}
+	if spec.Resolve != "" {
+		var err error
+		if s.resolve, err = regexp.Compile(spec.Resolve); err != nil {
+			return nil, fmt.Errorf("pagerduty resolve does not compile: %v", err)
+		}
+	}
+	if host, err := os.Hostname(); err == nil {
+		s.source = host
+	}
+	return s, nil
+}
+
+func (s *pagerdutySink) Deliver(ctx context.Context, e RenderedEvent) error {
+	event := pagerdutyEvent{RoutingKey: s.routingKey, EventAction: "trigger"}
+	if s.key != "" {
+		event.DedupKey, _ = messageKey(s.key, e)
+	}
+	if s.resolve != nil && s.resolve.MatchString(e.Line) {
+		if event.DedupKey == "" {
+			return permanent(fmt.Errorf("no dedup key in group %s to resolve the alert with", s.key))
+		}
+		event.EventAction = "resolve"
+	} else {
+		event.Payload = s.payload(e)
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	backoff := pagerdutyRateLimitBackoff
+	for retries := 0; ; retries++ {
+		err := s.post(ctx, body)
+		if err != errPagerdutyRateLimited || retries == pagerdutyRateLimitRetries {
+			return err
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return err
+		}
+		backoff *= 2
+	}
+}
+
+// payload describes the alert triggered by an event.
+func (s *pagerdutySink) payload(e RenderedEvent) *pagerdutyPayload {
+	summary := string(bytes.TrimSpace(e.Body))
+	if len(summary) > pagerdutyMaxSummary {
+		end := pagerdutyMaxSummary
+		for end > 0 && !utf8.RuneStart(summary[end]) {
+			end--
+		}
+		summary = summary[:end]
+	}
+	source := s.source
+	if source == "" {
+		source = e.Filename
+	}
+	details := make(map[string]string, len(e.Fields)+len(e.Groups)+1)
+	for i, group := range e.Groups {
+		details["group"+strconv.Itoa(i)] = group
+	}
+	for name, value := range e.Fields {
+		details[name] = value
+	}
+	details["filename"] = e.Filename
+	return &pagerdutyPayload{
+		Summary:       summary,
+		Source:        source,
+		Severity:      pagerdutySeverity(e.Severity),
+		Class:         e.EventType,
+		CustomDetails: details,
+	}
+}
+
+// pagerdutySeverity maps a severity to the ones of PagerDuty. Events of unknown
+// severity are errors, as they are worth an alert.
+func pagerdutySeverity(s Severity) string {
+	switch s {
+	case SeverityFatal:
+		return "critical"
+	case SeverityWarn:
+		return "warning"
+	case SeverityInfo, SeverityDebug:
+		return "info"
+	}
+	return "error"
+}
+
+var errPagerdutyRateLimited = errors.New("pagerduty rate limited")
+
+func (s *pagerdutySink) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return errPagerdutyRateLimited
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respBody, _ := ioutil.ReadAll(resp.Body)
+		err := fmt.Errorf("pagerduty responded with status %d: %s", resp.StatusCode, bytes.TrimSpace(respBody))
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 {
+			return permanent(err)
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *pagerdutySink) String() string {
+	return "pagerduty"
+}
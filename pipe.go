@@ -0,0 +1,120 @@
+package sest
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// openPipe opens a named pipe for reading. Pipes cannot be seeked and have no
+// size, so they are streamed instead of being read at offsets. The pipe is
+// opened for writing as well, which does not block until a writer shows up
+// and keeps the pipe open while writers close it and reopen it later.
+func openPipe(filename string) (*LogFile, error) {
+	f, err := os.OpenFile(filename, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &LogFile{file: f, pipe: f, Filename: filename, opened: time.Now()}, nil
+}
+
+func isPipe(filename string) bool {
+	info, err := os.Stat(filename)
+	return err == nil && info.Mode()&os.ModeNamedPipe != 0
+}
+
+// IsPipe reports whether the file is a named pipe, which is read by Stream
+// instead of ReadNewLines.
+func (f *LogFile) IsPipe() bool {
+	return f.pipe != nil
+}
+
+// Stream reads the lines written to a named pipe and passes them to send in
+// chunks of at most MaxRead bytes, limiting their length and transcoding them
+// like ReadNewLines, until the file is closed or send returns false. The
+// offset counts the bytes read. Stream may be called concurrently with the
+// other methods, but the fields must not be changed while it runs.
+func (f *LogFile) Stream(send func(lines []byte) bool) {
+	splitter := lineSplitter{max: f.MaxLineLength, split: f.SplitLongLines}
+	err := readStream(f.Filename, decodeStream(f.pipe, f.Encoding), f.MaxRead, splitter, func(lines []byte) bool {
+		f.offset.Add(int64(len(lines)))
+		return send(lines)
+	})
+	if err != nil && !errors.Is(err, os.ErrClosed) {
+		slog.Warn("Could not read pipe", "file", f.Filename, "err", err)
+	}
+}
+
+// readStream reads the lines of in and passes them to send in chunks of at
+// most maxRead bytes, plus the rest of a longer line, until in is exhausted,
+// send returns false or reading fails. The lines are split by splitter, and
+// an unterminated last line is terminated, as it cannot be completed anymore.
+// name names the input in messages.
+func readStream(name string, in io.Reader, maxRead int64, splitter lineSplitter, send func(lines []byte) bool) error {
+	if maxRead <= 0 {
+		maxRead = DefaultMaxRead
+	}
+
+	buf := make([]byte, maxRead)
+	var pending []byte
+	for {
+		n, err := in.Read(buf)
+		pending = append(pending, buf[:n]...)
+		lines, consumed, long := splitter.lines(pending)
+		reportLongLines(name, long, splitter.max)
+		pending = append([]byte(nil), pending[consumed:]...)
+		if err == io.EOF && len(pending) > 0 {
+			lines = append(append(lines, bytes.TrimSuffix(pending, []byte{'\r'})...), '\n')
+		}
+		if len(lines) > 0 && !send(lines) {
+			return nil
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// pipeChunk is a chunk of lines read from a named pipe.
+type pipeChunk struct {
+	file  *LogFile
+	lines []byte
+}
+
+// streamPipe starts streaming a named pipe to the loop, until the file is
+// closed or the Runner is stopped.
+func (r *Runner) streamPipe(file *LogFile) {
+	file.MaxRead = r.cfg.Input.MaxRead
+	file.MaxLineLength = r.cfg.Input.MaxLineLength
+	file.SplitLongLines = r.cfg.Input.LongLines == "split"
+	file.Encoding = r.cfg.Input.Encoding
+	go file.Stream(func(lines []byte) bool {
+		select {
+		case r.pipes <- pipeChunk{file: file, lines: lines}:
+			return true
+		case <-r.stop:
+			return false
+		}
+	})
+}
+
+// handlePipe matches the events against a chunk read from a named pipe,
+// unless the pipe has been closed in the meantime.
+func (r *Runner) handlePipe(c pipeChunk) {
+	if r.files[c.file.Filename] != c.file {
+		return
+	}
+	c.file.lastRead = time.Now()
+	n := bytes.Count(c.lines, []byte{'\n'})
+	linesRead.WithLabelValues(c.file.Filename).Add(float64(n))
+	bytesRead.WithLabelValues(c.file.Filename).Add(float64(len(c.lines)))
+	r.counts.addLines(c.file.Filename, n)
+	fileOffset.WithLabelValues(c.file.Filename).Set(float64(c.file.GetOffset()))
+	r.matchLines(c.file.Filename, &c.file.blocks, c.lines)
+}
@@ -0,0 +1,35 @@
+package sest
+
+import "bytes"
+
+// prefiltered reports whether the event has a prefilter gating its regex.
+func (e Event) prefiltered() bool {
+	return len(e.Contains) > 0 || e.Prefilter != nil
+}
+
+// passes reports whether text passes the prefilter of the event, so the
+// regex of the event may match it. The substring is checked first, as it is
+// much cheaper than a regex.
+func (e Event) passes(text []byte) bool {
+	if len(e.Contains) > 0 && !bytes.Contains(text, e.Contains) {
+		return false
+	}
+	return e.Prefilter == nil || e.Prefilter.Match(text)
+}
+
+// matchPrefiltered matches a prefiltered event against the lines of a chunk
+// that pass its prefilter, one line at a time. Chunks without any line
+// containing the substring are skipped with a single scan.
+func (r *Runner) matchPrefiltered(event Event, filename string, lines []byte) {
+	if len(event.Contains) > 0 && !bytes.Contains(lines, event.Contains) {
+		return
+	}
+	for _, line := range splitLines(lines) {
+		if !event.passes(line) {
+			continue
+		}
+		for _, m := range event.findAll(line) {
+			r.handleMatch(m.variant, filename, line, m.submatches, nil)
+		}
+	}
+}
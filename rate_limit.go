@@ -0,0 +1,66 @@
+package sest
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimiter is a token bucket limiting how often an event is delivered. It
+// is safe for concurrent use, as files are matched concurrently.
+type rateLimiter struct {
+	mu sync.Mutex
+	// rate is the number of tokens added per second, up to burst tokens.
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	// suppressed counts the matches dropped since the last delivered one.
+	suppressed int
+}
+
+// newRateLimiter builds the limiter of a rate limit config. It returns nil if
+// the config sets no limit.
+func newRateLimiter(cfg RateLimitConfig) *rateLimiter {
+	if cfg.Events <= 0 {
+		return nil
+	}
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	burst := cfg.Burst
+	if burst <= 0 {
+		burst = cfg.Events
+	}
+	return &rateLimiter{
+		rate:   float64(cfg.Events) / interval.Seconds(),
+		burst:  float64(burst),
+		tokens: float64(burst),
+	}
+}
+
+// allow takes a token if one is available. It also returns how many matches
+// have been suppressed since the last allowed one, including the current one
+// if it is not allowed. A nil limiter allows everything.
+func (l *rateLimiter) allow(now time.Time) (ok bool, suppressed int) {
+	if l == nil {
+		return true, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	l.last = now
+
+	if l.tokens < 1 {
+		l.suppressed++
+		return false, l.suppressed
+	}
+	l.tokens--
+	suppressed, l.suppressed = l.suppressed, 0
+	return true, suppressed
+}
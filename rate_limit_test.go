@@ -0,0 +1,79 @@
+package sest
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	type step struct {
+		// at is the time of the match since the first one.
+		at         time.Duration
+		ok         bool
+		suppressed int
+	}
+	tests := []struct {
+		name  string
+		cfg   RateLimitConfig
+		steps []step
+	}{
+		{
+			name: "events per interval",
+			cfg:  RateLimitConfig{Events: 2, Interval: time.Minute},
+			steps: []step{
+				{at: 0, ok: true},
+				{at: time.Second, ok: true},
+				{at: 2 * time.Second, ok: false, suppressed: 1},
+				{at: 3 * time.Second, ok: false, suppressed: 2},
+				// A token is added every 30s.
+				{at: 30 * time.Second, ok: true, suppressed: 2},
+				{at: 31 * time.Second, ok: false, suppressed: 1},
+			},
+		},
+		{
+			name: "default interval",
+			cfg:  RateLimitConfig{Events: 1},
+			steps: []step{
+				{at: 0, ok: true},
+				{at: 500 * time.Millisecond, ok: false, suppressed: 1},
+				{at: time.Second, ok: true, suppressed: 1},
+			},
+		},
+		{
+			name: "burst",
+			cfg:  RateLimitConfig{Events: 1, Interval: time.Second, Burst: 3},
+			steps: []step{
+				{at: 0, ok: true},
+				{at: 0, ok: true},
+				{at: 0, ok: true},
+				{at: 0, ok: false, suppressed: 1},
+				{at: time.Second, ok: true, suppressed: 1},
+				// The bucket refills up to the burst only.
+				{at: time.Hour, ok: true},
+				{at: time.Hour, ok: true},
+				{at: time.Hour, ok: true},
+				{at: time.Hour, ok: false, suppressed: 1},
+			},
+		},
+		{
+			name:  "no limit",
+			cfg:   RateLimitConfig{},
+			steps: []step{{at: 0, ok: true}, {at: 0, ok: true}, {at: 0, ok: true}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newRateLimiter(tt.cfg)
+			if (l == nil) != (tt.cfg.Events == 0) {
+				t.Fatalf("newRateLimiter(%+v) = %v", tt.cfg, l)
+			}
+			start := time.Now()
+			for i, s := range tt.steps {
+				ok, suppressed := l.allow(start.Add(s.at))
+				if ok != s.ok || suppressed != s.suppressed {
+					t.Errorf("match %d at %v: allow() = %v, %d, want %v, %d", i, s.at, ok, suppressed, s.ok, s.suppressed)
+				}
+			}
+		})
+	}
+}
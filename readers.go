@@ -0,0 +1,64 @@
+package sest
+
+import (
+	"log/slog"
+	"runtime"
+)
+
+// readers returns the number of files read and matched at the same time.
+func readers(cfg Config) int {
+	if cfg.Input.Readers <= 0 {
+		return runtime.GOMAXPROCS(0)
+	}
+	return cfg.Input.Readers
+}
+
+// read reads and matches the lines appended to a file on a goroutine of its
+// own, at most Input.Readers of them at a time. A file written to while it
+// is being read is read again afterwards, so the lines of a file are matched
+// in order. While files are being read the loop leaves them alone, and only
+// replaces the events and config once waitReads returns.
+func (r *Runner) read(file *LogFile) {
+	if file == nil {
+		slog.Debug("Got event, but no file")
+		return
+	}
+	if file.IsPipe() {
+		return
+	}
+	if _, ok := r.reading[file]; ok {
+		r.reading[file] = true
+		return
+	}
+	r.reading[file] = false
+	go func() {
+		r.readSlots <- struct{}{}
+		r.readFile(file)
+		<-r.readSlots
+		r.readDone <- file
+	}()
+}
+
+// finishRead hands a file back to the loop once it has been read, starting
+// to read it again if it was written to in the meantime.
+func (r *Runner) finishRead(file *LogFile) {
+	again := r.reading[file]
+	delete(r.reading, file)
+	if again {
+		r.read(file)
+	}
+	r.limitOpenFiles()
+}
+
+// waitReads waits until no file is being read anymore.
+func (r *Runner) waitReads() {
+	for len(r.reading) > 0 {
+		r.finishRead(<-r.readDone)
+	}
+}
+
+// isReading reports whether a file is being read and must not be touched.
+func (r *Runner) isReading(file *LogFile) bool {
+	_, ok := r.reading[file]
+	return ok
+}
@@ -0,0 +1,167 @@
+package sest
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	redisTimeout    = 5 * time.Second
+	redisMinBackoff = time.Second
+	redisMaxBackoff = time.Minute
+)
+
+// redisSink PUBLISHes rendered events to the Redis channel named by the
+// channel name of the event, or the default channel. A broken connection is
+// reestablished on the next delivery, backing off exponentially while Redis
+// stays unreachable.
+type redisSink struct {
+	mu             sync.Mutex
+	addr           string
+	password       string
+	db             int
+	defaultChannel string
+	// tls, if not nil, makes connections use TLS.
+	tls     *tls.Config
+	conn    net.Conn
+	reader  *bufio.Reader
+	backoff time.Duration
+	retryAt time.Time
+}
+
+func newRedisSink(addr, password string, db int, defaultChannel string, tlsConfig *tls.Config) *redisSink {
+	return &redisSink{addr: addr, password: password, db: db, defaultChannel: defaultChannel, tls: tlsConfig}
+}
+
+func (s *redisSink) Deliver(ctx context.Context, e RenderedEvent) error {
+	channel := e.ChannelName
+	if channel == "" {
+		channel = s.defaultChannel
+	}
+	if channel == "" {
+		return permanent(errors.New("no redis channel configured"))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		if err := s.connect(ctx); err != nil {
+			return err
+		}
+	}
+	if _, err := s.command(ctx, "PUBLISH", channel, string(e.Body)); err != nil {
+		s.disconnect()
+		return err
+	}
+	return nil
+}
+
+func (s *redisSink) connect(ctx context.Context) error {
+	if now := time.Now(); now.Before(s.retryAt) {
+		return fmt.Errorf("redis unreachable, reconnecting in %v", s.retryAt.Sub(now).Round(time.Millisecond))
+	}
+
+	err := s.dial(ctx)
+	if err != nil {
+		s.disconnect()
+		if s.backoff == 0 {
+			s.backoff = redisMinBackoff
+		} else if s.backoff *= 2; s.backoff > redisMaxBackoff {
+			s.backoff = redisMaxBackoff
+		}
+		s.retryAt = time.Now().Add(s.backoff)
+		return err
+	}
+
+	s.backoff = 0
+	s.retryAt = time.Time{}
+	return nil
+}
+
+// dial connects to Redis, authenticating and selecting the database if
+// configured.
+func (s *redisSink) dial(ctx context.Context) error {
+	dialer := &net.Dialer{Timeout: redisTimeout}
+	var conn net.Conn
+	var err error
+	if s.tls != nil {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: s.tls}).DialContext(ctx, "tcp", s.addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", s.addr)
+	}
+	if err != nil {
+		return err
+	}
+	s.conn, s.reader = conn, bufio.NewReader(conn)
+
+	if s.password != "" {
+		if _, err := s.command(ctx, "AUTH", s.password); err != nil {
+			return fmt.Errorf("could not authenticate: %w", err)
+		}
+	}
+	if s.db != 0 {
+		if _, err := s.command(ctx, "SELECT", strconv.Itoa(s.db)); err != nil {
+			return fmt.Errorf("could not select database %d: %w", s.db, err)
+		}
+	}
+	return nil
+}
+
+func (s *redisSink) disconnect() {
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	s.conn, s.reader = nil, nil
+}
+
+// command sends a command in the Redis protocol and returns the reply, which
+// has to be a simple string or an integer. It times out after redisTimeout,
+// or once ctx is done.
+func (s *redisSink) command(ctx context.Context, args ...string) (string, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+
+	s.conn.SetDeadline(ioDeadline(ctx, redisTimeout))
+	if _, err := s.conn.Write([]byte(b.String())); err != nil {
+		return "", err
+	}
+	reply, err := s.reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	reply = strings.TrimRight(reply, "\r\n")
+	if reply == "" {
+		return "", errors.New("empty redis reply")
+	}
+	switch reply[0] {
+	case '+', ':':
+		return reply[1:], nil
+	case '-':
+		return "", fmt.Errorf("redis: %s", reply[1:])
+	default:
+		return "", fmt.Errorf("unexpected redis reply %q", reply)
+	}
+}
+
+func (s *redisSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.disconnect()
+	return nil
+}
+
+func (s *redisSink) String() string {
+	return "redis " + s.addr
+}
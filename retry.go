@@ -0,0 +1,89 @@
+package sest
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// Defaults of the retry config.
+const (
+	defaultRetryInterval    = 500 * time.Millisecond
+	defaultMaxRetryInterval = 30 * time.Second
+)
+
+// permanentError marks a delivery failure that retrying cannot fix, such as a
+// rejected request.
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e permanentError) Unwrap() error {
+	return e.err
+}
+
+// permanent marks err as not worth retrying.
+func permanent(err error) error {
+	return permanentError{err}
+}
+
+// retryPolicy retries failed deliveries with exponential backoff. The zero
+// value delivers once.
+type retryPolicy struct {
+	maxAttempts int
+	interval    time.Duration
+	maxInterval time.Duration
+	maxElapsed  time.Duration
+}
+
+func newRetryPolicy(cfg RetryConfig) retryPolicy {
+	p := retryPolicy{
+		maxAttempts: cfg.MaxAttempts,
+		interval:    cfg.InitialInterval,
+		maxInterval: cfg.MaxInterval,
+		maxElapsed:  cfg.MaxElapsed,
+	}
+	if p.interval <= 0 {
+		p.interval = defaultRetryInterval
+	}
+	if p.maxInterval <= 0 {
+		p.maxInterval = defaultMaxRetryInterval
+	}
+	return p
+}
+
+// do calls deliver until it succeeds, fails permanently, the attempts or the
+// elapsed time are used up or ctx is done. It returns the number of attempts
+// and the last error.
+func (p retryPolicy) do(ctx context.Context, deliver func(context.Context) error) (attempts int, err error) {
+	start := time.Now()
+	interval := p.interval
+	for {
+		attempts++
+		err = deliver(ctx)
+		var perm permanentError
+		if err == nil || errors.As(err, &perm) || attempts >= p.maxAttempts {
+			return attempts, err
+		}
+
+		// Wait between half and all of the interval, so sinks failing
+		// together are not retried in lockstep.
+		delay := interval/2 + time.Duration(rand.Int63n(int64(interval/2)+1))
+		if p.maxElapsed > 0 && time.Since(start)+delay > p.maxElapsed {
+			return attempts, err
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return attempts, err
+		}
+		if interval *= 2; interval > p.maxInterval {
+			interval = p.maxInterval
+		}
+	}
+}
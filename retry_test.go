@@ -0,0 +1,96 @@
+package sest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	failure := errors.New("connection refused")
+	tests := []struct {
+		name string
+		cfg  RetryConfig
+		// errs are returned by the attempts in order, the attempts after
+		// them succeed.
+		errs     []error
+		attempts int
+		err      error
+	}{
+		{name: "success", cfg: RetryConfig{MaxAttempts: 3}, attempts: 1},
+		{name: "fails twice", cfg: RetryConfig{MaxAttempts: 5, InitialInterval: time.Millisecond}, errs: []error{failure, failure}, attempts: 3},
+		{name: "attempts used up", cfg: RetryConfig{MaxAttempts: 3, InitialInterval: time.Millisecond}, errs: []error{failure, failure, failure, failure}, attempts: 3, err: failure},
+		{name: "no retries", errs: []error{failure}, attempts: 1, err: failure},
+		{name: "permanent", cfg: RetryConfig{MaxAttempts: 3}, errs: []error{permanent(failure)}, attempts: 1, err: failure},
+		{name: "wrapped permanent", cfg: RetryConfig{MaxAttempts: 3}, errs: []error{fmt.Errorf("webhook: %w", permanent(failure))}, attempts: 1, err: failure},
+		{name: "permanent after a retry", cfg: RetryConfig{MaxAttempts: 3, InitialInterval: time.Millisecond}, errs: []error{failure, permanent(failure)}, attempts: 2, err: failure},
+		{
+			name:     "max elapsed",
+			cfg:      RetryConfig{MaxAttempts: 10, InitialInterval: 40 * time.Millisecond, MaxElapsed: 50 * time.Millisecond},
+			errs:     []error{failure, failure, failure},
+			attempts: 2,
+			err:      failure,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newRetryPolicy(tt.cfg)
+			calls := 0
+			attempts, err := p.do(context.Background(), func(context.Context) error {
+				calls++
+				if calls <= len(tt.errs) {
+					return tt.errs[calls-1]
+				}
+				return nil
+			})
+			if attempts != tt.attempts || calls != tt.attempts {
+				t.Errorf("do() made %d attempts, reported %d, want %d", calls, attempts, tt.attempts)
+			}
+			if !errors.Is(err, tt.err) || (err == nil) != (tt.err == nil) {
+				t.Errorf("do() = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+// TestRetryPolicyBackoff checks that the waits between attempts double, up to
+// the max interval, each being at least half of its interval.
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := newRetryPolicy(RetryConfig{MaxAttempts: 5, InitialInterval: 20 * time.Millisecond, MaxInterval: 40 * time.Millisecond})
+	var times []time.Time
+	p.do(context.Background(), func(context.Context) error {
+		times = append(times, time.Now())
+		return errors.New("failure")
+	})
+	if len(times) != 5 {
+		t.Fatalf("made %d attempts, want 5", len(times))
+	}
+	for i, interval := range []time.Duration{20 * time.Millisecond, 40 * time.Millisecond, 40 * time.Millisecond, 40 * time.Millisecond} {
+		if wait := times[i+1].Sub(times[i]); wait < interval/2 {
+			t.Errorf("waited %v before attempt %d, want at least %v", wait, i+2, interval/2)
+		}
+	}
+}
+
+// TestRetryPolicyCanceled checks that failures are not retried once the
+// context is done.
+func TestRetryPolicyCanceled(t *testing.T) {
+	p := newRetryPolicy(RetryConfig{MaxAttempts: 10, InitialInterval: time.Hour})
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts, err := p.do(ctx, func(context.Context) error {
+		cancel()
+		return errors.New("failure")
+	})
+	if attempts != 1 || err == nil {
+		t.Errorf("do() = %d, %v, want 1 attempt failing", attempts, err)
+	}
+}
+
+func TestNewRetryPolicyDefaults(t *testing.T) {
+	p := newRetryPolicy(RetryConfig{MaxAttempts: 3})
+	if p.interval != defaultRetryInterval || p.maxInterval != defaultMaxRetryInterval {
+		t.Errorf("newRetryPolicy() = %+v, want the default intervals", p)
+	}
+}
@@ -0,0 +1,851 @@
+package sest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/radovskyb/watcher"
+)
+
+// Runner watches the input files of a Config and delivers the events found in
+// them. Apart from the watcher and its input filter, which are safe for
+// concurrent use, the state of a Runner is only accessed from the goroutine
+// executing Run, and from the goroutines reading files while it waits for
+// them before changing anything they use.
+type Runner struct {
+	cfg     Config
+	watcher *watcher.Watcher
+	filter  *inputFilter
+	// nameFilter is the input filter applied to the full path of files.
+	nameFilter fileFilter
+	events     []Event
+	files      map[string]*LogFile
+	// missing holds the configured files that could not be opened, which
+	// are retried until they appear.
+	missing map[string]*missingFile
+	// counts are the lines and matches of the inputs, for the status.
+	counts     *fileCounters
+	offsets    *offsetStore
+	reload     chan reloadRequest
+	statusReq  chan chan Status
+	stop       chan struct{}
+	stopOnce   sync.Once
+	dryRun     bool
+	handlers   []Sink
+	dispatcher *dispatcher
+	// multiline groups lines into blocks before matching, nil unless
+	// multiline mode is enabled.
+	multiline *multiline
+	// stdin receives the chunks read from stdin, nil unless the config
+	// enables it or once stdin is exhausted. stdinBlocks holds its pending
+	// multiline block.
+	stdin       chan []byte
+	stdinBlocks blockBuffer
+	// pipes receives the chunks streamed from named pipes.
+	pipes chan pipeChunk
+	// reading holds the files being read concurrently, mapped to whether
+	// they were written to again meanwhile. readDone receives them once
+	// they have been read and readSlots bounds the concurrent reads.
+	reading   map[*LogFile]bool
+	readDone  chan *LogFile
+	readSlots chan struct{}
+	// lastError is the last error reported by the watcher, recentErrors
+	// are the times of the errors within errorHealthWindow.
+	lastError    error
+	lastErrorAt  time.Time
+	recentErrors []time.Time
+	// err is returned by Run after the loop stopped the Runner.
+	err error
+}
+
+type reloadRequest struct {
+	cfg Config
+	err chan error
+}
+
+// Option configures a Runner.
+type Option func(*Runner)
+
+// WithDryRun makes the Runner read all files from the start, without
+// persisting offsets, and print events to stdout instead of delivering them.
+func WithDryRun() Option {
+	return func(r *Runner) {
+		r.dryRun = true
+	}
+}
+
+// OnMatch registers fn to be called with every rendered event, in addition to
+// the sinks configured for the event. fn is called from the dispatch workers,
+// concurrently if there are several, and holds up deliveries while it runs.
+func OnMatch(fn func(RenderedEvent)) Option {
+	return func(r *Runner) {
+		r.handlers = append(r.handlers, handlerSink(fn))
+	}
+}
+
+// New builds a Runner for a validated config with resolved relative paths.
+// The input files are opened right away. If the filters, multiline config or
+// events cannot be built, all their errors are returned together.
+func New(cfg Config, opts ...Option) (*Runner, error) {
+	r := &Runner{
+		cfg:       cfg,
+		filter:    &inputFilter{},
+		reload:    make(chan reloadRequest),
+		statusReq: make(chan chan Status),
+		stop:      make(chan struct{}),
+		pipes:     make(chan pipeChunk),
+		missing:   make(map[string]*missingFile),
+		counts:    newFileCounters(),
+		reading:   make(map[*LogFile]bool),
+		readDone:  make(chan *LogFile),
+		// Changes of the number of readers take effect on restart.
+		readSlots: make(chan struct{}, readers(cfg)),
+		// Changes of the dispatch config take effect on restart.
+		dispatcher: newDispatcher(cfg.Dispatch),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	if cfg.StateFile != "" && !r.dryRun {
+		offsets, err := loadOffsetStore(cfg.StateFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not load state file %s: %w", cfg.StateFile, err)
+		}
+		r.offsets = offsets
+	}
+
+	var errs []error
+	nameFilter, err := newFileFilter(cfg)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("invalid input filter: %w", err))
+	}
+	if r.multiline, err = newMultiline(cfg); err != nil {
+		errs = append(errs, fmt.Errorf("invalid multiline config: %w", err))
+	}
+	if r.events, err = r.createEvents(cfg); err != nil {
+		errs = append(errs, fmt.Errorf("could not create events: %w", err))
+	}
+	if len(errs) > 0 {
+		closeSinks(r.events)
+		return nil, errors.Join(errs...)
+	}
+
+	r.filter.set(nameFilter)
+	r.nameFilter = nameFilter
+	r.watcher = createWatcher(cfg, r.filter)
+	r.files = createLogFileList(cfg, r.offsets)
+
+	return r, nil
+}
+
+// Files returns the names of the files being read.
+func (r *Runner) Files() []string {
+	return keys(r.files)
+}
+
+// Run watches the input files until ctx is done or Stop is called, or until
+// the watcher reported MaxWatcherErrors errors, which is returned. Before
+// returning, the offsets are saved, the queued events are delivered and all
+// files and sinks are closed. A Runner can only be run once.
+//
+// Cancelling ctx stops reading; it does not cancel the deliveries, so the
+// events already matched are not lost. Delivering them is bounded by the
+// shutdown timeout of the dispatch config, and each attempt by its timeout.
+func (r *Runner) Run(ctx context.Context) error {
+	r.dispatcher.start()
+	started := make(chan struct{})
+	go func() {
+		r.watcher.Wait()
+		close(started)
+	}()
+	startErr := make(chan error, 1)
+	go func() {
+		startErr <- r.watcher.Start(r.pollInterval())
+	}()
+
+	select {
+	case err := <-startErr:
+		r.Stop()
+		r.close()
+		return err
+	case <-started:
+	}
+
+	serverCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r.serveHTTP(serverCtx, r.cfg)
+
+	// Changes of the stdin setting take effect on restart.
+	if r.cfg.Input.Stdin {
+		r.stdin = make(chan []byte)
+		go r.readStdin(decodeStream(os.Stdin, r.cfg.Input.Encoding), r.cfg.Input.MaxRead, newLineSplitter(r.cfg), r.stdin)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		r.loop()
+		close(done)
+	}()
+
+	select {
+	case <-ctx.Done():
+	case <-r.stop:
+	}
+	r.Stop()
+	r.watcher.Close()
+	<-done
+	r.close()
+	if err := <-startErr; err != nil {
+		return err
+	}
+	return r.err
+}
+
+// Stop makes Run return.
+func (r *Runner) Stop() {
+	r.stopOnce.Do(func() {
+		close(r.stop)
+	})
+}
+
+// Reload swaps in the events, input filter, watched paths and files of a new
+// config, which has to be validated and have its relative paths resolved.
+// Files that remain watched keep their offsets, and events their firing
+// alerts. If the new config cannot be applied the running one is kept and the
+// error is returned. Reload has to be called while Run is running.
+func (r *Runner) Reload(cfg Config) error {
+	req := reloadRequest{cfg: cfg, err: make(chan error, 1)}
+	select {
+	case r.reload <- req:
+		return <-req.err
+	case <-r.stop:
+		return errors.New("runner is stopped")
+	}
+}
+
+// catchUp reports whether the content already present in a file is read when
+// the file is opened instead of waiting for the next write. Compressed files
+// are not written to anymore, so they are always caught up on.
+func (r *Runner) catchUp(filename string) bool {
+	return r.dryRun || r.cfg.Input.CatchUp || isCompressed(filename)
+}
+
+func (r *Runner) pollInterval() time.Duration {
+	if r.cfg.PollInterval == 0 {
+		return DefaultPollInterval
+	}
+	return r.cfg.PollInterval
+}
+
+func (r *Runner) createEvents(cfg Config) ([]Event, error) {
+	events, err := createEventList(cfg)
+	if r.dryRun {
+		closeSinks(events)
+		for i := range events {
+			events[i].Sinks = []Sink{dryRunSink{}}
+		}
+	}
+	for i := range events {
+		events[i].Sinks = append(events[i].Sinks, r.handlers...)
+		if events[i].alert == nil {
+			continue
+		}
+		// Alerts with sinks of their own deliver to those instead, which
+		// need the handlers and the dry run just the same.
+		for _, notice := range events[i].alert.notices() {
+			if notice.sinks == nil {
+				continue
+			}
+			if r.dryRun {
+				notice.sinks = []Sink{dryRunSink{}}
+			}
+			notice.sinks = append(notice.sinks, r.handlers...)
+		}
+	}
+	return events, err
+}
+
+func (r *Runner) loop() {
+	for filename, logFile := range r.files {
+		if logFile.IsPipe() {
+			r.streamPipe(logFile)
+		} else if r.catchUp(filename) {
+			r.read(logFile)
+		}
+	}
+
+	var checkpoint <-chan time.Time
+	if r.offsets != nil {
+		ticker := time.NewTicker(offsetCheckpointInterval)
+		defer ticker.Stop()
+		checkpoint = ticker.C
+	}
+	flush := time.NewTicker(r.pollInterval())
+	defer flush.Stop()
+	idle := time.NewTicker(idleCheckInterval)
+	defer idle.Stop()
+	templates := time.NewTicker(templateCheckInterval)
+	defer templates.Stop()
+	stale := time.NewTicker(staleCheckInterval)
+	defer stale.Stop()
+	aggregates := time.NewTicker(aggregateCheckInterval)
+	defer aggregates.Stop()
+	alerts := time.NewTicker(alertCheckInterval)
+	defer alerts.Stop()
+	missing := time.NewTicker(missingCheckInterval)
+	defer missing.Stop()
+
+	for {
+		select {
+		case event := <-r.watcher.Event:
+			r.handleEvent(event)
+		case err := <-r.watcher.Error:
+			r.watcherError(err)
+		case file := <-r.readDone:
+			r.finishRead(file)
+		case <-checkpoint:
+			r.waitReads()
+			r.saveOffsets()
+		case <-flush.C:
+			for _, logFile := range r.files {
+				if !r.isReading(logFile) {
+					r.flushBlock(logFile, false)
+				}
+			}
+			r.flushBlocks(stdinName, &r.stdinBlocks, false)
+		case <-idle.C:
+			r.suspendIdleFiles()
+		case <-templates.C:
+			r.reloadTemplates()
+		case <-stale.C:
+			r.checkStaleFiles()
+		case <-aggregates.C:
+			r.flushAggregates(r.events, false)
+		case <-alerts.C:
+			r.resolveAlerts(r.events)
+		case <-missing.C:
+			r.openMissingFiles()
+		case chunk, ok := <-r.stdin:
+			if !ok {
+				r.stdin = nil
+				r.closeStdin()
+				continue
+			}
+			r.handleStdin(chunk)
+		case c := <-r.pipes:
+			r.handlePipe(c)
+		case req := <-r.reload:
+			r.waitReads()
+			req.err <- r.apply(req.cfg)
+		case req := <-r.statusReq:
+			r.waitReads()
+			req <- r.status()
+		case <-r.watcher.Closed:
+			r.waitReads()
+			if r.offsets != nil {
+				r.saveOffsets()
+			}
+			return
+		}
+	}
+}
+
+// watcherError logs an error of the watcher and carries on. If the config
+// sets a limit, too many errors within errorHealthWindow stop the Runner.
+func (r *Runner) watcherError(err error) {
+	slog.Error("Watcher error", "err", err)
+	now := time.Now()
+	r.lastError, r.lastErrorAt = err, now
+
+	recent := r.recentErrors[:0]
+	for _, at := range r.recentErrors {
+		if now.Sub(at) < errorHealthWindow {
+			recent = append(recent, at)
+		}
+	}
+	r.recentErrors = append(recent, now)
+
+	if limit := r.cfg.MaxWatcherErrors; limit > 0 && len(r.recentErrors) >= limit {
+		r.err = fmt.Errorf("%d watcher errors within %v, the last one: %w", len(r.recentErrors), errorHealthWindow, err)
+		r.Stop()
+	}
+}
+
+func (r *Runner) handleEvent(e watcher.Event) {
+	if e.IsDir() {
+		return
+	}
+	if e.Op != watcher.Write {
+		// Other changes rearrange the files, which must not be read
+		// meanwhile.
+		r.waitReads()
+	}
+	switch e.Op {
+	case watcher.Write:
+		r.read(r.files[e.Path])
+	case watcher.Create:
+		r.addFile(e.Path)
+	case watcher.Remove:
+		r.removeFile(e.Path)
+	case watcher.Rename, watcher.Move:
+		r.renameFile(e.OldPath, e.Path)
+	}
+}
+
+// addFile starts reading a file that appeared in a watched directory. A file
+// that has already been read under another name, i.e. one that was rotated
+// away from that name, continues at the offset read so far.
+func (r *Runner) addFile(filename string) {
+	if _, ok := r.files[filename]; ok || !r.accepts(filename) {
+		return
+	}
+
+	var logFile *LogFile
+	var err error
+	if offset, ok := r.readOffset(filename); ok {
+		logFile, err = NewLogFile(filename, offset)
+	} else {
+		// The file is new, so all of it is read regardless of start_at.
+		logFile, err = openLogFile(filename, r.offsets, false)
+	}
+	if err != nil {
+		slog.Warn("Could not watch file", "file", filename, "err", err)
+		return
+	}
+
+	slog.Info("Watching new file", "file", filename)
+	r.files[filename] = logFile
+	if logFile.IsPipe() {
+		r.streamPipe(logFile)
+		return
+	}
+	// Lines written before the file was noticed do not cause a write event.
+	r.handleWrite(logFile)
+}
+
+// readOffset looks for a log file that has read the file at filename under
+// another name. Such a log file is brought up to date first, which lets it
+// notice the rotation.
+func (r *Runner) readOffset(filename string) (int64, bool) {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return 0, false
+	}
+	for _, logFile := range r.files {
+		if logFile.IsFile(info) {
+			r.handleWrite(logFile)
+		}
+		if offset, ok := logFile.OffsetOf(info); ok {
+			return offset, true
+		}
+	}
+	return 0, false
+}
+
+// removeFile stops reading a file that was deleted, after reading the lines
+// that are still pending. If the path has been recreated in the meantime the
+// file was rotated and reading continues with the new file.
+func (r *Runner) removeFile(filename string) {
+	logFile := r.files[filename]
+	if logFile == nil {
+		return
+	}
+	r.handleWrite(logFile)
+	if _, err := os.Stat(filename); err == nil {
+		return
+	}
+	slog.Info("Stopped watching removed file", "file", filename)
+	r.closeFile(logFile)
+	delete(r.files, filename)
+}
+
+// renameFile follows a file to its new name when that name is watched as well.
+// Otherwise it is handled like a removal of the old name.
+func (r *Runner) renameFile(oldName, newName string) {
+	logFile := r.files[oldName]
+	if logFile == nil {
+		r.addFile(newName)
+		return
+	}
+	r.handleWrite(logFile)
+
+	if _, err := os.Stat(oldName); err == nil {
+		// The old name was recreated and is read as a new file.
+		r.addFile(newName)
+		return
+	}
+
+	delete(r.files, oldName)
+	if _, ok := r.files[newName]; ok || !r.accepts(newName) {
+		slog.Info("Stopped watching renamed file", "file", oldName)
+		r.closeFile(logFile)
+		return
+	}
+	slog.Info("Following renamed file", "file", oldName, "new_name", newName)
+	fileOffset.DeleteLabelValues(oldName)
+	r.counts.rename(oldName, newName)
+	logFile.Filename = newName
+	r.files[newName] = logFile
+}
+
+func (r *Runner) accepts(filename string) bool {
+	return r.nameFilter.accepts(filename)
+}
+
+func (r *Runner) saveOffsets() {
+	r.offsets.Update(r.files)
+	if err := r.offsets.Save(); err != nil {
+		slog.Error("Could not save offsets", "err", err)
+	}
+}
+
+func (r *Runner) apply(cfg Config) error {
+	nameFilter, err := newFileFilter(cfg)
+	if err != nil {
+		return err
+	}
+	multiline, err := newMultiline(cfg)
+	if err != nil {
+		return err
+	}
+	events, err := r.createEvents(cfg)
+	if err != nil {
+		closeSinks(events)
+		return err
+	}
+
+	r.filter.set(nameFilter)
+	r.nameFilter = nameFilter
+	r.multiline = multiline
+	r.updateWatchedPaths(cfg)
+
+	r.flushAggregates(r.events, true)
+	carryAlerts(r.events, events)
+	r.dispatcher.replace(r.events)
+	r.events = events
+	r.cfg = cfg
+	// New files are opened last, so catching up on them uses the new events.
+	r.updateFiles(cfg)
+	return nil
+}
+
+func (r *Runner) updateWatchedPaths(cfg Config) {
+	oldPaths := watchedPaths(r.cfg)
+	newPaths := watchedPaths(cfg)
+	removed := differencePaths(oldPaths, newPaths)
+	added := differencePaths(newPaths, oldPaths)
+
+	// The watcher holds its lock while sending events, so it must not be
+	// modified from the goroutine receiving them.
+	go func() {
+		for _, p := range removed {
+			if err := r.watcher.Remove(p.Name); err != nil {
+				slog.Warn("Could not stop watching path", "path", p.Name, "err", err)
+			}
+		}
+		for _, p := range added {
+			addWatchedPath(r.watcher, p)
+		}
+	}()
+}
+
+func (r *Runner) updateFiles(cfg Config) {
+	filenames := inputFilenames(cfg)
+
+	for _, filename := range difference(keys(r.files), filenames) {
+		r.closeFile(r.files[filename])
+		delete(r.files, filename)
+	}
+
+	for _, filename := range filenames {
+		if _, ok := r.files[filename]; ok {
+			continue
+		}
+		logFile, err := openLogFile(filename, r.offsets, cfg.Input.StartAt == "end")
+		if err != nil {
+			slog.Warn("Could not watch file", "file", filename, "err", err)
+			continue
+		}
+		if cfg.Input.LazyOpen {
+			logFile.Suspend()
+		}
+		r.files[filename] = logFile
+		if logFile.IsPipe() {
+			r.streamPipe(logFile)
+		} else if r.catchUp(filename) {
+			r.handleWrite(logFile)
+		}
+	}
+}
+
+// close closes the files, delivers the events still queued and closes the
+// sinks.
+func (r *Runner) close() {
+	for _, logFile := range r.files {
+		r.closeFile(logFile)
+	}
+	r.flushAggregates(r.events, true)
+	r.dispatcher.close()
+	closeSinks(r.events)
+}
+
+// handleWrite matches the lines appended to a file right away, unlike read.
+func (r *Runner) handleWrite(file *LogFile) {
+	if file == nil {
+		slog.Debug("Got event, but no file")
+		return
+	}
+	r.readFile(file)
+	r.limitOpenFiles()
+}
+
+// readFile matches the lines appended to a file, reading them chunk by chunk.
+func (r *Runner) readFile(file *LogFile) {
+	if file.IsPipe() {
+		// Pipes are streamed by streamPipe.
+		return
+	}
+	file.MaxRead = r.cfg.Input.MaxRead
+	file.MaxLineLength = r.cfg.Input.MaxLineLength
+	file.SplitLongLines = r.cfg.Input.LongLines == "split"
+	file.Encoding = r.cfg.Input.Encoding
+	for r.readChunk(file) && file.More() {
+	}
+}
+
+// readChunk matches the next chunk of lines of a file. It returns false if the
+// file could not be read.
+func (r *Runner) readChunk(file *LogFile) bool {
+	oldOffset := file.GetOffset()
+	lines, err := file.ReadNewLines()
+	if err != nil {
+		slog.Warn("Could not read file", "file", file.Filename, "err", err)
+	}
+	slog.Debug("Read new lines", "file", file.Filename, "old_offset", oldOffset, "offset", file.GetOffset())
+	n := bytes.Count(lines, []byte{'\n'})
+	linesRead.WithLabelValues(file.Filename).Add(float64(n))
+	bytesRead.WithLabelValues(file.Filename).Add(float64(len(lines)))
+	r.counts.addLines(file.Filename, n)
+	fileOffset.WithLabelValues(file.Filename).Set(float64(file.GetOffset()))
+
+	r.matchLines(file.Filename, &file.blocks, lines)
+	return err == nil
+}
+
+// matchLines matches the events against lines read from an input, grouping
+// them into blocks in multiline mode.
+func (r *Runner) matchLines(filename string, blocks *blockBuffer, lines []byte) {
+	if r.multiline == nil {
+		// A block may be left over from before multiline mode was disabled.
+		r.flushBlocks(filename, blocks, true)
+		r.matchText(filename, lines, false)
+		return
+	}
+	for _, block := range r.multiline.split(blocks, lines, time.Now()) {
+		r.matchText(filename, block, true)
+	}
+}
+
+// flushBlock matches the pending multiline block of a file once it has timed
+// out, or right away if force is set.
+func (r *Runner) flushBlock(file *LogFile, force bool) {
+	r.flushBlocks(file.Filename, &file.blocks, force)
+}
+
+func (r *Runner) flushBlocks(filename string, blocks *blockBuffer, force bool) {
+	if block := r.multiline.flush(blocks, time.Now(), force); block != nil {
+		r.matchText(filename, block, true)
+	}
+}
+
+// closeFile stops reading a file, matching its pending multiline block first.
+func (r *Runner) closeFile(file *LogFile) {
+	r.flushBlock(file, true)
+	file.Close()
+	r.counts.remove(file.Filename)
+	fileOffset.DeleteLabelValues(file.Filename)
+	staleFiles.DeleteLabelValues(file.Filename)
+}
+
+// matchText matches the events against text read from a file, either a chunk
+// of lines or a multiline block. Events with a structured format decode the
+// text line by line, or block by block.
+func (r *Runner) matchText(filename string, text []byte, block bool) {
+	var plain, structured []Event
+	for _, event := range r.events {
+		if event.stale {
+			continue
+		}
+		if event.Format == "" {
+			plain = append(plain, event)
+		} else {
+			structured = append(structured, event)
+		}
+	}
+	r.matchEvents(plain, filename, text, block)
+	if len(structured) == 0 {
+		return
+	}
+
+	fallback := r.cfg.Input.Fallback == "text"
+	if block {
+		r.matchRecord(structured, filename, text, fallback)
+		return
+	}
+	for _, line := range splitLines(text) {
+		r.matchRecord(structured, filename, line, fallback)
+	}
+}
+
+// matchEvents matches the events against text lines, or a multiline block if
+// block is set. Events filtering on fields never match text, and empty
+// matches are skipped.
+func (r *Runner) matchEvents(events []Event, filename string, lines []byte, block bool) {
+	for _, event := range events {
+		if len(event.Fields) > 0 {
+			continue
+		}
+		slog.Debug("Looking for event", "event_type", event.EventType)
+		if event.prefiltered() {
+			if !block {
+				r.matchPrefiltered(event, filename, lines)
+				continue
+			}
+			if !event.passes(lines) {
+				continue
+			}
+		}
+		for _, m := range event.findAll(lines) {
+			r.handleMatch(m.variant, filename, lines, m.submatches, nil)
+		}
+	}
+}
+
+// handleMatch renders a match and queues it for delivery, unless it is a
+// duplicate or exceeds the rate limit of the event. Matches of aggregated
+// events are only counted, for their summary, and repeats of firing alerts
+// are suppressed.
+func (r *Runner) handleMatch(event Event, filename string, text []byte, submatches []int, doc map[string]interface{}) {
+	slog.Debug("Found event", "event_type", event.EventType, "file", filename)
+	matches.WithLabelValues(event.EventType).Inc()
+	if !event.stale {
+		r.counts.addMatch(filename)
+	}
+	if !event.schedule.active(time.Now()) {
+		offSchedule.WithLabelValues(event.EventType).Inc()
+		return
+	}
+	if !event.sampler.keep(event, text, submatches, doc) {
+		sampledOut.WithLabelValues(event.EventType).Inc()
+		return
+	}
+	if event.aggregate != nil {
+		event.aggregate.add(event, filename, text, submatches, doc)
+		return
+	}
+	var sent bool
+	if event.alert != nil {
+		key := event.alert.fingerprint(event, text, submatches, doc)
+		doc = firingData(doc)
+		if !event.alert.fire(key, filename, text, submatches, doc, time.Now()) {
+			return
+		}
+		// An alert whose firing event is dropped has not fired, so that the
+		// next match fires it and no resolved event follows.
+		alert := event.alert
+		defer func() {
+			if !sent {
+				alert.unfire(key)
+			}
+		}()
+		event = event.alert.fired.apply(event)
+	}
+	rendered, ok, err := event.renderUnique(filename, text, submatches, doc)
+	if err != nil {
+		slog.Warn("Could not render event", "event_type", event.EventType, "err", err)
+		return
+	}
+	if !ok {
+		return
+	}
+	ok, suppressed := event.limiter.allow(time.Now())
+	if !ok {
+		if suppressed == 1 {
+			slog.Warn("Rate limit of event reached, dropping matches", "event_type", event.EventType)
+		}
+		return
+	}
+	if suppressed > 0 {
+		slog.Info("Rate limit of event suppressed matches", "event_type", event.EventType, "count", suppressed)
+	}
+	r.dispatcher.enqueue(event, rendered)
+	sent = true
+}
+
+// inputFilter skips watched files rejected by the file filter. Directories
+// always pass, so the files below them are still considered. The filter can be
+// swapped while the watcher is running.
+type inputFilter struct {
+	mu sync.Mutex
+	f  fileFilter
+}
+
+func (f *inputFilter) set(filter fileFilter) {
+	f.mu.Lock()
+	f.f = filter
+	f.mu.Unlock()
+}
+
+func (f *inputFilter) hook(info os.FileInfo, fullPath string) error {
+	f.mu.Lock()
+	filter := f.f
+	f.mu.Unlock()
+	if info.IsDir() || filter.accepts(fullPath) {
+		return nil
+	}
+	return watcher.ErrSkip
+}
+
+// difference returns the elements of a that are not in b.
+func difference(a, b []string) []string {
+	inB := make(map[string]bool, len(b))
+	for _, v := range b {
+		inB[v] = true
+	}
+	var diff []string
+	for _, v := range a {
+		if !inB[v] {
+			diff = append(diff, v)
+		}
+	}
+	return diff
+}
+
+func differencePaths(a, b []watchedPath) []watchedPath {
+	inB := make(map[watchedPath]bool, len(b))
+	for _, p := range b {
+		inB[p] = true
+	}
+	var diff []watchedPath
+	for _, p := range a {
+		if !inB[p] {
+			diff = append(diff, p)
+		}
+	}
+	return diff
+}
+
+func keys(files map[string]*LogFile) []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	return names
+}
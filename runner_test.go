@@ -0,0 +1,308 @@
+package sest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// loadTestConfig loads a config from content, with its relative paths
+// resolved to dir, and validates it.
+func loadTestConfig(t *testing.T, dir, content string) Config {
+	t.Helper()
+	filename := filepath.Join(dir, "config.yml")
+	if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadConfig(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.ResolveRelativePaths(dir)
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+// startRunner runs a Runner for cfg until ctx is done, sending the events it
+// renders to the returned channel. The error of Run is sent to done.
+func startRunner(t *testing.T, ctx context.Context, cfg Config) (events <-chan RenderedEvent, done <-chan error) {
+	t.Helper()
+	matches := make(chan RenderedEvent, 100)
+	r, err := New(cfg, OnMatch(func(e RenderedEvent) { matches <- e }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := make(chan error, 1)
+	go func() { errs <- r.Run(ctx) }()
+	return matches, errs
+}
+
+// runTestConfig runs a Runner until the test ends, with the config content
+// in a directory of its own, next to an empty app.log. It returns the path of
+// app.log and the events the Runner renders.
+func runTestConfig(t *testing.T, content string) (logFile string, events <-chan RenderedEvent) {
+	t.Helper()
+	dir := t.TempDir()
+	logFile = filepath.Join(dir, "app.log")
+	appendFile(t, logFile, "")
+	ctx, cancel := context.WithCancel(context.Background())
+	events, done := startRunner(t, ctx, loadTestConfig(t, dir, content))
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return logFile, events
+}
+
+// nextEvent returns the next event rendered by a Runner.
+func nextEvent(t *testing.T, events <-chan RenderedEvent) RenderedEvent {
+	t.Helper()
+	select {
+	case e := <-events:
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event rendered")
+		return RenderedEvent{}
+	}
+}
+
+// TestRunnerShutdownOnSignal interrupts a running Runner and checks that it
+// delivered the matched events and saved the offsets before returning.
+func TestRunnerShutdownOnSignal(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("interrupts cannot be sent on windows")
+	}
+	dir := t.TempDir()
+	appendFile(t, filepath.Join(dir, "app.log"), "")
+	cfg := loadTestConfig(t, dir, `
+input:
+  files: [app.log]
+poll_interval: 10ms
+state_file: sest.state
+events:
+  failed:
+    src: 'login of (\w+) failed'
+    template: '{{.group1}}'
+    event_type: LoginFailed
+    output_file: events.log
+`)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	events, done := startRunner(t, ctx, cfg)
+
+	appendFile(t, filepath.Join(dir, "app.log"), "login of alice failed\n")
+	if e := nextEvent(t, events); string(e.Body) != "alice" {
+		t.Errorf("got event %q, want alice", e.Body)
+	}
+	process, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := process.Signal(os.Interrupt); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Run() = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() did not return after the interrupt")
+	}
+
+	if output, err := os.ReadFile(filepath.Join(dir, "events.log")); err != nil || string(output) != "alice\n" {
+		t.Errorf("output file has %q, %v, want the delivered event", output, err)
+	}
+	content, err := os.ReadFile(filepath.Join(dir, "sest.state"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var states map[string]fileState
+	if err := json.Unmarshal(content, &states); err != nil {
+		t.Fatal(err)
+	}
+	if state := states[filepath.Join(dir, "app.log")]; state.Offset != int64(len("login of alice failed\n")) {
+		t.Errorf("saved offset %d, want the end of the file", state.Offset)
+	}
+}
+
+// TestRunnerSkipsFailedRenders checks that an event whose template fails to
+// execute is not delivered, and that matching goes on.
+func TestRunnerSkipsFailedRenders(t *testing.T) {
+	logFile, events := runTestConfig(t, `
+input:
+  files: [app.log]
+poll_interval: 10ms
+events:
+  broken:
+    src: 'broken (\w+)'
+    template: '{{index .group1 5}}'
+  valid:
+    src: 'valid (\w+)'
+    template: '{{.group1}}'
+`)
+	appendFile(t, logFile, "broken one\nvalid two\n")
+	if e := nextEvent(t, events); string(e.Body) != "two" {
+		t.Errorf("got event %q, want only the valid one", e.Body)
+	}
+}
+
+// TestRunnerCRLFLines checks that matches and capture groups of lines ending
+// in CRLF do not carry the carriage return.
+func TestRunnerCRLFLines(t *testing.T) {
+	logFile, events := runTestConfig(t, `
+input:
+  files: [app.log]
+poll_interval: 10ms
+events:
+  login:
+    src: 'login of ([^\n]+)'
+    template: '{{.group0}}|{{.group1}}|'
+`)
+	appendFile(t, logFile, "login of alice\r\nlogin of bob\nlogin of carol\r\n")
+	for _, want := range []string{"login of alice|alice|", "login of bob|bob|", "login of carol|carol|"} {
+		if e := nextEvent(t, events); string(e.Body) != want {
+			t.Errorf("got event %q, want %q", e.Body, want)
+		}
+	}
+}
+
+// TestRunnerEmptyMatches checks that a src matching the empty string does not
+// deliver an event between every two characters.
+func TestRunnerEmptyMatches(t *testing.T) {
+	logFile, events := runTestConfig(t, `
+input:
+  files: [app.log]
+poll_interval: 10ms
+events:
+  x:
+    src: 'x*'
+    template: 'match {{.group0}}'
+`)
+	appendFile(t, logFile, "abc\naxxb\n")
+	if e := nextEvent(t, events); string(e.Body) != "match xx" {
+		t.Errorf("got event %q, want match xx", e.Body)
+	}
+	select {
+	case e := <-events:
+		t.Errorf("got event %q, want only one", e.Body)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// TestRunnerReadsChunks checks that a write larger than max_read is matched
+// completely, chunk by chunk.
+func TestRunnerReadsChunks(t *testing.T) {
+	logFile, events := runTestConfig(t, `
+input:
+  files: [app.log]
+  max_read: 64
+poll_interval: 10ms
+events:
+  line:
+    src: 'line (\d+)'
+    template: '{{.group1}}'
+`)
+	var lines strings.Builder
+	for i := 0; i < 50; i++ {
+		fmt.Fprintf(&lines, "line %d\n", i)
+	}
+	appendFile(t, logFile, lines.String())
+	for i := 0; i < 50; i++ {
+		if e := nextEvent(t, events); string(e.Body) != strconv.Itoa(i) {
+			t.Fatalf("got event %q, want %d", e.Body, i)
+		}
+	}
+}
+
+// TestRunnerTemplates checks that events render inline templates and
+// templates read from files alike.
+func TestRunnerTemplates(t *testing.T) {
+	dir := t.TempDir()
+	appendFile(t, filepath.Join(dir, "app.log"), "")
+	if err := os.WriteFile(filepath.Join(dir, "failed.tmpl"), []byte("file {{.group1}}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := loadTestConfig(t, dir, `
+input:
+  files: [app.log]
+poll_interval: 10ms
+events:
+  failed:
+    src: 'login of (\w+) failed'
+    dest: failed.tmpl
+  succeeded:
+    src: 'login of (\w+) succeeded'
+    template: 'inline {{.group1}}'
+`)
+	ctx, cancel := context.WithCancel(context.Background())
+	events, done := startRunner(t, ctx, cfg)
+	defer func() {
+		cancel()
+		<-done
+	}()
+	appendFile(t, filepath.Join(dir, "app.log"), "login of alice failed\n")
+	if e := nextEvent(t, events); string(e.Body) != "file alice" {
+		t.Errorf("got event %q, want file alice", e.Body)
+	}
+	appendFile(t, filepath.Join(dir, "app.log"), "login of bob succeeded\n")
+	if e := nextEvent(t, events); string(e.Body) != "inline bob" {
+		t.Errorf("got event %q, want inline bob", e.Body)
+	}
+}
+
+// TestNewErrors checks that New returns the errors of all parts of a config
+// it cannot build, instead of running without them.
+func TestNewErrors(t *testing.T) {
+	valid := map[string]EventConfig{"e": {Src: Patterns{"a"}, Template: "b"}}
+	tests := []struct {
+		name      string
+		configure func(cfg *Config)
+		// errs are substrings of the error, which is nil if there are none.
+		errs []string
+	}{
+		{name: "valid", configure: func(cfg *Config) {}},
+		{name: "input filter", configure: func(cfg *Config) { cfg.Input.Filter = "(" }, errs: []string{"invalid input filter: could not compile input filter ("}},
+		{name: "multiline start", configure: func(cfg *Config) { cfg.Input.Multiline.Start = "[" }, errs: []string{"invalid multiline config: could not compile multiline start ["}},
+		{name: "event src", configure: func(cfg *Config) {
+			cfg.Events = map[string]EventConfig{"broken": {Src: Patterns{"("}, Template: "b"}}
+		}, errs: []string{"could not create events", "for event broken"}},
+		{name: "all of them", configure: func(cfg *Config) {
+			cfg.Input.Exclude = "("
+			cfg.Input.Multiline.Start = "["
+			cfg.Events = map[string]EventConfig{"broken": {Src: Patterns{"a"}, Template: "{{"}}
+		}, errs: []string{"could not compile input exclude (", "could not compile multiline start [", "could not parse template"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Config{Events: valid}
+			cfg.Input.Files = []string{filepath.Join(t.TempDir(), "app.log")}
+			tt.configure(&cfg)
+			r, err := New(cfg)
+			if len(tt.errs) == 0 {
+				if err != nil {
+					t.Errorf("New() = %v", err)
+				}
+				return
+			}
+			if r != nil || err == nil {
+				t.Fatalf("New() = %v, %v, want an error", r, err)
+			}
+			for _, want := range tt.errs {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("New() = %v, want an error containing %q", err, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package sest
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"strconv"
+)
+
+// sampler passes on a fraction of the matches of an event, at random, or by
+// the hash of a capture group or field, so that all matches with the same
+// value of it are either kept or dropped. It is safe for concurrent use.
+type sampler struct {
+	rate float64
+	// key is the name or number of the capture group, or the name of the
+	// decoded field, hashed to decide, empty to decide at random.
+	key string
+}
+
+// newSampler returns nil if rate keeps every match.
+func newSampler(rate float64, key string) *sampler {
+	if rate <= 0 || rate >= 1 {
+		return nil
+	}
+	return &sampler{rate: rate, key: key}
+}
+
+// keep reports whether a match of e is kept. A nil sampler keeps everything.
+func (s *sampler) keep(e Event, text []byte, submatches []int, doc map[string]interface{}) bool {
+	if s == nil {
+		return true
+	}
+	if s.key == "" {
+		return rand.Float64() < s.rate
+	}
+	h := fnv.New64a()
+	h.Write([]byte(sampleValue(s.key, e, text, submatches, doc)))
+	// The top 53 bits of the mixed hash, as a fraction of 1.
+	return float64(mix64(h.Sum64())>>11)/(1<<53) < s.rate
+}
+
+// mix64 is the finalizer of SplitMix64, spreading the hashes of short values,
+// which FNV leaves close together, over all bits.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// sampleValue returns the value of the capture group named or numbered key in
+// a match, or else of the decoded field named key.
+func sampleValue(key string, e Event, text []byte, submatches []int, doc map[string]interface{}) string {
+	i, err := strconv.Atoi(key)
+	if err != nil {
+		i = -1
+		for j, name := range e.GroupNames {
+			if name == key {
+				i = j
+				break
+			}
+		}
+	}
+	if i >= 0 && 2*i+1 < len(submatches) && submatches[2*i] >= 0 {
+		return string(text[submatches[2*i]:submatches[2*i+1]])
+	}
+	if value, ok := doc[key]; ok {
+		return fieldString(value)
+	}
+	return ""
+}
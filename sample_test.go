@@ -0,0 +1,133 @@
+package sest
+
+import (
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+func TestNewSampler(t *testing.T) {
+	tests := []struct {
+		rate float64
+		nil  bool
+	}{
+		{rate: 0, nil: true},
+		{rate: 1, nil: true},
+		{rate: 0.5},
+		{rate: 0.001},
+	}
+	for _, tt := range tests {
+		if s := newSampler(tt.rate, ""); (s == nil) != tt.nil {
+			t.Errorf("newSampler(%v) = %v", tt.rate, s)
+		}
+	}
+	var s *sampler
+	if !s.keep(Event{}, nil, nil, nil) {
+		t.Error("keep() of a nil sampler = false, want all matches kept")
+	}
+}
+
+// TestSamplerRate checks that roughly the sample rate of the matches is kept,
+// at random and by the hashes of distinct values alike.
+func TestSamplerRate(t *testing.T) {
+	re := regexp.MustCompile(`user (\w+)`)
+	e := Event{Regex: re, GroupNames: re.SubexpNames()}
+	tests := []struct {
+		name string
+		rate float64
+		key  string
+	}{
+		{name: "random", rate: 0.25},
+		{name: "random tenth", rate: 0.1},
+		{name: "keyed", rate: 0.25, key: "1"},
+		{name: "keyed tenth", rate: 0.1, key: "1"},
+	}
+	const n = 20000
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSampler(tt.rate, tt.key)
+			kept := 0
+			for i := 0; i < n; i++ {
+				text := []byte("user u" + strconv.Itoa(i))
+				if s.keep(e, text, re.FindSubmatchIndex(text), nil) {
+					kept++
+				}
+			}
+			if got := float64(kept) / n; got < tt.rate*0.8 || got > tt.rate*1.2 {
+				t.Errorf("kept %v of the matches, want about %v", got, tt.rate)
+			}
+		})
+	}
+}
+
+// TestSamplerKey checks that matches with the same value of the sample key
+// are all kept or all dropped, whichever match they come from.
+func TestSamplerKey(t *testing.T) {
+	re := regexp.MustCompile(`(?P<host>\S+) connected from (\S+)`)
+	e := Event{Regex: re, GroupNames: re.SubexpNames()}
+	tests := []struct {
+		name string
+		key  string
+		// keep returns the text and decoded document of the i-th match with
+		// the value of the key v.
+		keep func(v string, i int) (string, map[string]interface{})
+	}{
+		{name: "group name", key: "host", keep: func(v string, i int) (string, map[string]interface{}) {
+			return v + " connected from 10.0.0." + strconv.Itoa(i), nil
+		}},
+		{name: "group number", key: "2", keep: func(v string, i int) (string, map[string]interface{}) {
+			return "host" + strconv.Itoa(i) + " connected from " + v, nil
+		}},
+		{name: "field", key: "user", keep: func(v string, i int) (string, map[string]interface{}) {
+			return "host" + strconv.Itoa(i) + " connected from a", map[string]interface{}{"user": v}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSampler(0.5, tt.key)
+			decisions := map[bool]int{}
+			for v := 0; v < 50; v++ {
+				var first bool
+				for i := 0; i < 10; i++ {
+					text, doc := tt.keep("v"+strconv.Itoa(v), i)
+					kept := s.keep(e, []byte(text), re.FindStringSubmatchIndex(text), doc)
+					if i == 0 {
+						first = kept
+						decisions[kept]++
+					} else if kept != first {
+						t.Fatalf("keep() of match %d with value v%d = %v, want %v like the first", i, v, kept, first)
+					}
+				}
+			}
+			if decisions[true] == 0 || decisions[false] == 0 {
+				t.Errorf("kept %d and dropped %d of 50 values, want some of both", decisions[true], decisions[false])
+			}
+		})
+	}
+}
+
+func TestSampleValue(t *testing.T) {
+	re := regexp.MustCompile(`(?P<user>\w+) from (\w+)?`)
+	e := Event{Regex: re, GroupNames: re.SubexpNames()}
+	doc := map[string]interface{}{"host": "web-1", "port": 8080.0}
+	tests := []struct {
+		key  string
+		text string
+		want string
+	}{
+		{key: "user", text: "alice from home", want: "alice"},
+		{key: "1", text: "alice from home", want: "alice"},
+		{key: "2", text: "alice from home", want: "home"},
+		{key: "0", text: "alice from home", want: "alice from home"},
+		{key: "2", text: "alice from ", want: ""},
+		{key: "3", text: "alice from home", want: ""},
+		{key: "host", text: "alice from home", want: "web-1"},
+		{key: "port", text: "alice from home", want: "8080"},
+		{key: "missing", text: "alice from home", want: ""},
+	}
+	for _, tt := range tests {
+		if got := sampleValue(tt.key, e, []byte(tt.text), re.FindStringSubmatchIndex(tt.text), doc); got != tt.want {
+			t.Errorf("sampleValue(%q) of %q = %q, want %q", tt.key, tt.text, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package sest
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// weekdays maps the names of the days of a schedule to weekdays.
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+// schedule is the time an event is active in, the union of its windows.
+type schedule struct {
+	location *time.Location
+	windows  []scheduleWindow
+}
+
+// scheduleWindow is active from from to to, in minutes since midnight, on
+// its days. A window ending before it starts runs past midnight into the
+// next day.
+type scheduleWindow struct {
+	days     [7]bool
+	from, to int
+}
+
+// newSchedule builds the schedule of a config, in the time zone of the
+// config or else location. It returns nil if the config has no windows,
+// leaving the event always active.
+func newSchedule(cfg ScheduleConfig, location *time.Location) (*schedule, error) {
+	if len(cfg.Windows) == 0 {
+		return nil, nil
+	}
+	s := &schedule{location: location}
+	if cfg.Timezone != "" {
+		var err error
+		if s.location, err = time.LoadLocation(cfg.Timezone); err != nil {
+			return nil, fmt.Errorf("unknown schedule timezone %s", cfg.Timezone)
+		}
+	}
+	if s.location == nil {
+		s.location = time.Local
+	}
+	for i, w := range cfg.Windows {
+		window, err := newScheduleWindow(w)
+		if err != nil {
+			return nil, fmt.Errorf("schedule window %d: %w", i+1, err)
+		}
+		s.windows = append(s.windows, window)
+	}
+	return s, nil
+}
+
+func newScheduleWindow(cfg ScheduleWindow) (scheduleWindow, error) {
+	var w scheduleWindow
+	var err error
+	if w.from, err = parseTimeOfDay(cfg.From, 0); err != nil {
+		return w, fmt.Errorf("from: %w", err)
+	}
+	if w.to, err = parseTimeOfDay(cfg.To, 24*60); err != nil {
+		return w, fmt.Errorf("to: %w", err)
+	}
+	if w.from == w.to {
+		return w, fmt.Errorf("from and to are both %s", cfg.From)
+	}
+	if len(cfg.Days) == 0 {
+		for i := range w.days {
+			w.days[i] = true
+		}
+		return w, nil
+	}
+	for _, day := range cfg.Days {
+		first, last, isRange := strings.Cut(strings.ToLower(strings.TrimSpace(day)), "-")
+		if !isRange {
+			last = first
+		}
+		start, ok := weekdays[strings.TrimSpace(first)]
+		end, ok2 := weekdays[strings.TrimSpace(last)]
+		if !ok || !ok2 {
+			return w, fmt.Errorf("unknown day %s", day)
+		}
+		// Ranges like fri-mon wrap around the weekend.
+		for d := start; ; d = (d + 1) % 7 {
+			w.days[d] = true
+			if d == end {
+				break
+			}
+		}
+	}
+	return w, nil
+}
+
+// parseTimeOfDay parses a time like 09:30 into minutes since midnight, or
+// returns empty if the time is empty. 24:00 is the end of the day.
+func parseTimeOfDay(s string, empty int) (int, error) {
+	switch s {
+	case "":
+		return empty, nil
+	case "24:00":
+		return 24 * 60, nil
+	}
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %s, expected HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// active reports whether the schedule is active at t. A nil schedule always
+// is.
+func (s *schedule) active(t time.Time) bool {
+	if s == nil {
+		return true
+	}
+	t = t.In(s.location)
+	minute := t.Hour()*60 + t.Minute()
+	day := t.Weekday()
+	for _, w := range s.windows {
+		if w.from < w.to {
+			if w.days[day] && minute >= w.from && minute < w.to {
+				return true
+			}
+			continue
+		}
+		// The window started today, or yesterday and runs past midnight.
+		if w.days[day] && minute >= w.from || w.days[(day+6)%7] && minute < w.to {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,186 @@
+package sest
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScheduleActive(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip(err)
+	}
+	// January 1, 2024 is a Monday.
+	day := func(day, hour, minute int) time.Time {
+		return time.Date(2024, time.January, day, hour, minute, 0, 0, time.UTC)
+	}
+	businessHours := ScheduleConfig{Windows: []ScheduleWindow{{Days: []string{"mon-fri"}, From: "09:00", To: "17:00"}}}
+	tests := []struct {
+		name     string
+		cfg      ScheduleConfig
+		location *time.Location
+		times    map[time.Time]bool
+	}{
+		{
+			name: "business hours",
+			cfg:  businessHours,
+			times: map[time.Time]bool{
+				day(1, 9, 0):   true,
+				day(1, 8, 59):  false,
+				day(3, 16, 59): true,
+				day(3, 17, 0):  false,
+				day(5, 12, 0):  true,
+				day(6, 12, 0):  false,
+				day(7, 12, 0):  false,
+			},
+		},
+		{
+			name: "past midnight",
+			cfg:  ScheduleConfig{Windows: []ScheduleWindow{{Days: []string{"fri"}, From: "22:00", To: "06:00"}}},
+			times: map[time.Time]bool{
+				day(5, 21, 59): false,
+				day(5, 22, 0):  true,
+				day(6, 5, 59):  true,
+				day(6, 6, 0):   false,
+				day(6, 22, 0):  false,
+				// The window of Thursday night is not scheduled.
+				day(5, 3, 0): false,
+			},
+		},
+		{
+			name: "days wrapping around the weekend",
+			cfg:  ScheduleConfig{Windows: []ScheduleWindow{{Days: []string{"Fri - Mon"}}}},
+			times: map[time.Time]bool{
+				day(5, 0, 0):   true,
+				day(7, 12, 0):  true,
+				day(1, 23, 59): true,
+				day(2, 0, 0):   false,
+				day(4, 23, 59): false,
+			},
+		},
+		{
+			name: "whole days",
+			cfg:  ScheduleConfig{Windows: []ScheduleWindow{{Days: []string{"saturday", "sun"}}}},
+			times: map[time.Time]bool{
+				day(6, 0, 0):   true,
+				day(7, 23, 59): true,
+				day(8, 0, 0):   false,
+			},
+		},
+		{
+			name: "until the end of every day",
+			cfg:  ScheduleConfig{Windows: []ScheduleWindow{{From: "20:00", To: "24:00"}}},
+			times: map[time.Time]bool{
+				day(2, 19, 59): false,
+				day(2, 23, 59): true,
+				day(7, 20, 0):  true,
+				day(8, 0, 0):   false,
+			},
+		},
+		{
+			name: "union of windows",
+			cfg: ScheduleConfig{Windows: []ScheduleWindow{
+				{Days: []string{"mon"}, From: "08:00", To: "10:00"},
+				{Days: []string{"mon"}, From: "14:00"},
+			}},
+			times: map[time.Time]bool{
+				day(1, 9, 0):  true,
+				day(1, 12, 0): false,
+				day(1, 15, 0): true,
+				day(2, 9, 0):  false,
+			},
+		},
+		{
+			name: "time zone of the schedule",
+			cfg:  ScheduleConfig{Timezone: "America/New_York", Windows: businessHours.Windows},
+			times: map[time.Time]bool{
+				// 08:30 and 09:00 in New York, in winter time.
+				day(1, 13, 30): false,
+				day(1, 14, 0):  true,
+				// 12:00 on Friday in New York, 01:00 on Saturday in UTC.
+				time.Date(2024, time.January, 5, 12, 0, 0, 0, newYork): true,
+				// 09:00 on a Monday in New York, in summer time.
+				time.Date(2024, time.July, 1, 13, 0, 0, 0, time.UTC): true,
+			},
+		},
+		{
+			name:     "time zone of the config",
+			cfg:      businessHours,
+			location: berlin,
+			times: map[time.Time]bool{
+				// 09:30 and 17:30 in Berlin.
+				day(1, 8, 30):  true,
+				day(1, 16, 30): false,
+			},
+		},
+		{
+			name:     "time zone of the schedule over the config",
+			cfg:      ScheduleConfig{Timezone: "UTC", Windows: businessHours.Windows},
+			location: berlin,
+			times: map[time.Time]bool{
+				day(1, 8, 30):  false,
+				day(1, 16, 30): true,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			location := tt.location
+			if location == nil {
+				location = time.UTC
+			}
+			s, err := newSchedule(tt.cfg, location)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for at, want := range tt.times {
+				if got := s.active(at); got != want {
+					t.Errorf("active(%v) = %v, want %v", at.In(s.location).Format("Mon 15:04 MST"), got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestNewSchedule(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  ScheduleConfig
+		// err is a substring of the error, empty if there is none.
+		err string
+	}{
+		{name: "unknown time zone", cfg: ScheduleConfig{Timezone: "Mars/Olympus", Windows: []ScheduleWindow{{From: "09:00"}}}, err: "unknown schedule timezone Mars/Olympus"},
+		{name: "invalid from", cfg: ScheduleConfig{Windows: []ScheduleWindow{{From: "9am"}}}, err: "schedule window 1: from: invalid time 9am, expected HH:MM"},
+		{name: "invalid to", cfg: ScheduleConfig{Windows: []ScheduleWindow{{From: "09:00"}, {To: "25:00"}}}, err: "schedule window 2: to: invalid time 25:00"},
+		{name: "empty window", cfg: ScheduleConfig{Windows: []ScheduleWindow{{From: "09:00", To: "09:00"}}}, err: "from and to are both 09:00"},
+		{name: "whole day", cfg: ScheduleConfig{Windows: []ScheduleWindow{{From: "00:00", To: "24:00"}}}},
+		{name: "unknown day", cfg: ScheduleConfig{Windows: []ScheduleWindow{{Days: []string{"mon", "caturday"}}}}, err: "unknown day caturday"},
+		{name: "unknown day in range", cfg: ScheduleConfig{Windows: []ScheduleWindow{{Days: []string{"mon-xyz"}}}}, err: "unknown day mon-xyz"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newSchedule(tt.cfg, time.UTC)
+			if tt.err == "" && err != nil {
+				t.Errorf("newSchedule() = %v", err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Errorf("newSchedule() = %v, want an error containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestNewScheduleAlwaysActive(t *testing.T) {
+	s, err := newSchedule(ScheduleConfig{Timezone: "UTC"}, nil)
+	if s != nil || err != nil {
+		t.Fatalf("newSchedule() without windows = %v, %v, want nil", s, err)
+	}
+	if !s.active(time.Now()) {
+		t.Error("active() of a nil schedule = false, want true")
+	}
+}
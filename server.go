@@ -0,0 +1,50 @@
+package sest
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// serveHTTP serves the metrics and health endpoints configured in cfg until
+// ctx is done. Endpoints configured with the same address share a server.
+func (r *Runner) serveHTTP(ctx context.Context, cfg Config) {
+	muxes := make(map[string]*http.ServeMux)
+	mux := func(addr string) *http.ServeMux {
+		if muxes[addr] == nil {
+			muxes[addr] = http.NewServeMux()
+		}
+		return muxes[addr]
+	}
+	if cfg.MetricsAddr != "" {
+		mux(cfg.MetricsAddr).Handle("/metrics", promhttp.Handler())
+	}
+	if cfg.HealthAddr != "" {
+		mux(cfg.HealthAddr).HandleFunc("/healthz", r.serveHealth)
+		mux(cfg.HealthAddr).HandleFunc("/status", r.serveStatus)
+	}
+	for addr, m := range muxes {
+		go serve(ctx, addr, m)
+	}
+}
+
+// serve runs an HTTP server on addr until ctx is done.
+func serve(ctx context.Context, addr string, handler http.Handler) {
+	server := &http.Server{Addr: addr, Handler: handler}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	slog.Info("Serving HTTP", "addr", addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("Could not serve HTTP", "addr", addr, "err", err)
+	}
+}
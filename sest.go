@@ -0,0 +1,308 @@
+// Package sest watches log files and turns lines matching the configured
+// events into rendered events, which are delivered to sinks such as webhooks,
+// Slack, files or syslog.
+//
+// A Runner is built from a Config, usually loaded with LoadConfig:
+//
+//	cfg, err := sest.LoadConfig("/etc/sest/config.yml")
+//	...
+//	cfg.ResolveRelativePaths("/etc/sest")
+//	if err := cfg.Validate(); err != nil {
+//		...
+//	}
+//	r, err := sest.New(cfg)
+//	...
+//	err = r.Run(ctx)
+//
+// Rendered events can also be consumed programmatically by registering a
+// handler with OnMatch:
+//
+//	r, err := sest.New(cfg, sest.OnMatch(func(e sest.RenderedEvent) {
+//		fmt.Println(e.EventType, e.Fields)
+//	}))
+//
+// # Templates
+//
+// The template of an event is executed as a text/template for every match.
+// Its data holds the capture groups as group0 (the whole match), group1, ...
+// and under their names, the Filename, EventType, ChannelName and Line of the
+// match, the number of Suppressed duplicates, the fields of structured lines
+// and the tags of the event. Templates can use these functions:
+//
+//	timestamp ["layout"]   the current time, formatted with a time.Layout in
+//	                       the configured timezone
+//	unixTimestamp          the current time in seconds since the Unix epoch
+//	unixMillis             the current time in milliseconds since the epoch
+//	toJson, toPrettyJson   encode a value as JSON
+//	env "NAME"             the value of an environment variable
+//	hostname               the name of the host
+//	default "x" .value     "x" if .value is missing or empty
+//	upper, lower           change the case of a string
+//	trim "cutset" .value   strip leading and trailing characters in cutset
+//	trimSpace .value       strip leading and trailing white space
+//	replace "old" "new" .value
+//	                       replace all occurrences of old
+//	split "sep" .value     split a string into a list
+//
+// The value is the last argument of functions taking several, so they can be
+// used in pipelines like {{.user | trimSpace | upper}}.
+//
+// Matches whose template renders only white space are not delivered, so
+// templates like {{if eq .level "error"}}...{{end}} can filter matches.
+package sest
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"text/template"
+	"time"
+)
+
+// Event is a configured event, matched against the lines read from the input
+// files.
+type Event struct {
+	// Regex is matched against new lines. Each match renders Template.
+	Regex *regexp.Regexp
+	// Alternatives are further regexes, matched against the lines Regex
+	// does not match, in order.
+	Alternatives []*regexp.Regexp
+	// GroupNames are the names of the capture groups of Regex, as returned
+	// by SubexpNames.
+	GroupNames []string
+	// Contains and Prefilter, if set, gate Regex: it is only matched against
+	// the lines that contain the substring and match the prefilter.
+	Contains  []byte
+	Prefilter *regexp.Regexp
+	// Template is executed as a text/template for each match. Capture
+	// groups are passed as data, e.g. {{.group1}}, rather than expanded
+	// into the template, so captured text is never parsed as a template.
+	Template []byte
+	// EventType and ChannelName are passed on to the sinks.
+	EventType   string
+	ChannelName string
+	// Sinks receive the rendered events.
+	Sinks []Sink
+	// Strict makes references to missing template data an error.
+	Strict bool
+	// Format is the format lines are decoded from, json or logfmt, or
+	// empty for text.
+	Format string
+	// Fields are matched against the decoded fields of a line, Regex against
+	// the whole line. Events with fields only match decoded lines.
+	Fields map[string]*regexp.Regexp
+	// Tags are static fields added to the template data and the fields of
+	// rendered events, unless a capture group or decoded field has the same
+	// name.
+	Tags map[string]string
+
+	limiter *rateLimiter
+	dedup   *deduplicator
+	retry   retryPolicy
+	// deadLetter receives the events that could not be delivered, if set.
+	deadLetter *fileSink
+	// dedupGroup is the capture group whose value identifies duplicates,
+	// or -1 for the rendered output. altDedupGroups are the ones of the
+	// Alternatives.
+	dedupGroup     int
+	altDedupGroups []int
+	// compiled is the parsed Template, nil for events not created from a
+	// config, which parse it per match.
+	compiled *template.Template
+	// severity extracts the severity of a match.
+	severity severityRule
+	// sampler drops the matches sampled out, nil to keep all.
+	sampler *sampler
+	// schedule is when the event is active, nil for always.
+	schedule *schedule
+	// aggregate counts the matches of the event to deliver summaries
+	// instead, nil to deliver every match.
+	aggregate *aggregator
+	// alert tracks the matches of the event as alerts, nil to deliver
+	// every match.
+	alert *alerter
+	// output is the output format the event is rendered in, template if
+	// empty.
+	output string
+	// stale marks the event delivered when a file goes stale, which is not
+	// matched against lines.
+	stale bool
+	// location is the time zone of the timestamp function, the local one if
+	// nil.
+	location *time.Location
+	// templateFile is the file Template was read from, empty for inline
+	// templates, and templateInfo describes it as of the last read.
+	templateFile string
+	templateInfo os.FileInfo
+}
+
+// createEventList builds the events of the config. Events that cannot be
+// built are left out and reported in the returned error.
+func createEventList(cfg Config) ([]Event, error) {
+	if len(cfg.Events) <= 0 {
+		return nil, nil
+	}
+	events := make([]Event, 0, len(cfg.Events))
+	sinks := newSinkRegistry(cfg)
+	var errs []error
+
+	var location *time.Location
+	if cfg.Timezone != "" {
+		var err error
+		if location, err = time.LoadLocation(cfg.Timezone); err != nil {
+			return nil, fmt.Errorf("unknown timezone %s: %w", cfg.Timezone, err)
+		}
+	}
+
+	for key, eventCfg := range cfg.Events {
+		regexes, err := compileRegexes(eventCfg.Src, eventCfg.regexFlags())
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%v for event %s", err, key))
+			continue
+		}
+		if len(regexes) == 0 {
+			regexes = []*regexp.Regexp{matchAll}
+		}
+		re := regexes[0]
+
+		var prefilter *regexp.Regexp
+		if eventCfg.Prefilter != "" {
+			var err error
+			if prefilter, err = regexp.Compile(eventCfg.Prefilter); err != nil {
+				errs = append(errs, fmt.Errorf("could not compile prefilter (%s) for event %s", eventCfg.Prefilter, key))
+				continue
+			}
+		}
+
+		fields, err := compileFields(eventCfg.Fields)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("event %s: %w", key, err))
+			continue
+		}
+
+		schedule, err := newSchedule(eventCfg.Schedule, location)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("event %s: %w", key, err))
+			continue
+		}
+
+		output := outputFormat(cfg, eventCfg)
+		var template []byte
+		if output == outputTemplate {
+			if template, err = eventCfg.loadTemplate(); err != nil {
+				errs = append(errs, fmt.Errorf("could not load template %s for event %s", eventCfg.templateName(), key))
+				continue
+			}
+		}
+
+		eventSinks, err := sinks.create(cfg, eventCfg)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("could not configure sinks for event %s: %w", key, err))
+			continue
+		}
+
+		groups := make([]int, len(regexes))
+		for i, re := range regexes {
+			if groups[i], err = dedupGroup(eventCfg.DedupKey, re.SubexpNames()); err != nil {
+				break
+			}
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("event %s: %w", key, err))
+			continue
+		}
+
+		event := Event{
+			Regex:          re,
+			GroupNames:     re.SubexpNames(),
+			Alternatives:   regexes[1:],
+			Contains:       []byte(eventCfg.Contains),
+			Prefilter:      prefilter,
+			Template:       template,
+			EventType:      eventCfg.EventType,
+			ChannelName:    eventCfg.ChannelName,
+			Sinks:          eventSinks,
+			Strict:         eventCfg.Strict,
+			Format:         eventFormat(cfg, eventCfg),
+			Fields:         fields,
+			Tags:           eventCfg.Tags,
+			limiter:        newRateLimiter(eventCfg.RateLimit),
+			retry:          newRetryPolicy(cfg.Retry),
+			deadLetter:     sinks.deadLetter(cfg, eventCfg),
+			dedup:          newDeduplicator(eventCfg.DedupWindow),
+			dedupGroup:     groups[0],
+			altDedupGroups: groups[1:],
+			location:       location,
+			stale:          key == cfg.Input.StaleEvent,
+			severity:       newSeverityRule(eventCfg.Severity),
+			sampler:        newSampler(eventCfg.SampleRate, eventCfg.SampleKey),
+			schedule:       schedule,
+			aggregate:      newAggregator(eventCfg.Aggregate.Window, eventCfg.Aggregate.GroupBy, time.Now()),
+			output:         output,
+		}
+		if output == outputTemplate {
+			if eventCfg.Template == "" {
+				event.templateFile = eventCfg.Dest
+				event.templateInfo, _ = os.Stat(eventCfg.Dest)
+			}
+			if event.compiled, err = event.parse(); err != nil {
+				errs = append(errs, fmt.Errorf("could not parse template %s for event %s: %w", eventCfg.templateName(), key, err))
+				continue
+			}
+		}
+		if event.alert, err = newAlerter(cfg, key, eventCfg, event, sinks); err != nil {
+			errs = append(errs, fmt.Errorf("event %s: %w", key, err))
+			continue
+		}
+		events = append(events, event)
+	}
+	return events, errors.Join(errs...)
+}
+
+// The output formats of events.
+const (
+	outputTemplate = "template"
+	outputPlain    = "plain"
+	outputJSON     = "json"
+)
+
+// outputFormat returns the output format of an event: its own, template if
+// it has a dest or template, or else the one of the config.
+func outputFormat(cfg Config, eventCfg EventConfig) string {
+	switch {
+	case eventCfg.OutputFormat != "":
+		return eventCfg.OutputFormat
+	case eventCfg.Dest != "" || eventCfg.Template != "" || cfg.OutputFormat == "":
+		return outputTemplate
+	}
+	return cfg.OutputFormat
+}
+
+// eventFormat returns the format an event decodes lines from, empty for text.
+func eventFormat(cfg Config, eventCfg EventConfig) string {
+	format := cfg.Input.Format
+	if eventCfg.Format != "" {
+		format = eventCfg.Format
+	}
+	if format == "text" {
+		return ""
+	}
+	return format
+}
+
+// compileFields compiles the field filters of an event.
+func compileFields(fields map[string]string) (map[string]*regexp.Regexp, error) {
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	compiled := make(map[string]*regexp.Regexp, len(fields))
+	for key, expr := range fields {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("field %s filter does not compile: %v", key, err)
+		}
+		compiled[key] = re
+	}
+	return compiled, nil
+}
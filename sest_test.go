@@ -0,0 +1,27 @@
+package sest
+
+import "testing"
+
+func TestOutputFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		global string
+		event  EventConfig
+		want   string
+	}{
+		{name: "default", want: outputTemplate},
+		{name: "global", global: outputJSON, want: outputJSON},
+		{name: "event", event: EventConfig{OutputFormat: outputPlain}, want: outputPlain},
+		{name: "event overrides global", global: outputJSON, event: EventConfig{OutputFormat: outputPlain}, want: outputPlain},
+		// An event with a template of its own renders it by default.
+		{name: "inline template", global: outputJSON, event: EventConfig{Template: "{{.group0}}"}, want: outputTemplate},
+		{name: "dest", global: outputPlain, event: EventConfig{Dest: "event.tmpl"}, want: outputTemplate},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := outputFormat(Config{OutputFormat: tt.global}, tt.event); got != tt.want {
+				t.Errorf("outputFormat() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
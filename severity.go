@@ -0,0 +1,118 @@
+package sest
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Severity is the level of an event, ordered from Debug to Fatal. The zero
+// value is an unknown severity, below all others.
+type Severity int
+
+const (
+	SeverityUnknown Severity = iota
+	SeverityDebug
+	SeverityInfo
+	SeverityWarn
+	SeverityError
+	SeverityFatal
+)
+
+// severityNames maps the common spellings of log levels to severities.
+var severityNames = map[string]Severity{
+	"trace":       SeverityDebug,
+	"debug":       SeverityDebug,
+	"info":        SeverityInfo,
+	"information": SeverityInfo,
+	"notice":      SeverityInfo,
+	"warn":        SeverityWarn,
+	"warning":     SeverityWarn,
+	"error":       SeverityError,
+	"err":         SeverityError,
+	"fatal":       SeverityFatal,
+	"critical":    SeverityFatal,
+	"crit":        SeverityFatal,
+	"panic":       SeverityFatal,
+	"alert":       SeverityFatal,
+	"emerg":       SeverityFatal,
+}
+
+// ParseSeverity normalizes a level like WARN, Warning or warn.
+func ParseSeverity(level string) (Severity, bool) {
+	s, ok := severityNames[strings.ToLower(strings.TrimSpace(level))]
+	return s, ok
+}
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityDebug:
+		return "debug"
+	case SeverityInfo:
+		return "info"
+	case SeverityWarn:
+		return "warn"
+	case SeverityError:
+		return "error"
+	case SeverityFatal:
+		return "fatal"
+	}
+	return ""
+}
+
+// severityRule extracts the severity of a match: the level in the capture
+// group named or numbered group, or the decoded field named group, or the
+// static level if there is none.
+type severityRule struct {
+	group string
+	level Severity
+}
+
+func newSeverityRule(cfg SeverityConfig) severityRule {
+	level, _ := ParseSeverity(cfg.Level)
+	return severityRule{group: cfg.Group, level: level}
+}
+
+// of returns the severity of a match with the given fields and capture
+// groups.
+func (r severityRule) of(fields map[string]string, groups []string) Severity {
+	if r.group == "" {
+		return r.level
+	}
+	level, ok := fields[r.group]
+	if i, err := strconv.Atoi(r.group); !ok && err == nil && i >= 0 && i < len(groups) {
+		level = groups[i]
+	}
+	if s, ok := ParseSeverity(level); ok {
+		return s
+	}
+	return r.level
+}
+
+// severitySink passes only the events of at least min severity on to a sink.
+type severitySink struct {
+	Sink
+	min Severity
+}
+
+func (s severitySink) accepts(severity Severity) bool {
+	return severity >= s.min
+}
+
+func (s severitySink) Close() error {
+	if closer, ok := s.Sink.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (s severitySink) String() string {
+	return fmt.Sprint(s.Sink)
+}
+
+// routes reports whether sink receives an event of the given severity.
+func routes(sink Sink, severity Severity) bool {
+	s, ok := sink.(severitySink)
+	return !ok || s.accepts(severity)
+}
@@ -0,0 +1,28 @@
+package sest
+
+import "testing"
+
+func TestSeverityRule(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    SeverityConfig
+		fields map[string]string
+		groups []string
+		want   Severity
+	}{
+		{name: "no group", cfg: SeverityConfig{Level: "warn"}, fields: map[string]string{"level": "error"}, want: SeverityWarn},
+		{name: "named group", cfg: SeverityConfig{Group: "level", Level: "info"}, fields: map[string]string{"level": "ERROR"}, want: SeverityError},
+		{name: "numbered group", cfg: SeverityConfig{Group: "2"}, groups: []string{"db WARNING", "db", "WARNING"}, want: SeverityWarn},
+		{name: "field named like a number", cfg: SeverityConfig{Group: "1"}, fields: map[string]string{"1": "crit"}, groups: []string{"x debug", "debug"}, want: SeverityFatal},
+		{name: "group number out of range", cfg: SeverityConfig{Group: "3", Level: "info"}, groups: []string{"db", "db"}, want: SeverityInfo},
+		{name: "unknown level", cfg: SeverityConfig{Group: "level", Level: "info"}, fields: map[string]string{"level": "loud"}, want: SeverityInfo},
+		{name: "unknown level without static level", cfg: SeverityConfig{Group: "level"}, fields: map[string]string{"level": "loud"}, want: SeverityUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newSeverityRule(tt.cfg).of(tt.fields, tt.groups); got != tt.want {
+				t.Errorf("of() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
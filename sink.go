@@ -0,0 +1,496 @@
+package sest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/segmentio/kafka-go"
+)
+
+// RenderedEvent is the result of executing an event's template for a single
+// match.
+type RenderedEvent struct {
+	EventType   string
+	ChannelName string
+	Filename    string
+	// Line is the line containing the match.
+	Line string
+	// Groups holds all capture groups, starting with the whole match. Groups
+	// that did not participate in the match are empty.
+	Groups []string
+	// Fields holds the named capture groups that participated in the match,
+	// the decoded fields of structured lines and the tags of the event.
+	Fields map[string]string
+	// Suppressed is the number of duplicates of the event suppressed within
+	// the dedup window preceding it.
+	Suppressed int
+	// Severity is the severity extracted from the match, unknown if the
+	// event configures none.
+	Severity Severity
+	Body     []byte
+}
+
+// Sink is a destination for rendered events. Deliver should give up and
+// return once ctx is done, which it is when the attempt timed out or the
+// deliveries are cancelled on shutdown; the error is retried like any other.
+type Sink interface {
+	Deliver(ctx context.Context, e RenderedEvent) error
+}
+
+// ioDeadline returns the deadline of an I/O operation allowed to take timeout,
+// or less if ctx is done earlier.
+func ioDeadline(ctx context.Context, timeout time.Duration) time.Time {
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		return d
+	}
+	return deadline
+}
+
+// timeoutSink is a sink with a delivery timeout of its own, overriding the
+// one of the dispatch config.
+type timeoutSink struct {
+	Sink
+	timeout time.Duration
+}
+
+func (s timeoutSink) Close() error {
+	if closer, ok := s.Sink.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (s timeoutSink) String() string {
+	return fmt.Sprint(s.Sink)
+}
+
+// sinkTimeout returns the delivery timeout of sink, fallback unless it has
+// one of its own.
+func sinkTimeout(sink Sink, fallback time.Duration) time.Duration {
+	if s, ok := sink.(severitySink); ok {
+		sink = s.Sink
+	}
+	if s, ok := sink.(timeoutSink); ok {
+		return s.timeout
+	}
+	return fallback
+}
+
+// deliver hands the rendered event to every sink of the event, retrying
+// failures according to the retry policy of the event, each attempt bounded
+// by the timeout of the sink, or else timeout unless it is 0. Once ctx is
+// done, failures are not retried.
+// A failing sink does not keep the remaining sinks from receiving the event;
+// all failures are logged and returned together.
+func deliver(ctx context.Context, e Event, rendered RenderedEvent, timeout time.Duration) error {
+	var errs []error
+	routed := 0
+	for _, sink := range e.Sinks {
+		if !routes(sink, rendered.Severity) {
+			continue
+		}
+		routed++
+		timeout := sinkTimeout(sink, timeout)
+		attempts, err := e.retry.do(ctx, func(ctx context.Context) error {
+			if timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
+			err := sink.Deliver(ctx, rendered)
+			if err != nil {
+				slog.Debug("Delivery failed", "event_type", e.EventType, "sink", fmt.Sprint(sink), "err", err)
+			}
+			return err
+		})
+		if err != nil {
+			if e.deadLetter != nil {
+				slog.Warn("Could not deliver event, writing it to the dead letter file", "event_type", e.EventType, "sink", fmt.Sprint(sink), "attempts", attempts, "err", err)
+				writeDeadLetter(e.deadLetter, sink, rendered, attempts, err)
+			} else {
+				slog.Warn("Could not deliver event, dropping it", "event_type", e.EventType, "sink", fmt.Sprint(sink), "attempts", attempts, "err", err)
+			}
+			errs = append(errs, fmt.Errorf("%v: %w", sink, err))
+			deliveries.WithLabelValues(fmt.Sprint(sink), "failure").Inc()
+			continue
+		}
+		deliveries.WithLabelValues(fmt.Sprint(sink), "success").Inc()
+	}
+	if len(errs) > 0 && len(errs) < routed {
+		slog.Warn("Delivered event to some sinks only", "event_type", e.EventType, "delivered", routed-len(errs), "sinks", routed)
+	}
+	return errors.Join(errs...)
+}
+
+// deadLetter is a line of a dead letter file.
+type deadLetter struct {
+	Time        time.Time `json:"time"`
+	EventType   string    `json:"event_type"`
+	ChannelName string    `json:"channel_name,omitempty"`
+	Filename    string    `json:"filename"`
+	Line        string    `json:"line"`
+	Sink        string    `json:"sink"`
+	Attempts    int       `json:"attempts"`
+	Error       string    `json:"error"`
+	Body        string    `json:"body"`
+}
+
+// writeDeadLetter appends an event that could not be delivered to sink to the
+// dead letter file.
+func writeDeadLetter(file *fileSink, sink Sink, e RenderedEvent, attempts int, deliverErr error) {
+	line, err := json.Marshal(deadLetter{
+		Time:        time.Now(),
+		EventType:   e.EventType,
+		ChannelName: e.ChannelName,
+		Filename:    e.Filename,
+		Line:        e.Line,
+		Sink:        fmt.Sprint(sink),
+		Attempts:    attempts,
+		Error:       deliverErr.Error(),
+		Body:        string(e.Body),
+	})
+	if err == nil {
+		err = file.writeLine(line)
+	}
+	if err != nil {
+		slog.Error("Could not write to the dead letter file, dropping event", "event_type", e.EventType, "file", file.Filename, "err", err)
+	}
+}
+
+// closeSinks releases the resources held by the sinks of all events.
+func closeSinks(events []Event) {
+	for _, e := range events {
+		for _, sink := range e.Sinks {
+			if closer, ok := sink.(io.Closer); ok {
+				closer.Close()
+			}
+		}
+		if e.alert != nil {
+			for _, notice := range e.alert.notices() {
+				for _, sink := range notice.sinks {
+					if closer, ok := sink.(io.Closer); ok {
+						closer.Close()
+					}
+				}
+			}
+		}
+		if e.deadLetter != nil {
+			e.deadLetter.Close()
+		}
+	}
+}
+
+// sinkRegistry creates the sinks of all events, sharing a single instance of
+// the globally configured sinks and of file sinks writing to the same path,
+// and a single HTTP client and AWS SDK config.
+type sinkRegistry struct {
+	client *http.Client
+	// aws is the config of the AWS SDK, loaded with the first sns sink.
+	aws       *aws.Config
+	awsErr    error
+	slack     *slackSink
+	discord   *discordSink
+	redis     *redisSink
+	nats      *natsSink
+	natsErr   error
+	mqtt      *mqttClient
+	mqttErr   error
+	tcp       *tcpSink
+	kafka     *kafka.Writer
+	syslog    *syslogSink
+	syslogErr error
+	files     map[string]*fileSink
+}
+
+func newSinkRegistry(cfg Config) *sinkRegistry {
+	tlsConfig, err := newTLSConfig(cfg)
+	if err != nil {
+		slog.Error("Could not configure TLS, using the defaults", "err", err)
+	}
+	client := newHTTPClient(cfg, tlsConfig)
+	r := &sinkRegistry{
+		client:  client,
+		slack:   newSlackSink(client, cfg.Slack.Token, cfg.Slack.WebhookURL, cfg.Slack.DefaultChannel),
+		discord: newDiscordSink(client, cfg.Discord.WebhookURL, cfg.Discord.Username, cfg.Discord.AvatarURL),
+		files:   make(map[string]*fileSink),
+	}
+	if len(cfg.Kafka.Brokers) > 0 {
+		r.kafka = newKafkaWriter(cfg, enableTLS(cfg.Kafka.TLS, tlsConfig))
+	}
+	if cfg.Redis.Addr != "" {
+		r.redis = newRedisSink(cfg.Redis.Addr, cfg.Redis.Password, cfg.Redis.DB, cfg.Redis.DefaultChannel, enableTLS(cfg.Redis.TLS, tlsConfig))
+	}
+	if cfg.Nats.URL != "" {
+		n := cfg.Nats
+		r.nats, r.natsErr = newNatsSink(n.URL, n.User, n.Password, n.Token, n.SubjectPrefix, enableTLS(n.TLS, tlsConfig))
+		if r.natsErr != nil {
+			slog.Error("Could not configure nats", "err", r.natsErr)
+		}
+	}
+	if cfg.MQTT.Broker != "" {
+		r.mqtt, r.mqttErr = newMQTTClient(cfg, enableTLS(cfg.MQTT.TLS, tlsConfig))
+		if r.mqttErr != nil {
+			slog.Error("Could not configure mqtt", "err", r.mqttErr)
+		}
+	}
+	if cfg.TCP.Addr != "" {
+		r.tcp = newTCPSink(cfg.TCP.Addr, cfg.TCP.WriteTimeout, enableTLS(cfg.TCP.TLS, tlsConfig))
+	}
+	if cfg.Syslog.Network != "" || cfg.Syslog.Address != "" || cfg.Syslog.Facility != "" || cfg.Syslog.Tag != "" {
+		r.syslog, r.syslogErr = newSyslogSink(cfg.Syslog.Network, cfg.Syslog.Address, cfg.Syslog.Facility, cfg.Syslog.Tag, tlsConfig)
+		if r.syslogErr != nil {
+			slog.Error("Could not configure syslog", "err", r.syslogErr)
+		}
+	}
+	return r
+}
+
+// create returns the sinks of an event. Events with an explicit list of sinks
+// get exactly those; otherwise the per-event url and output_file settings and
+// the global slack, discord, redis, nats, mqtt, kafka, tcp, syslog and
+// output_file settings apply. Events without any sink are logged.
+func (r *sinkRegistry) create(cfg Config, eventCfg EventConfig) ([]Sink, error) {
+	if len(eventCfg.Sinks) > 0 {
+		sinks := make([]Sink, 0, len(eventCfg.Sinks))
+		for _, spec := range eventCfg.Sinks {
+			sink, err := r.createFromSpec(cfg, eventCfg, spec)
+			if err != nil {
+				return nil, err
+			}
+			if spec.Timeout > 0 {
+				sink = timeoutSink{Sink: sink, timeout: spec.Timeout}
+			}
+			if min, ok := ParseSeverity(spec.MinSeverity); ok {
+				sink = severitySink{Sink: sink, min: min}
+			}
+			sinks = append(sinks, sink)
+		}
+		return sinks, nil
+	}
+
+	var sinks []Sink
+	if eventCfg.URL != "" {
+		sinks = append(sinks, newWebhookSink(r.client, eventCfg.URL, eventCfg.ContentType, nil))
+	}
+	if r.slack != nil {
+		sinks = append(sinks, r.slack)
+	}
+	if r.discord != nil {
+		sinks = append(sinks, r.discord)
+	}
+	if r.redis != nil {
+		sinks = append(sinks, r.redis)
+	}
+	if r.nats != nil {
+		sinks = append(sinks, r.nats)
+	}
+	if r.mqtt != nil {
+		sink, err := newMQTTSink(r.mqtt, cfg.MQTT.Topic)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	if r.kafka != nil && cfg.Kafka.Topic != "" {
+		sinks = append(sinks, &kafkaSink{writer: r.kafka, topic: cfg.Kafka.Topic, key: cfg.Kafka.Key})
+	}
+	if r.tcp != nil {
+		sinks = append(sinks, r.tcp)
+	}
+	outputFilename := eventCfg.OutputFile
+	if outputFilename == "" {
+		outputFilename = cfg.OutputFile
+	}
+	if outputFilename != "" {
+		sinks = append(sinks, r.file(outputFilename))
+	}
+	if r.syslog != nil {
+		sinks = append(sinks, r.syslog)
+	}
+	if len(sinks) == 0 {
+		sinks = append(sinks, logSink{})
+	}
+	return sinks, nil
+}
+
+func (r *sinkRegistry) createFromSpec(cfg Config, eventCfg EventConfig, spec SinkConfig) (Sink, error) {
+	switch spec.Type {
+	case "log":
+		return logSink{}, nil
+	case "webhook":
+		if spec.URL == "" {
+			return nil, errors.New("webhook sink without url")
+		}
+		if spec.BatchSize > 1 {
+			return newBatchWebhookSink(r.client, spec, newRetryPolicy(cfg.Retry), r.deadLetter(cfg, eventCfg)), nil
+		}
+		return newWebhookSinkFromSpec(r.client, spec)
+	case "slack":
+		if r.slack == nil {
+			return nil, errors.New("slack sink without slack token or webhook_url")
+		}
+		return r.slack, nil
+	case "discord":
+		if r.discord == nil {
+			return nil, errors.New("discord sink without discord webhook_url")
+		}
+		return r.discord, nil
+	case "file":
+		if spec.Path == "" {
+			return nil, errors.New("file sink without path")
+		}
+		return r.file(spec.Path), nil
+	case "syslog":
+		if r.syslog == nil {
+			if r.syslogErr != nil {
+				return nil, r.syslogErr
+			}
+			return nil, errors.New("syslog sink without syslog configuration")
+		}
+		return r.syslog, nil
+	case "redis":
+		if r.redis == nil {
+			return nil, errors.New("redis sink without redis addr")
+		}
+		return r.redis, nil
+	case "nats":
+		if r.nats == nil {
+			if r.natsErr != nil {
+				return nil, r.natsErr
+			}
+			return nil, errors.New("nats sink without nats url")
+		}
+		return r.nats, nil
+	case "mqtt":
+		if r.mqtt == nil {
+			if r.mqttErr != nil {
+				return nil, r.mqttErr
+			}
+			return nil, errors.New("mqtt sink without mqtt broker")
+		}
+		topic := spec.Topic
+		if topic == "" {
+			topic = cfg.MQTT.Topic
+		}
+		return newMQTTSink(r.mqtt, topic)
+	case "kafka":
+		if r.kafka == nil {
+			return nil, errors.New("kafka sink without kafka brokers")
+		}
+		sink := &kafkaSink{writer: r.kafka, topic: spec.Topic, key: spec.Key}
+		if sink.topic == "" {
+			sink.topic = cfg.Kafka.Topic
+		}
+		if sink.key == "" {
+			sink.key = cfg.Kafka.Key
+		}
+		if sink.topic == "" {
+			return nil, errors.New("kafka sink without topic")
+		}
+		return sink, nil
+	case "tcp":
+		if r.tcp == nil {
+			return nil, errors.New("tcp sink without tcp addr")
+		}
+		return r.tcp, nil
+	case "elasticsearch":
+		if spec.URL == "" || spec.Index == "" {
+			return nil, errors.New("elasticsearch sink without url or index")
+		}
+		return newElasticsearchSink(r.client, spec, newRetryPolicy(cfg.Retry), r.deadLetter(cfg, eventCfg)), nil
+	case "pagerduty":
+		if spec.RoutingKey == "" {
+			return nil, errors.New("pagerduty sink without routing_key")
+		}
+		return newPagerdutySink(r.client, spec)
+	case "sns":
+		if spec.TopicARN == "" {
+			return nil, errors.New("sns sink without topic_arn")
+		}
+		if r.aws == nil && r.awsErr == nil {
+			awsConfig, err := loadAWSConfig(r.client)
+			if r.awsErr = err; err == nil {
+				r.aws = &awsConfig
+			}
+		}
+		if r.awsErr != nil {
+			return nil, fmt.Errorf("could not load the aws config: %w", r.awsErr)
+		}
+		return newSNSSink(*r.aws, spec)
+	case "command":
+		if spec.Command == "" {
+			return nil, errors.New("command sink without command")
+		}
+		return newCommandSink(spec.Command, spec.Args, spec.Timeout, spec.MaxConcurrent), nil
+	default:
+		return nil, fmt.Errorf("unknown sink type %q", spec.Type)
+	}
+}
+
+// deadLetter returns the dead letter file of an event, nil if there is none.
+func (r *sinkRegistry) deadLetter(cfg Config, eventCfg EventConfig) *fileSink {
+	filename := eventCfg.DeadLetterFile
+	if filename == "" {
+		filename = cfg.DeadLetterFile
+	}
+	if filename == "" {
+		return nil
+	}
+	return r.file(filename)
+}
+
+func (r *sinkRegistry) file(filename string) *fileSink {
+	sink := r.files[filename]
+	if sink == nil {
+		sink = newFileSink(filename)
+		r.files[filename] = sink
+	}
+	return sink
+}
+
+// logSink writes rendered events to the process log. It is used for events
+// without any other configured sink.
+type logSink struct{}
+
+func (logSink) Deliver(ctx context.Context, e RenderedEvent) error {
+	slog.Info("Event", "event_type", e.EventType, "file", e.Filename, "body", string(e.Body))
+	return nil
+}
+
+func (logSink) String() string {
+	return "log"
+}
+
+// handlerSink passes rendered events to a function registered with OnMatch.
+type handlerSink func(RenderedEvent)
+
+func (h handlerSink) Deliver(ctx context.Context, e RenderedEvent) error {
+	h(e)
+	return nil
+}
+
+func (h handlerSink) String() string {
+	return "handler"
+}
+
+// dryRunSink prints rendered events to stdout together with where they were
+// found, instead of delivering them.
+type dryRunSink struct{}
+
+func (dryRunSink) Deliver(ctx context.Context, e RenderedEvent) error {
+	fmt.Printf("%s: %s\n  line: %s\n%s\n", e.Filename, e.EventType, e.Line, bytes.TrimRight(e.Body, "\n"))
+	return nil
+}
+
+func (dryRunSink) String() string {
+	return "dry-run"
+}
@@ -0,0 +1,329 @@
+package sest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// flakySink fails the first failures deliveries with err and records the
+// bodies of the later ones.
+type flakySink struct {
+	failures int
+	err      error
+
+	mu        sync.Mutex
+	attempts  int
+	delivered []string
+}
+
+func (s *flakySink) Deliver(ctx context.Context, e RenderedEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attempts++
+	if s.attempts <= s.failures {
+		return s.err
+	}
+	s.delivered = append(s.delivered, string(e.Body))
+	return nil
+}
+
+func (s *flakySink) String() string {
+	return "flaky"
+}
+
+func TestDeliverRetries(t *testing.T) {
+	failure := errors.New("connection refused")
+	tests := []struct {
+		name     string
+		failures int
+		err      error
+		attempts int
+		// delivered is set if the event gets through.
+		delivered bool
+	}{
+		{name: "fails twice then succeeds", failures: 2, err: failure, attempts: 3, delivered: true},
+		{name: "attempts used up", failures: 5, err: failure, attempts: 4},
+		{name: "rejected", failures: 5, err: permanent(failure), attempts: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := &flakySink{failures: tt.failures, err: tt.err}
+			e := Event{
+				EventType: "E",
+				Sinks:     []Sink{sink},
+				retry:     newRetryPolicy(RetryConfig{MaxAttempts: 4, InitialInterval: time.Millisecond}),
+			}
+			err := deliver(context.Background(), e, RenderedEvent{EventType: "E", Body: []byte("body")}, time.Second)
+			if (err == nil) != tt.delivered || (err != nil && !errors.Is(err, failure)) {
+				t.Errorf("deliver() = %v", err)
+			}
+			if sink.attempts != tt.attempts {
+				t.Errorf("made %d attempts, want %d", sink.attempts, tt.attempts)
+			}
+			if tt.delivered && (len(sink.delivered) != 1 || sink.delivered[0] != "body") {
+				t.Errorf("delivered %q, want the event once", sink.delivered)
+			}
+		})
+	}
+}
+
+// TestDeliverOtherSinks checks that a failing sink does not keep the event
+// from the other sinks.
+func TestDeliverOtherSinks(t *testing.T) {
+	failing := &flakySink{failures: 1, err: permanent(errors.New("rejected"))}
+	working := &flakySink{}
+	e := Event{EventType: "E", Sinks: []Sink{failing, working}}
+	if err := deliver(context.Background(), e, RenderedEvent{EventType: "E", Body: []byte("body")}, time.Second); err == nil {
+		t.Error("deliver() succeeded although a sink failed")
+	}
+	if len(working.delivered) != 1 {
+		t.Errorf("working sink got %q, want the event", working.delivered)
+	}
+}
+
+func TestDeliverDeadLetter(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int
+		err      error
+		// attempts is the number of attempts in the dead letter, none is
+		// written if it is 0.
+		attempts int
+	}{
+		{name: "attempts used up", failures: 5, err: errors.New("connection refused"), attempts: 3},
+		{name: "rejected", failures: 5, err: permanent(errors.New("400 Bad Request")), attempts: 1},
+		{name: "delivered", failures: 1, err: errors.New("connection refused")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "dead.jsonl")
+			deadLetters := newFileSink(filename)
+			defer deadLetters.Close()
+			e := Event{
+				EventType:  "LoginFailed",
+				Sinks:      []Sink{&flakySink{failures: tt.failures, err: tt.err}},
+				retry:      newRetryPolicy(RetryConfig{MaxAttempts: 3, InitialInterval: time.Millisecond}),
+				deadLetter: deadLetters,
+			}
+			rendered := RenderedEvent{EventType: "LoginFailed", ChannelName: "logins", Filename: "app.log", Line: "login of alice failed", Body: []byte("alice")}
+			before := time.Now()
+			deliver(context.Background(), e, rendered, time.Second)
+
+			content, err := os.ReadFile(filename)
+			if tt.attempts == 0 {
+				if len(content) > 0 {
+					t.Errorf("wrote dead letters %q for a delivered event", content)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n"); len(lines) != 1 {
+				t.Fatalf("wrote %q, want a single dead letter", content)
+			}
+			var got deadLetter
+			if err := json.Unmarshal(content, &got); err != nil {
+				t.Fatal(err)
+			}
+			want := deadLetter{
+				Time:        got.Time,
+				EventType:   "LoginFailed",
+				ChannelName: "logins",
+				Filename:    "app.log",
+				Line:        "login of alice failed",
+				Sink:        "flaky",
+				Attempts:    tt.attempts,
+				Error:       tt.err.Error(),
+				Body:        "alice",
+			}
+			if got != want {
+				t.Errorf("wrote dead letter %+v, want %+v", got, want)
+			}
+			if got.Time.Before(before.Truncate(time.Second)) || got.Time.After(time.Now()) {
+				t.Errorf("dead letter time %v, want the time of the failure", got.Time)
+			}
+		})
+	}
+}
+
+func TestSinkRegistryDeadLetter(t *testing.T) {
+	tests := []struct {
+		name   string
+		global string
+		event  string
+		want   string
+	}{
+		{name: "none"},
+		{name: "global", global: "dead.jsonl", want: "dead.jsonl"},
+		{name: "event", event: "login.jsonl", want: "login.jsonl"},
+		{name: "event overrides global", global: "dead.jsonl", event: "login.jsonl", want: "login.jsonl"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &sinkRegistry{files: make(map[string]*fileSink)}
+			got := r.deadLetter(Config{DeadLetterFile: tt.global}, EventConfig{DeadLetterFile: tt.event})
+			if tt.want == "" {
+				if got != nil {
+					t.Errorf("deadLetter() = %v, want none", got)
+				}
+				return
+			}
+			if got == nil || got.Filename != tt.want {
+				t.Errorf("deadLetter() = %v, want %s", got, tt.want)
+			}
+			// Events sharing a dead letter file share the sink.
+			if again := r.deadLetter(Config{DeadLetterFile: tt.want}, EventConfig{}); again != got {
+				t.Errorf("deadLetter() = %p, want the same sink %p", again, got)
+			}
+		})
+	}
+}
+
+// slowSink takes delay to deliver an event, unless the context is done
+// earlier, and counts the attempts.
+type slowSink struct {
+	delay time.Duration
+
+	mu       sync.Mutex
+	attempts int
+}
+
+func (s *slowSink) Deliver(ctx context.Context, e RenderedEvent) error {
+	s.mu.Lock()
+	s.attempts++
+	s.mu.Unlock()
+	select {
+	case <-time.After(s.delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *slowSink) String() string { return "slow" }
+
+func TestDeliverTimeout(t *testing.T) {
+	tests := []struct {
+		name string
+		// timeout is the timeout of the dispatch config, sinkTimeout the
+		// one of the sink.
+		timeout     time.Duration
+		sinkTimeout time.Duration
+		severity    bool
+		delay       time.Duration
+		delivered   bool
+	}{
+		{name: "global timeout", timeout: 20 * time.Millisecond, delay: time.Minute},
+		{name: "sink timeout", sinkTimeout: 20 * time.Millisecond, delay: time.Minute},
+		{name: "sink timeout overrides global", timeout: time.Minute, sinkTimeout: 20 * time.Millisecond, delay: time.Minute},
+		{name: "longer sink timeout", timeout: 10 * time.Millisecond, sinkTimeout: time.Minute, delay: 50 * time.Millisecond, delivered: true},
+		{name: "sink timeout with min severity", sinkTimeout: 20 * time.Millisecond, severity: true, delay: time.Minute},
+		{name: "in time", timeout: time.Minute, delay: 10 * time.Millisecond, delivered: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			slow := &slowSink{delay: tt.delay}
+			var sink Sink = slow
+			if tt.sinkTimeout > 0 {
+				sink = timeoutSink{Sink: sink, timeout: tt.sinkTimeout}
+			}
+			if tt.severity {
+				sink = severitySink{Sink: sink, min: SeverityInfo}
+			}
+			filename := filepath.Join(t.TempDir(), "dead.jsonl")
+			deadLetters := newFileSink(filename)
+			defer deadLetters.Close()
+			e := Event{
+				EventType:  "E",
+				Sinks:      []Sink{sink},
+				retry:      newRetryPolicy(RetryConfig{MaxAttempts: 2, InitialInterval: time.Millisecond}),
+				deadLetter: deadLetters,
+			}
+			failures := deliveries.WithLabelValues("slow", "failure")
+			before := testutil.ToFloat64(failures)
+			start := time.Now()
+			err := deliver(context.Background(), e, RenderedEvent{EventType: "E", Severity: SeverityError}, tt.timeout)
+			if tt.delivered {
+				if err != nil {
+					t.Errorf("deliver() = %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("deliver() = %v, want the deadline exceeded", err)
+			}
+			// Every attempt times out, and is retried.
+			if slow.attempts != 2 {
+				t.Errorf("made %d attempts, want 2", slow.attempts)
+			}
+			if elapsed := time.Since(start); elapsed > 10*time.Second {
+				t.Errorf("deliver() took %v", elapsed)
+			}
+			if got := testutil.ToFloat64(failures) - before; got != 1 {
+				t.Errorf("counted %v failures, want 1", got)
+			}
+			var letter deadLetter
+			if content, err := os.ReadFile(filename); err != nil || json.Unmarshal(content, &letter) != nil {
+				t.Fatalf("dead letter file has %q, %v", content, err)
+			}
+			if letter.Attempts != 2 || letter.Error != context.DeadlineExceeded.Error() {
+				t.Errorf("got dead letter %+v, want 2 attempts that exceeded the deadline", letter)
+			}
+		})
+	}
+}
+
+// TestDeliverTimeoutHungWebhook checks that a delivery to a webhook that does
+// not respond is aborted after the timeout of the sink.
+func TestDeliverTimeoutHungWebhook(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	sink := timeoutSink{Sink: newWebhookSink(server.Client(), server.URL, "", nil), timeout: 50 * time.Millisecond}
+	e := Event{EventType: "E", Sinks: []Sink{sink}}
+	start := time.Now()
+	if err := deliver(context.Background(), e, RenderedEvent{EventType: "E", Body: []byte("body")}, 0); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("deliver() = %v, want the deadline exceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("deliver() took %v, want it aborted after the timeout", elapsed)
+	}
+}
+
+func TestSinkTimeout(t *testing.T) {
+	file := newFileSink("out.log")
+	tests := []struct {
+		name string
+		sink Sink
+		want time.Duration
+	}{
+		{name: "fallback", sink: file, want: 10 * time.Second},
+		{name: "own timeout", sink: timeoutSink{Sink: file, timeout: time.Second}, want: time.Second},
+		{name: "min severity", sink: severitySink{Sink: file, min: SeverityWarn}, want: 10 * time.Second},
+		{name: "own timeout with min severity", sink: severitySink{Sink: timeoutSink{Sink: file, timeout: time.Second}, min: SeverityWarn}, want: time.Second},
+	}
+	for _, tt := range tests {
+		if got := sinkTimeout(tt.sink, 10*time.Second); got != tt.want {
+			t.Errorf("sinkTimeout() of %s = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package sest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+const slackPostMessageURL = "https://slack.com/api/chat.postMessage"
+
+// slackSink posts rendered events to the channel named by the Event, either
+// through the Web API using a bot token or through an incoming webhook.
+type slackSink struct {
+	client         *http.Client
+	token          string
+	webhookURL     string
+	defaultChannel string
+}
+
+type slackMessage struct {
+	Channel string `json:"channel,omitempty"`
+	Text    string `json:"text"`
+}
+
+type slackResponse struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error"`
+}
+
+func newSlackSink(client *http.Client, token, webhookURL, defaultChannel string) *slackSink {
+	if token == "" && webhookURL == "" {
+		return nil
+	}
+	return &slackSink{
+		client:         client,
+		token:          token,
+		webhookURL:     webhookURL,
+		defaultChannel: defaultChannel,
+	}
+}
+
+func (s *slackSink) Deliver(ctx context.Context, e RenderedEvent) error {
+	channel := e.ChannelName
+	if channel == "" {
+		channel = s.defaultChannel
+	}
+
+	msg := slackMessage{Channel: channel, Text: string(e.Body)}
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	url := s.webhookURL
+	if s.token != "" {
+		if channel == "" {
+			return permanent(errors.New("no slack channel configured"))
+		}
+		url = slackPostMessageURL
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return fmt.Errorf("slack rate limited, retry after %ss", resp.Header.Get("Retry-After"))
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		err := fmt.Errorf("slack responded with status %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 {
+			return permanent(err)
+		}
+		return err
+	}
+
+	// Incoming webhooks answer with a plain "ok", the Web API with a JSON
+	// object that reports failures (e.g. channel_not_found) in a 200 response.
+	if s.token == "" {
+		return nil
+	}
+	var slackResp slackResponse
+	if err := json.Unmarshal(body, &slackResp); err != nil {
+		return fmt.Errorf("could not decode slack response: %v", err)
+	}
+	if !slackResp.OK {
+		return permanent(fmt.Errorf("slack channel %s: %s", channel, slackResp.Error))
+	}
+	return nil
+}
+
+func (s *slackSink) String() string {
+	return "slack"
+}
@@ -0,0 +1,198 @@
+package sest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"github.com/aws/smithy-go"
+)
+
+const (
+	// snsMaxSubject is the number of characters a subject must stay below.
+	snsMaxSubject = 100
+	// snsMaxAttributes is the number of message attributes SNS accepts.
+	snsMaxAttributes = 10
+	// snsMaxAttempts is how often a publish is attempted by the SDK, which
+	// retries throttled requests with backoff.
+	snsMaxAttempts = 4
+)
+
+// snsAttributeName matches the names SNS accepts for message attributes.
+var snsAttributeName = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9_.-]{0,254}[A-Za-z0-9_-]$|^[A-Za-z0-9_-]$`)
+
+// snsSink publishes rendered events to an SNS topic with the AWS SDK. The
+// event type is the subject of the messages and the capture groups are their
+// message attributes, the named ones first, as far as SNS accepts them.
+type snsSink struct {
+	client   *sns.Client
+	topicARN string
+}
+
+// loadAWSConfig loads the config of the AWS SDK with the default credential
+// chain. No credentials are resolved yet. Requests are sent with the timeout,
+// connection limits and TLS config of client, through a client of the SDK,
+// which adds the certificates of AWS_CA_BUNDLE, if set.
+func loadAWSConfig(client *http.Client) (aws.Config, error) {
+	httpClient := awshttp.NewBuildableClient().WithTimeout(client.Timeout).WithTransportOptions(func(t *http.Transport) {
+		shared, ok := client.Transport.(*http.Transport)
+		if !ok {
+			return
+		}
+		t.MaxIdleConns = shared.MaxIdleConns
+		t.MaxIdleConnsPerHost = shared.MaxIdleConnsPerHost
+		t.IdleConnTimeout = shared.IdleConnTimeout
+		if shared.TLSClientConfig != nil {
+			t.TLSClientConfig = shared.TLSClientConfig.Clone()
+		}
+	})
+	return config.LoadDefaultConfig(context.Background(),
+		config.WithHTTPClient(httpClient),
+		config.WithRetryer(func() aws.Retryer {
+			return retry.AddWithMaxAttempts(retry.NewStandard(), snsMaxAttempts)
+		}),
+	)
+}
+
+// newSNSSink returns a sink publishing to the topic of spec, in the region of
+// the topic and through the regional endpoint unless spec sets a URL.
+func newSNSSink(awsConfig aws.Config, spec SinkConfig) (*snsSink, error) {
+	_, region, err := parseSNSTopicARN(spec.TopicARN)
+	if err != nil {
+		return nil, err
+	}
+	client := sns.NewFromConfig(awsConfig, func(o *sns.Options) {
+		o.Region = region
+		if spec.URL != "" {
+			o.BaseEndpoint = aws.String(spec.URL)
+		}
+	})
+	return &snsSink{client: client, topicARN: spec.TopicARN}, nil
+}
+
+// parseSNSTopicARN returns the partition and region of a topic ARN, like
+// arn:aws:sns:us-east-1:123456789012:alerts.
+func parseSNSTopicARN(arn string) (partition, region string, err error) {
+	parts := strings.Split(arn, ":")
+	if len(parts) != 6 || parts[0] != "arn" || parts[2] != "sns" || parts[3] == "" || parts[5] == "" {
+		return "", "", fmt.Errorf("invalid sns topic_arn %q, expected arn:aws:sns:<region>:<account>:<topic>", arn)
+	}
+	return parts[1], parts[3], nil
+}
+
+func (s *snsSink) Deliver(ctx context.Context, e RenderedEvent) error {
+	input := &sns.PublishInput{
+		TopicArn: aws.String(s.topicARN),
+		Message:  aws.String(string(e.Body)),
+	}
+	if subject := snsSubject(e.EventType); subject != "" {
+		input.Subject = aws.String(subject)
+	}
+	if strings.HasSuffix(s.topicARN, ".fifo") {
+		// FIFO topics order the messages of a group; they have to
+		// deduplicate by content.
+		group := e.EventType
+		if group == "" {
+			group = "sest"
+		}
+		input.MessageGroupId = aws.String(group)
+	}
+	if attrs := snsAttributes(e); len(attrs) > 0 {
+		input.MessageAttributes = make(map[string]types.MessageAttributeValue, len(attrs))
+		for _, attr := range attrs {
+			input.MessageAttributes[attr[0]] = types.MessageAttributeValue{
+				DataType:    aws.String("String"),
+				StringValue: aws.String(attr[1]),
+			}
+		}
+	}
+
+	_, err := s.client.Publish(ctx, input)
+	if err != nil {
+		return snsError(err)
+	}
+	return nil
+}
+
+// snsError marks the errors SNS rejected a publish with as permanent, unless
+// they are worth retrying later, like throttling or expired credentials,
+// which the SDK refreshes.
+func snsError(err error) error {
+	var respErr *awshttp.ResponseError
+	if !errors.As(err, &respErr) || respErr.HTTPStatusCode() < 400 || respErr.HTTPStatusCode() >= 500 {
+		return err
+	}
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		if retry.IsErrorThrottles(retry.DefaultThrottles).IsErrorThrottle(err).Bool() || apiErr.ErrorCode() == "ExpiredToken" {
+			return err
+		}
+		err = fmt.Errorf("sns rejected the publish: %s: %s", apiErr.ErrorCode(), apiErr.ErrorMessage())
+	}
+	return permanent(err)
+}
+
+// snsSubject makes an event type a valid subject: printable ASCII, on one
+// line and shorter than snsMaxSubject.
+func snsSubject(eventType string) string {
+	subject := strings.Map(func(r rune) rune {
+		if r < ' ' || r > '~' {
+			return -1
+		}
+		return r
+	}, eventType)
+	subject = strings.TrimSpace(subject)
+	if len(subject) >= snsMaxSubject {
+		subject = subject[:snsMaxSubject-1]
+	}
+	return subject
+}
+
+// snsAttributes returns the capture groups of an event that are valid
+// message attributes as name and value pairs, the named ones and the fields
+// by name first, then all groups as group1, group2, ..., up to the number of
+// attributes SNS accepts. Empty groups are left out, as SNS rejects empty
+// attributes.
+func snsAttributes(e RenderedEvent) [][2]string {
+	names := make([]string, 0, len(e.Fields))
+	for name, value := range e.Fields {
+		if value != "" && snsAttributeName.MatchString(name) && !snsReservedName(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	var attrs [][2]string
+	for _, name := range names {
+		attrs = append(attrs, [2]string{name, e.Fields[name]})
+	}
+	for i := 1; i < len(e.Groups); i++ {
+		if e.Groups[i] != "" && utf8.ValidString(e.Groups[i]) {
+			attrs = append(attrs, [2]string{"group" + strconv.Itoa(i), e.Groups[i]})
+		}
+	}
+	if len(attrs) > snsMaxAttributes {
+		attrs = attrs[:snsMaxAttributes]
+	}
+	return attrs
+}
+
+func snsReservedName(name string) bool {
+	lower := strings.ToLower(name)
+	return strings.HasPrefix(lower, "aws.") || strings.HasPrefix(lower, "amazon.") || strings.Contains(name, "..")
+}
+
+func (s *snsSink) String() string {
+	return "sns " + s.topicARN
+}
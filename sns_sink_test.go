@@ -0,0 +1,247 @@
+package sest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+)
+
+const (
+	snsPublishResponse = `<PublishResponse xmlns="http://sns.amazonaws.com/doc/2010-03-31/">
+<PublishResult><MessageId>1</MessageId></PublishResult>
+<ResponseMetadata><RequestId>1</RequestId></ResponseMetadata>
+</PublishResponse>`
+	snsErrorResponse = `<ErrorResponse xmlns="http://sns.amazonaws.com/doc/2010-03-31/">
+<Error><Type>Sender</Type><Code>%s</Code><Message>%s</Message></Error>
+<RequestId>1</RequestId>
+</ErrorResponse>`
+)
+
+// snsServer answers publishes with the responses in order, repeating the
+// last one, and records the forms and headers of the requests.
+type snsServer struct {
+	*httptest.Server
+	mu        sync.Mutex
+	responses []snsResponse
+	forms     []url.Values
+	headers   []http.Header
+}
+
+type snsResponse struct {
+	status int
+	code   string
+}
+
+func newSNSServer(t *testing.T, responses ...snsResponse) *snsServer {
+	s := &snsServer{responses: responses}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		s.mu.Lock()
+		s.forms = append(s.forms, r.PostForm)
+		s.headers = append(s.headers, r.Header)
+		resp := snsResponse{status: http.StatusOK}
+		if len(s.responses) > 0 {
+			resp = s.responses[0]
+			if len(s.responses) > 1 {
+				s.responses = s.responses[1:]
+			}
+		}
+		s.mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/xml")
+		w.WriteHeader(resp.status)
+		if resp.code == "" {
+			fmt.Fprint(w, snsPublishResponse)
+		} else {
+			fmt.Fprintf(w, snsErrorResponse, resp.code, "rejected")
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// testSNSSink returns a sink publishing to server with static credentials
+// from the environment. Retries do not back off.
+func testSNSSink(t *testing.T, server *snsServer, topicARN string) *snsSink {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY")
+	t.Setenv("AWS_SESSION_TOKEN", "")
+	t.Setenv("AWS_PROFILE", "")
+	t.Setenv("AWS_CONFIG_FILE", t.TempDir()+"/config")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", t.TempDir()+"/credentials")
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+
+	awsConfig, err := loadAWSConfig(server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	awsConfig.Retryer = func() aws.Retryer {
+		return retry.NewStandard(func(o *retry.StandardOptions) {
+			o.MaxAttempts = snsMaxAttempts
+			o.Backoff = retry.BackoffDelayerFunc(func(int, error) (time.Duration, error) { return 0, nil })
+		})
+	}
+	sink, err := newSNSSink(awsConfig, SinkConfig{TopicARN: topicARN, URL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sink
+}
+
+func TestSNSSinkPublish(t *testing.T) {
+	tests := []struct {
+		name     string
+		topicARN string
+		event    RenderedEvent
+		want     map[string]string
+	}{
+		{
+			name:     "standard topic",
+			topicARN: "arn:aws:sns:eu-west-1:123456789012:alerts",
+			event: RenderedEvent{
+				EventType: "LoginFailed",
+				Body:      []byte("login of alice failed"),
+				Groups:    []string{"alice from 10.0.0.1", "alice", ""},
+				Fields:    map[string]string{"user": "alice"},
+			},
+			want: map[string]string{
+				"Action":                         "Publish",
+				"TopicArn":                       "arn:aws:sns:eu-west-1:123456789012:alerts",
+				"Message":                        "login of alice failed",
+				"Subject":                        "LoginFailed",
+				"MessageGroupId":                 "",
+				"MessageAttributes.entry.1.Name": "group1",
+				"MessageAttributes.entry.1.Value.StringValue": "alice",
+				"MessageAttributes.entry.1.Value.DataType":    "String",
+				"MessageAttributes.entry.2.Name":              "user",
+				"MessageAttributes.entry.2.Value.StringValue": "alice",
+				"MessageAttributes.entry.3.Name":              "",
+			},
+		},
+		{
+			name:     "fifo topic",
+			topicARN: "arn:aws:sns:eu-west-1:123456789012:alerts.fifo",
+			event:    RenderedEvent{EventType: "LoginFailed", Body: []byte("body")},
+			want: map[string]string{
+				"Message":        "body",
+				"MessageGroupId": "LoginFailed",
+			},
+		},
+		{
+			name:     "subject without control characters",
+			topicARN: "arn:aws:sns:eu-west-1:123456789012:alerts",
+			event:    RenderedEvent{EventType: "Login\nFailed", Body: []byte("body")},
+			want:     map[string]string{"Subject": "LoginFailed"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newSNSServer(t)
+			sink := testSNSSink(t, server, tt.topicARN)
+			if err := sink.Deliver(context.Background(), tt.event); err != nil {
+				t.Fatal(err)
+			}
+			if len(server.forms) != 1 {
+				t.Fatalf("got %d requests, want 1", len(server.forms))
+			}
+			for key, want := range tt.want {
+				if got := server.forms[0].Get(key); got != want {
+					t.Errorf("%s = %q, want %q", key, got, want)
+				}
+			}
+			auth := server.headers[0].Get("Authorization")
+			if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/") || !strings.Contains(auth, "/eu-west-1/sns/aws4_request") {
+				t.Errorf("Authorization = %q, want a signature of AKIDEXAMPLE for sns in eu-west-1", auth)
+			}
+		})
+	}
+}
+
+func TestSNSSinkErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		responses []snsResponse
+		requests  int
+		// err is nil for success, else whether it is permanent.
+		err       bool
+		permanent bool
+	}{
+		{
+			name:      "throttled once",
+			responses: []snsResponse{{http.StatusBadRequest, "Throttling"}, {http.StatusOK, ""}},
+			requests:  2,
+		},
+		{
+			name:      "throttled every time",
+			responses: []snsResponse{{http.StatusBadRequest, "Throttling"}},
+			requests:  snsMaxAttempts,
+			err:       true,
+		},
+		{
+			name:      "invalid parameter",
+			responses: []snsResponse{{http.StatusBadRequest, "InvalidParameter"}},
+			requests:  1,
+			err:       true,
+			permanent: true,
+		},
+		{
+			name:      "expired token",
+			responses: []snsResponse{{http.StatusForbidden, "ExpiredToken"}},
+			requests:  1,
+			err:       true,
+		},
+		{
+			name:      "server error",
+			responses: []snsResponse{{http.StatusInternalServerError, "InternalError"}, {http.StatusOK, ""}},
+			requests:  2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newSNSServer(t, tt.responses...)
+			sink := testSNSSink(t, server, "arn:aws:sns:eu-west-1:123456789012:alerts")
+			err := sink.Deliver(context.Background(), RenderedEvent{EventType: "E", Body: []byte("body")})
+			if len(server.forms) != tt.requests {
+				t.Errorf("got %d requests, want %d", len(server.forms), tt.requests)
+			}
+			if (err != nil) != tt.err {
+				t.Fatalf("Deliver() = %v, want error %v", err, tt.err)
+			}
+			var perm permanentError
+			if got := errors.As(err, &perm); got != tt.permanent {
+				t.Errorf("Deliver() = %v, permanent %v, want %v", err, got, tt.permanent)
+			}
+		})
+	}
+}
+
+func TestParseSNSTopicARN(t *testing.T) {
+	tests := []struct {
+		arn       string
+		partition string
+		region    string
+		err       bool
+	}{
+		{arn: "arn:aws:sns:us-east-1:123456789012:alerts", partition: "aws", region: "us-east-1"},
+		{arn: "arn:aws-cn:sns:cn-north-1:123456789012:alerts", partition: "aws-cn", region: "cn-north-1"},
+		{arn: "arn:aws:sqs:us-east-1:123456789012:alerts", err: true},
+		{arn: "arn:aws:sns::123456789012:alerts", err: true},
+		{arn: "alerts", err: true},
+	}
+	for _, tt := range tests {
+		partition, region, err := parseSNSTopicARN(tt.arn)
+		if (err != nil) != tt.err || partition != tt.partition || region != tt.region {
+			t.Errorf("parseSNSTopicARN(%q) = %q, %q, %v", tt.arn, partition, region, err)
+		}
+	}
+}
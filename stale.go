@@ -0,0 +1,69 @@
+package sest
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"time"
+)
+
+// staleCheckInterval is how often the files are checked for staleness.
+const staleCheckInterval = time.Second
+
+// staleAfter returns how long nothing may be written to a file before it is
+// stale, 0 if it never is.
+func (r *Runner) staleAfter(filename string) time.Duration {
+	after := r.cfg.Input.StaleAfter
+	longest := -1
+	for pattern, d := range r.cfg.Input.StaleFiles {
+		if ok, _ := filepath.Match(pattern, filename); ok && len(pattern) > longest {
+			after, longest = d, len(pattern)
+		}
+	}
+	return after
+}
+
+// checkStaleFiles reports the files nothing has been written to for their
+// stale threshold, and the stale files that have been written to again.
+func (r *Runner) checkStaleFiles() {
+	now := time.Now()
+	for _, file := range r.files {
+		if r.isReading(file) {
+			continue
+		}
+		after := r.staleAfter(file.Filename)
+		last := file.lastRead
+		if last.Before(file.opened) {
+			last = file.opened
+		}
+		stale := after > 0 && now.Sub(last) >= after
+		if stale == file.stale {
+			continue
+		}
+		file.stale = stale
+		if !stale {
+			if after > 0 {
+				slog.Info("File is written to again", "file", file.Filename)
+			}
+			staleFiles.WithLabelValues(file.Filename).Set(0)
+			continue
+		}
+		slog.Warn("File is stale", "file", file.Filename, "stale_after", after)
+		staleFiles.WithLabelValues(file.Filename).Set(1)
+		staleTotal.WithLabelValues(file.Filename).Inc()
+		r.deliverStale(file.Filename, after)
+	}
+}
+
+// deliverStale delivers the stale event, if there is one, for a file that
+// went stale.
+func (r *Runner) deliverStale(filename string, after time.Duration) {
+	for _, event := range r.events {
+		if !event.stale {
+			continue
+		}
+		line := []byte(fmt.Sprintf("No writes to %s for %s", filename, after))
+		doc := map[string]interface{}{"StaleAfter": after.String()}
+		r.handleMatch(event, filename, line, []int{0, len(line)}, doc)
+	}
+}
@@ -0,0 +1,202 @@
+package sest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// errorHealthWindow is how long a watcher error makes the Runner unhealthy.
+const errorHealthWindow = time.Minute
+
+// statusTimeout bounds how long the health endpoints wait for the Runner,
+// which is unhealthy if it does not answer in time.
+const statusTimeout = 2 * time.Second
+
+// Status describes the state of a running Runner.
+type Status struct {
+	// Healthy is set if all configured input files are open and there was
+	// no watcher error within the last minute.
+	Healthy     bool         `json:"healthy"`
+	LastError   string       `json:"last_error,omitempty"`
+	LastErrorAt *time.Time   `json:"last_error_at,omitempty"`
+	Files       []FileStatus `json:"files"`
+}
+
+// FileStatus describes an input file.
+type FileStatus struct {
+	Filename string `json:"filename"`
+	Open     bool   `json:"open"`
+	Offset   int64  `json:"offset"`
+	// LastRead is when lines were last read from the file, nil if none
+	// have been read yet.
+	LastRead *time.Time `json:"last_read,omitempty"`
+	// Stale is set if nothing has been written to the file for its stale
+	// threshold.
+	Stale bool `json:"stale,omitempty"`
+	// Size is the size of the file and Lag the bytes written to it that
+	// have not been read yet. Both are left out for pipes and compressed
+	// files, whose offset is not a position in the file.
+	Size *int64 `json:"size,omitempty"`
+	Lag  *int64 `json:"lag,omitempty"`
+	// Lines and Matches are the numbers of lines read from the file and
+	// of matches found in them since sest started.
+	Lines   int64 `json:"lines"`
+	Matches int64 `json:"matches"`
+}
+
+// fileCounters counts the lines read from the inputs and the matches found
+// in them, by filename. It is safe for concurrent use, as files are matched
+// concurrently.
+type fileCounters struct {
+	mu     sync.Mutex
+	counts map[string]*fileCount
+}
+
+type fileCount struct {
+	lines, matches int64
+}
+
+func newFileCounters() *fileCounters {
+	return &fileCounters{counts: make(map[string]*fileCount)}
+}
+
+func (c *fileCounters) addLines(filename string, n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.count(filename).lines += int64(n)
+}
+
+func (c *fileCounters) addMatch(filename string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.count(filename).matches++
+}
+
+func (c *fileCounters) count(filename string) *fileCount {
+	count := c.counts[filename]
+	if count == nil {
+		count = &fileCount{}
+		c.counts[filename] = count
+	}
+	return count
+}
+
+func (c *fileCounters) get(filename string) fileCount {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if count := c.counts[filename]; count != nil {
+		return *count
+	}
+	return fileCount{}
+}
+
+// rename moves the counts of a file followed to its new name.
+func (c *fileCounters) rename(oldName, newName string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if count := c.counts[oldName]; count != nil {
+		c.counts[newName] = count
+		delete(c.counts, oldName)
+	}
+}
+
+// remove forgets the counts of a file that is no longer read.
+func (c *fileCounters) remove(filename string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.counts, filename)
+}
+
+// Status returns the state of the Runner. It has to be called while Run is
+// running.
+func (r *Runner) Status(ctx context.Context) (Status, error) {
+	req := make(chan Status, 1)
+	select {
+	case r.statusReq <- req:
+	case <-r.stop:
+		return Status{}, errors.New("runner is stopped")
+	case <-ctx.Done():
+		return Status{}, ctx.Err()
+	}
+	select {
+	case status := <-req:
+		return status, nil
+	case <-ctx.Done():
+		return Status{}, ctx.Err()
+	}
+}
+
+// status builds the Status from the loop.
+func (r *Runner) status() Status {
+	s := Status{Healthy: true}
+	if r.lastError != nil {
+		at := r.lastErrorAt
+		s.LastError = r.lastError.Error()
+		s.LastErrorAt = &at
+		if time.Since(at) < errorHealthWindow {
+			s.Healthy = false
+		}
+	}
+
+	for _, filename := range r.cfg.Input.Files {
+		if r.files[filename] == nil {
+			s.Healthy = false
+			s.Files = append(s.Files, FileStatus{Filename: filename})
+		}
+	}
+	for filename, file := range r.files {
+		count := r.counts.get(filename)
+		fs := FileStatus{
+			Filename: filename,
+			Open:     true,
+			Offset:   file.GetOffset(),
+			Stale:    file.stale,
+			Lines:    count.lines,
+			Matches:  count.matches,
+		}
+		if lastRead := file.LastRead(); !lastRead.IsZero() {
+			fs.LastRead = &lastRead
+		}
+		if !file.IsPipe() && !isCompressed(filename) {
+			if info, err := file.stat(); err == nil {
+				size, lag := info.Size(), max(info.Size()-fs.Offset, 0)
+				fs.Size, fs.Lag = &size, &lag
+			}
+		}
+		s.Files = append(s.Files, fs)
+	}
+	sort.Slice(s.Files, func(i, j int) bool {
+		return s.Files[i].Filename < s.Files[j].Filename
+	})
+	return s
+}
+
+// serveHealth answers with 200 if the Runner is healthy and 503 otherwise.
+func (r *Runner) serveHealth(w http.ResponseWriter, req *http.Request) {
+	ctx, cancel := context.WithTimeout(req.Context(), statusTimeout)
+	defer cancel()
+	status, err := r.Status(ctx)
+	if err != nil || !status.Healthy {
+		http.Error(w, "unhealthy", http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte("ok\n"))
+}
+
+// serveStatus answers with the Status as JSON.
+func (r *Runner) serveStatus(w http.ResponseWriter, req *http.Request) {
+	ctx, cancel := context.WithTimeout(req.Context(), statusTimeout)
+	defer cancel()
+	status, err := r.Status(ctx)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
@@ -0,0 +1,45 @@
+package sest
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+)
+
+// stdinName is the filename of the lines read from stdin, in templates,
+// metrics and the files of the input config.
+const stdinName = "-"
+
+// readStdin reads the lines of in and sends them to chunks until in is
+// exhausted or the Runner is stopped. chunks is closed when it returns.
+func (r *Runner) readStdin(in io.Reader, maxRead int64, splitter lineSplitter, chunks chan<- []byte) {
+	defer close(chunks)
+	err := readStream(stdinName, in, maxRead, splitter, func(lines []byte) bool {
+		select {
+		case chunks <- lines:
+			return true
+		case <-r.stop:
+			return false
+		}
+	})
+	if err != nil {
+		slog.Error("Could not read stdin", "err", err)
+	}
+}
+
+// handleStdin matches the events against a chunk read from stdin.
+func (r *Runner) handleStdin(chunk []byte) {
+	linesRead.WithLabelValues(stdinName).Add(float64(bytes.Count(chunk, []byte{'\n'})))
+	bytesRead.WithLabelValues(stdinName).Add(float64(len(chunk)))
+	r.matchLines(stdinName, &r.stdinBlocks, chunk)
+}
+
+// closeStdin matches the pending multiline block once stdin is exhausted. If
+// stdin is the only input there is nothing left to do, so the Runner stops.
+func (r *Runner) closeStdin() {
+	slog.Info("Read stdin to the end")
+	r.flushBlocks(stdinName, &r.stdinBlocks, true)
+	if len(r.cfg.Input.Files) == 0 && len(r.cfg.Input.Directories) == 0 {
+		r.Stop()
+	}
+}
@@ -0,0 +1,108 @@
+package sest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+)
+
+// matchAll is the regex of events without src, which match whole records.
+var matchAll = regexp.MustCompile(`(?s).*`)
+
+// decodeJSON decodes a JSON object, keeping numbers as they are written.
+func decodeJSON(text []byte) (map[string]interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(text))
+	dec.UseNumber()
+	var doc map[string]interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	if doc == nil {
+		return nil, errors.New("not a JSON object")
+	}
+	return doc, nil
+}
+
+// fieldString formats a decoded value for field filters and the fields
+// of rendered events. Strings are used as they are, other values as JSON.
+func fieldString(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	content, err := json.Marshal(value)
+	if err != nil {
+		return ""
+	}
+	return string(content)
+}
+
+// matchesFields reports whether the decoded fields of a record match all
+// field filters of the event.
+func (e Event) matchesFields(doc map[string]interface{}) bool {
+	for key, re := range e.Fields {
+		value, ok := doc[key]
+		if !ok || !re.MatchString(fieldString(value)) {
+			return false
+		}
+	}
+	return true
+}
+
+// decodeRecord decodes a record in the given format, json or logfmt.
+func decodeRecord(format string, record []byte) (map[string]interface{}, error) {
+	switch format {
+	case "json":
+		return decodeJSON(record)
+	case "logfmt":
+		return parseLogfmt(record)
+	}
+	return nil, fmt.Errorf("unknown format %s", format)
+}
+
+// matchRecord matches events with a structured format against a record, a
+// line or a multiline block, which is decoded once per format. Records that
+// cannot be decoded are matched like text by the events without field
+// filters if fallback is set, and skipped otherwise.
+func (r *Runner) matchRecord(events []Event, filename string, record []byte, fallback bool) {
+	record = bytes.TrimRight(record, "\r\n")
+	if len(bytes.TrimSpace(record)) == 0 {
+		return
+	}
+
+	docs := make(map[string]map[string]interface{})
+	decodeErrs := make(map[string]error)
+	for _, event := range events {
+		// Records failing the prefilter need not be decoded at all.
+		if !event.passes(record) {
+			continue
+		}
+		doc, decoded := docs[event.Format]
+		if !decoded && decodeErrs[event.Format] == nil {
+			var err error
+			if doc, err = decodeRecord(event.Format, record); err != nil {
+				slog.Debug("Could not decode line", "file", filename, "format", event.Format, "err", err)
+				decodeErrs[event.Format] = err
+			} else {
+				docs[event.Format] = doc
+			}
+		}
+
+		if doc == nil {
+			if fallback && len(event.Fields) == 0 {
+				if variant, submatches := event.find(record); submatches != nil {
+					r.handleMatch(variant, filename, record, submatches, nil)
+				}
+			}
+			continue
+		}
+		if !event.matchesFields(doc) {
+			continue
+		}
+		if variant, submatches := event.find(record); submatches != nil {
+			r.handleMatch(variant, filename, record, submatches, doc)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package sest
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	syslogSeverityInfo = 6
+	syslogMinBackoff   = time.Second
+	syslogMaxBackoff   = time.Minute
+	// syslogTimeout bounds connecting and writing a message.
+	syslogTimeout = 5 * time.Second
+)
+
+var syslogFacilities = map[string]int{
+	"kern":     0,
+	"user":     1,
+	"mail":     2,
+	"daemon":   3,
+	"auth":     4,
+	"syslog":   5,
+	"lpr":      6,
+	"news":     7,
+	"uucp":     8,
+	"cron":     9,
+	"authpriv": 10,
+	"ftp":      11,
+	"local0":   16,
+	"local1":   17,
+	"local2":   18,
+	"local3":   19,
+	"local4":   20,
+	"local5":   21,
+	"local6":   22,
+	"local7":   23,
+}
+
+var localSyslogSockets = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// syslogSink sends RFC 5424 formatted messages to a local or remote syslog
+// daemon. A broken connection is reestablished on the next write, backing off
+// exponentially while the daemon stays unreachable.
+type syslogSink struct {
+	mu       sync.Mutex
+	network  string
+	address  string
+	facility int
+	tag      string
+	hostname string
+	// tls configures the connections of the tls network.
+	tls     *tls.Config
+	conn    net.Conn
+	backoff time.Duration
+	retryAt time.Time
+}
+
+func newSyslogSink(network, address, facility, tag string, tlsConfig *tls.Config) (*syslogSink, error) {
+	if facility == "" {
+		facility = "user"
+	}
+	code, ok := syslogFacilities[strings.ToLower(facility)]
+	if !ok {
+		return nil, fmt.Errorf("unknown syslog facility %s", facility)
+	}
+	if tag == "" {
+		tag = "sest"
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "-"
+	}
+	return &syslogSink{
+		network:  network,
+		address:  address,
+		facility: code,
+		tag:      tag,
+		hostname: hostname,
+		tls:      tlsConfig,
+	}, nil
+}
+
+func (s *syslogSink) Deliver(ctx context.Context, e RenderedEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	msg := s.format(e.EventType, e.Body)
+
+	if s.conn != nil {
+		s.conn.SetWriteDeadline(ioDeadline(ctx, syslogTimeout))
+		if _, err := s.conn.Write(msg); err == nil {
+			return nil
+		}
+		s.conn.Close()
+		s.conn = nil
+	}
+
+	if err := s.connect(ctx); err != nil {
+		return err
+	}
+	s.conn.SetWriteDeadline(ioDeadline(ctx, syslogTimeout))
+	if _, err := s.conn.Write(msg); err != nil {
+		s.conn.Close()
+		s.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (s *syslogSink) connect(ctx context.Context) error {
+	if now := time.Now(); now.Before(s.retryAt) {
+		return fmt.Errorf("syslog unreachable, reconnecting in %v", s.retryAt.Sub(now).Round(time.Millisecond))
+	}
+
+	conn, err := s.dial(ctx)
+	if err != nil {
+		if s.backoff == 0 {
+			s.backoff = syslogMinBackoff
+		} else if s.backoff *= 2; s.backoff > syslogMaxBackoff {
+			s.backoff = syslogMaxBackoff
+		}
+		s.retryAt = time.Now().Add(s.backoff)
+		return err
+	}
+
+	s.conn = conn
+	s.backoff = 0
+	s.retryAt = time.Time{}
+	return nil
+}
+
+func (s *syslogSink) dial(ctx context.Context) (net.Conn, error) {
+	dialer := net.Dialer{Timeout: syslogTimeout}
+	if s.network == "tls" {
+		tlsDialer := tls.Dialer{NetDialer: &dialer, Config: s.tls}
+		return tlsDialer.DialContext(ctx, "tcp", s.address)
+	}
+	if s.network != "" {
+		return dialer.DialContext(ctx, s.network, s.address)
+	}
+	for _, socket := range localSyslogSockets {
+		for _, network := range []string{"unixgram", "unix"} {
+			if conn, err := dialer.DialContext(ctx, network, socket); err == nil {
+				return conn, nil
+			}
+		}
+	}
+	return nil, errors.New("no local syslog socket found")
+}
+
+// format builds a RFC 5424 message using the event type as MSGID. Stream
+// transports get octet-counting framing as described in RFC 6587.
+func (s *syslogSink) format(eventType string, body []byte) []byte {
+	msgID := "-"
+	if eventType != "" {
+		msgID = strings.Map(func(r rune) rune {
+			if r < 33 || r > 126 {
+				return '_'
+			}
+			return r
+		}, eventType)
+		if len(msgID) > 32 {
+			msgID = msgID[:32]
+		}
+	}
+
+	msg := fmt.Sprintf("<%d>1 %s %s %s %d %s - %s",
+		s.facility*8+syslogSeverityInfo,
+		time.Now().Format(time.RFC3339Nano),
+		s.hostname,
+		s.tag,
+		os.Getpid(),
+		msgID,
+		strings.TrimRight(string(body), "\n"),
+	)
+
+	if s.network == "tcp" || s.network == "tcp4" || s.network == "tcp6" || s.network == "tls" {
+		msg = fmt.Sprintf("%d %s", len(msg), msg)
+	}
+	return []byte(msg)
+}
+
+func (s *syslogSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+func (s *syslogSink) String() string {
+	if s.network == "" {
+		return "syslog"
+	}
+	return "syslog " + s.network + "://" + s.address
+}
@@ -0,0 +1,154 @@
+package sest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	tcpTimeout      = 5 * time.Second
+	tcpMinBackoff   = time.Second
+	tcpMaxBackoff   = time.Minute
+	tcpWriteTimeout = 5 * time.Second
+)
+
+// tcpSink writes rendered events as lines to a persistent TCP connection,
+// e.g. to the tcp input of Logstash with the json_lines codec. Newlines in
+// the bodies are replaced with spaces, so every event is a single line.
+// Every delivery flushes its line before it succeeds, so an event is only
+// reported delivered once it was written to the connection. A broken
+// connection, including one closed by the peer, is reestablished on the next
+// delivery, backing off exponentially while the peer stays unreachable.
+type tcpSink struct {
+	mu           sync.Mutex
+	addr         string
+	writeTimeout time.Duration
+	// tls, if not nil, makes connections use TLS.
+	tls     *tls.Config
+	conn    net.Conn
+	writer  *bufio.Writer
+	backoff time.Duration
+	retryAt time.Time
+}
+
+func newTCPSink(addr string, writeTimeout time.Duration, tlsConfig *tls.Config) *tcpSink {
+	if writeTimeout <= 0 {
+		writeTimeout = tcpWriteTimeout
+	}
+	return &tcpSink{addr: addr, writeTimeout: writeTimeout, tls: tlsConfig}
+}
+
+func (s *tcpSink) Deliver(ctx context.Context, e RenderedEvent) error {
+	line := tcpLine(e.Body)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		if err := s.connect(ctx); err != nil {
+			return err
+		}
+	}
+	s.conn.SetWriteDeadline(ioDeadline(ctx, s.writeTimeout))
+	// A line that was only partially written is discarded with the
+	// connection, and the event retried as a whole.
+	s.writer.Write(line)
+	if err := s.writer.Flush(); err != nil {
+		s.disconnect()
+		return err
+	}
+	return nil
+}
+
+// tcpLine returns body as a single, newline terminated line, replacing the
+// line breaks in it with spaces.
+func tcpLine(body []byte) []byte {
+	body = bytes.TrimRight(body, "\r\n")
+	line := make([]byte, 0, len(body)+1)
+	for i := 0; i < len(body); i++ {
+		switch c := body[i]; {
+		case c == '\r' && i+1 < len(body) && body[i+1] == '\n':
+		case c == '\r' || c == '\n':
+			line = append(line, ' ')
+		default:
+			line = append(line, c)
+		}
+	}
+	return append(line, '\n')
+}
+
+func (s *tcpSink) connect(ctx context.Context) error {
+	if now := time.Now(); now.Before(s.retryAt) {
+		return fmt.Errorf("%s unreachable, reconnecting in %v", s.addr, s.retryAt.Sub(now).Round(time.Millisecond))
+	}
+
+	err := s.dial(ctx)
+	if err != nil {
+		if s.backoff == 0 {
+			s.backoff = tcpMinBackoff
+		} else if s.backoff *= 2; s.backoff > tcpMaxBackoff {
+			s.backoff = tcpMaxBackoff
+		}
+		s.retryAt = time.Now().Add(s.backoff)
+		return err
+	}
+
+	s.backoff = 0
+	s.retryAt = time.Time{}
+	return nil
+}
+
+func (s *tcpSink) dial(ctx context.Context) error {
+	dialer := &net.Dialer{Timeout: tcpTimeout}
+	var conn net.Conn
+	var err error
+	if s.tls != nil {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: s.tls}).DialContext(ctx, "tcp", s.addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", s.addr)
+	}
+	if err != nil {
+		return err
+	}
+	s.conn, s.writer = conn, bufio.NewWriter(conn)
+	go s.watch(conn)
+	return nil
+}
+
+// watch discards what the peer sends on conn until the connection is closed,
+// then disconnects, so the next delivery reconnects instead of writing to a
+// connection the peer closed.
+func (s *tcpSink) watch(conn net.Conn) {
+	io.Copy(ioutil.Discard, conn)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == conn {
+		s.disconnect()
+	}
+}
+
+func (s *tcpSink) disconnect() {
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	s.conn, s.writer = nil, nil
+}
+
+func (s *tcpSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.disconnect()
+	return nil
+}
+
+func (s *tcpSink) String() string {
+	return "tcp " + s.addr
+}
@@ -0,0 +1,115 @@
+package sest
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTCPLine(t *testing.T) {
+	tests := []struct {
+		body string
+		want string
+	}{
+		{"event", "event\n"},
+		{"event\n", "event\n"},
+		{"event\r\n\n", "event\n"},
+		{"first\nsecond", "first second\n"},
+		{"first\r\nsecond\rthird", "first second third\n"},
+		{"", "\n"},
+	}
+	for _, tt := range tests {
+		if got := string(tcpLine([]byte(tt.body))); got != tt.want {
+			t.Errorf("tcpLine(%q) = %q, want %q", tt.body, got, tt.want)
+		}
+	}
+}
+
+// TestTCPSinkConnectionKilledMidBatch delivers events concurrently while the
+// peer closes the connection, and checks that every event reported delivered
+// was received, before or after reconnecting.
+func TestTCPSinkConnectionKilledMidBatch(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	var mu sync.Mutex
+	received := make(map[string]bool)
+	read := func(conn net.Conn, stallAfter int) {
+		defer conn.Close()
+		scanner := bufio.NewScanner(conn)
+		for n := 1; scanner.Scan(); n++ {
+			mu.Lock()
+			received[scanner.Text()] = true
+			mu.Unlock()
+			if n == stallAfter {
+				time.Sleep(100 * time.Millisecond)
+			} else if n > stallAfter && stallAfter > 0 {
+				return
+			}
+		}
+	}
+	accepted := make(chan struct{})
+	go func() {
+		defer close(accepted)
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			read(conn, 0)
+		}
+	}()
+
+	s := newTCPSink(ln.Addr().String(), time.Second, nil)
+	// The first connection is unbuffered and closed by the peer after two
+	// lines. The peer stalls after the first, so that the other deliveries
+	// queue up behind it.
+	client, server := net.Pipe()
+	s.conn, s.writer = client, bufio.NewWriter(client)
+	piped := make(chan struct{})
+	go func() {
+		defer close(piped)
+		read(server, 1)
+	}()
+
+	const events = 20
+	errs := make([]error, events)
+	var deliveries sync.WaitGroup
+	for i := 0; i < events; i++ {
+		deliveries.Add(1)
+		go func(i int) {
+			defer deliveries.Done()
+			errs[i] = s.Deliver(context.Background(), RenderedEvent{Body: []byte(fmt.Sprintf("event %d", i))})
+		}(i)
+	}
+	deliveries.Wait()
+	s.Close()
+	<-piped
+	ln.Close()
+	<-accepted
+
+	failed := 0
+	for i, err := range errs {
+		body := fmt.Sprintf("event %d", i)
+		if err != nil {
+			failed++
+			continue
+		}
+		if !received[body] {
+			t.Errorf("%s was reported delivered, but not received", body)
+		}
+	}
+	if failed == 0 {
+		t.Error("no delivery failed, although the connection was closed")
+	}
+	if failed == events {
+		t.Error("every delivery failed, although the sink could reconnect")
+	}
+}
@@ -0,0 +1,123 @@
+package sest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// templateFunctions are the functions available in event templates, which
+// are documented in the package documentation.
+var templateFunctions template.FuncMap
+
+func init() {
+	templateFunctions = template.FuncMap{
+		"timestamp":     timestampIn(time.Local),
+		"unixTimestamp": unixTimestamp,
+		"unixMillis":    unixMillis,
+		"toJson":        toJSON,
+		"toPrettyJson":  toPrettyJSON,
+		"env":           os.Getenv,
+		"hostname":      os.Hostname,
+		"default":       defaultValue,
+		"upper":         strings.ToUpper,
+		"lower":         strings.ToLower,
+		"trim":          trim,
+		"trimSpace":     strings.TrimSpace,
+		"replace":       replace,
+		"split":         split,
+	}
+}
+
+// defaultTimestampLayout is the layout of timestamp without an argument.
+const defaultTimestampLayout = "2006-01-02T15:04:05-0700"
+
+// timestampIn returns the timestamp function of events in loc. It formats
+// the current time with the layout given, see time.Layout, or with
+// defaultTimestampLayout.
+func timestampIn(loc *time.Location) func(layout ...string) (string, error) {
+	return func(layout ...string) (string, error) {
+		now := time.Now().In(loc)
+		switch len(layout) {
+		case 0:
+			return now.Format(defaultTimestampLayout), nil
+		case 1:
+			return now.Format(layout[0]), nil
+		default:
+			return "", fmt.Errorf("timestamp takes at most one layout, got %d", len(layout))
+		}
+	}
+}
+
+// unixTimestamp returns the current time in seconds since the Unix epoch.
+func unixTimestamp() int64 {
+	return time.Now().Unix()
+}
+
+// unixMillis returns the current time in milliseconds since the Unix epoch.
+func unixMillis() int64 {
+	return time.Now().UnixMilli()
+}
+
+// defaultValue returns given unless it is empty, i.e. missing or the zero
+// value of its type, in which case def is returned. Its argument order allows
+// piping, as in {{.user | default "unknown"}}.
+func defaultValue(def, given interface{}) interface{} {
+	if given == nil {
+		return def
+	}
+	v := reflect.ValueOf(given)
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Array, reflect.String:
+		if v.Len() == 0 {
+			return def
+		}
+	default:
+		if v.IsZero() {
+			return def
+		}
+	}
+	return given
+}
+
+// toJSON encodes a value as JSON, e.g. to quote a capture group in a JSON
+// payload. Unlike json.Marshal it leaves <, > and & unescaped.
+func toJSON(value interface{}) (string, error) {
+	return encodeJSON(value, "")
+}
+
+// toPrettyJSON encodes a value as indented JSON.
+func toPrettyJSON(value interface{}) (string, error) {
+	return encodeJSON(value, "  ")
+}
+
+func encodeJSON(value interface{}, indent string) (string, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", indent)
+	if err := enc.Encode(value); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// trim, replace and split wrap their strings counterparts, taking the string
+// last for use in pipelines.
+
+func trim(cutset, s string) string {
+	return strings.Trim(s, cutset)
+}
+
+func replace(old, new, s string) string {
+	return strings.ReplaceAll(s, old, new)
+}
+
+func split(sep, s string) []string {
+	return strings.Split(s, sep)
+}
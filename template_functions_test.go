@@ -0,0 +1,153 @@
+package sest
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+// execTemplate executes text with the template functions of events on data.
+func execTemplate(t *testing.T, text string, data interface{}) (string, error) {
+	t.Helper()
+	tmpl, err := template.New("test").Funcs(templateFunctions).Parse(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	err = tmpl.Execute(&b, data)
+	return b.String(), err
+}
+
+func TestToJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		data     interface{}
+		want     string
+	}{
+		{name: "string", template: `{{toJson .}}`, data: "alice", want: `"alice"`},
+		{name: "quotes and backslashes", template: `{{toJson .}}`, data: `say "hi" \o/`, want: `"say \"hi\" \\o/"`},
+		{name: "control characters", template: `{{toJson .}}`, data: "a\tb\nc\x01", want: `"a\tb\nc\u0001"`},
+		{name: "html left alone", template: `{{toJson .}}`, data: "<a href='x'>&</a>", want: `"<a href='x'>&</a>"`},
+		{name: "unicode", template: `{{toJson .}}`, data: "grüße", want: `"grüße"`},
+		{name: "map", template: `{{toJson .}}`, data: map[string]string{"b": "2", "a": "1"}, want: `{"a":"1","b":"2"}`},
+		{name: "number", template: `{{toJson .}}`, data: 42, want: `42`},
+		{name: "nil", template: `{{toJson .}}`, data: nil, want: `null`},
+		{name: "pipeline", template: `{"status":{{. | toJson}}}`, data: "5\"00", want: `{"status":"5\"00"}`},
+		{name: "pretty", template: `{{toPrettyJson .}}`, data: map[string]int{"a": 1, "b": 2}, want: "{\n  \"a\": 1,\n  \"b\": 2\n}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := execTemplate(t, tt.template, tt.data)
+			if err != nil || got != tt.want {
+				t.Errorf("%s = %s, %v, want %s", tt.template, got, err, tt.want)
+			}
+		})
+	}
+}
+
+// TestToJSONCaptureGroups checks that capture groups are escaped in a JSON
+// payload built by an event template.
+func TestToJSONCaptureGroups(t *testing.T) {
+	e := testEvent(t, `user (?P<user>.+) said (?P<message>.+)`, `{"user":{{toJson .user}},"message":{{.message | toJson}}}`, false)
+	rendered, err := render(t, e, `user "alice" said a\b <c>`)
+	if want := `{"user":"\"alice\"","message":"a\\b <c>"}`; err != nil || string(rendered.Body) != want {
+		t.Errorf("Render() = %s, %v, want %s", rendered.Body, err, want)
+	}
+}
+
+func TestToJSONError(t *testing.T) {
+	if got, err := execTemplate(t, `{{toJson .}}`, func() {}); err == nil {
+		t.Errorf("toJson of a func = %s, want an error", got)
+	}
+}
+
+func TestEnv(t *testing.T) {
+	t.Setenv("SEST_TEST_ENV", "production")
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{template: `{{env "SEST_TEST_ENV"}}`, want: "production"},
+		{template: `{{env "SEST_TEST_UNSET"}}`, want: ""},
+		{template: `{{env "SEST_TEST_UNSET" | default "dev"}}`, want: "dev"},
+	}
+	for _, tt := range tests {
+		got, err := execTemplate(t, tt.template, nil)
+		if err != nil || got != tt.want {
+			t.Errorf("%s = %q, %v, want %q", tt.template, got, err, tt.want)
+		}
+	}
+}
+
+func TestHostname(t *testing.T) {
+	want, err := os.Hostname()
+	if err != nil {
+		t.Skip(err)
+	}
+	if got, err := execTemplate(t, `{{hostname}}`, nil); err != nil || got != want {
+		t.Errorf("hostname = %q, %v, want %q", got, err, want)
+	}
+}
+
+func TestDefault(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		data     map[string]interface{}
+		want     string
+	}{
+		{name: "set", template: `{{.user | default "unknown"}}`, data: map[string]interface{}{"user": "alice"}, want: "alice"},
+		{name: "missing", template: `{{.user | default "unknown"}}`, want: "unknown"},
+		{name: "empty string", template: `{{.user | default "unknown"}}`, data: map[string]interface{}{"user": ""}, want: "unknown"},
+		{name: "zero", template: `{{.count | default 1}}`, data: map[string]interface{}{"count": 0}, want: "1"},
+		{name: "false", template: `{{.ok | default "no"}}`, data: map[string]interface{}{"ok": false}, want: "no"},
+		{name: "empty slice", template: `{{.items | default "none"}}`, data: map[string]interface{}{"items": []string{}}, want: "none"},
+		{name: "argument order", template: `{{default "unknown" .user}}`, data: map[string]interface{}{"user": "bob"}, want: "bob"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := execTemplate(t, tt.template, tt.data)
+			if err != nil || got != tt.want {
+				t.Errorf("%s = %q, %v, want %q", tt.template, got, err, tt.want)
+			}
+		})
+	}
+}
+
+// TestDefaultUnmatchedGroup checks the fallback for an optional capture group
+// that did not take part in the match.
+func TestDefaultUnmatchedGroup(t *testing.T) {
+	e := testEvent(t, `login of (?P<user>\w+)(?: from (?P<host>\w+))?`, `{{.user}} from {{.host | default "unknown"}}`, false)
+	rendered, err := render(t, e, "login of alice")
+	if want := "alice from unknown"; err != nil || string(rendered.Body) != want {
+		t.Errorf("Render() = %q, %v, want %q", rendered.Body, err, want)
+	}
+}
+
+func TestStringFunctions(t *testing.T) {
+	tests := []struct {
+		template string
+		data     string
+		want     string
+	}{
+		{template: `{{upper .}}`, data: "warn", want: "WARN"},
+		{template: `{{lower .}}`, data: "WARN", want: "warn"},
+		{template: `{{trim "/" .}}`, data: "/var/log/", want: "var/log"},
+		{template: `{{. | trim "[]"}}`, data: "[error]", want: "error"},
+		{template: `{{trimSpace .}}`, data: " \t/var/log \n", want: "/var/log"},
+		{template: `{{replace "/" "." .}}`, data: "a/b/c", want: "a.b.c"},
+		{template: `{{. | replace "x" "y"}}`, data: "abc", want: "abc"},
+		{template: `{{split "," .}}`, data: "a,b,c", want: "[a b c]"},
+		{template: `{{index (split "," .) 1}}`, data: "a,b,c", want: "b"},
+		{template: `{{range split ":" .}}<{{.}}>{{end}}`, data: "a::b", want: "<a><><b>"},
+		{template: `{{. | trimSpace | lower | replace " " "_"}}`, data: " Disk Full ", want: "disk_full"},
+	}
+	for _, tt := range tests {
+		got, err := execTemplate(t, tt.template, tt.data)
+		if err != nil || got != tt.want {
+			t.Errorf("%s on %q = %q, %v, want %q", tt.template, tt.data, got, err, tt.want)
+		}
+	}
+}
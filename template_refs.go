@@ -0,0 +1,110 @@
+package sest
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// unresolvedRefs reports the references of a template to data that a match of
+// re never sets: groups beyond the capture groups of re and names that are
+// neither capture groups, tags, extra data nor the data every event has.
+// References below with and range, where dot is something else, are not
+// checked.
+func unresolvedRefs(t *template.Template, re *regexp.Regexp, tags map[string]string, extra []string) []error {
+	known := map[string]bool{
+		"Filename":    true,
+		"EventType":   true,
+		"ChannelName": true,
+		"Line":        true,
+		"Suppressed":  true,
+		"Severity":    true,
+	}
+	for i := 0; i <= re.NumSubexp(); i++ {
+		known["group"+strconv.Itoa(i)] = true
+	}
+	for _, name := range re.SubexpNames() {
+		if name != "" {
+			known[name] = true
+		}
+	}
+	for name := range tags {
+		known[name] = true
+	}
+	for _, name := range extra {
+		known[name] = true
+	}
+
+	var errs []error
+	reported := make(map[string]bool)
+	for _, name := range templateRefs(t.Tree.Root) {
+		if known[name] || reported[name] {
+			continue
+		}
+		reported[name] = true
+		if n, ok := strings.CutPrefix(name, "group"); ok {
+			if _, err := strconv.Atoi(n); err == nil {
+				errs = append(errs, fmt.Errorf("template refers to .%s, but the last capture group of src is group%d", name, re.NumSubexp()))
+				continue
+			}
+		}
+		errs = append(errs, fmt.Errorf("template refers to .%s, which is neither a capture group of src nor a tag", name))
+	}
+	return errs
+}
+
+// templateRefs returns the names of the top-level data referenced by the
+// template below node, like user in {{.user}} or {{$.user.name}}.
+func templateRefs(node parse.Node) []string {
+	var refs []string
+	var walk func(parse.Node)
+	walk = func(node parse.Node) {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, child := range n.Nodes {
+				walk(child)
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe)
+		case *parse.IfNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.WithNode:
+			walk(n.Pipe)
+			walk(n.ElseList)
+		case *parse.RangeNode:
+			walk(n.Pipe)
+			walk(n.ElseList)
+		case *parse.TemplateNode:
+			walk(n.Pipe)
+		case *parse.PipeNode:
+			if n == nil {
+				return
+			}
+			for _, cmd := range n.Cmds {
+				walk(cmd)
+			}
+		case *parse.CommandNode:
+			for _, arg := range n.Args {
+				walk(arg)
+			}
+		case *parse.ChainNode:
+			walk(n.Node)
+		case *parse.FieldNode:
+			refs = append(refs, n.Ident[0])
+		case *parse.VariableNode:
+			if len(n.Ident) > 1 && n.Ident[0] == "$" {
+				refs = append(refs, n.Ident[1])
+			}
+		}
+	}
+	walk(node)
+	return refs
+}
@@ -0,0 +1,46 @@
+package sest
+
+import (
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// templateCheckInterval is how often template files are checked for changes.
+const templateCheckInterval = time.Second
+
+// reloadTemplates rereads the template files that changed since they were
+// last read and swaps in their new content. A template that does not parse
+// anymore is reported and the previous one kept until the file changes
+// again.
+func (r *Runner) reloadTemplates() {
+	for i := range r.events {
+		e := &r.events[i]
+		if e.templateFile == "" {
+			continue
+		}
+		info, err := os.Stat(e.templateFile)
+		if err != nil || (e.templateInfo != nil && info.ModTime().Equal(e.templateInfo.ModTime()) && info.Size() == e.templateInfo.Size()) {
+			continue
+		}
+		// The events are in use while files are being read.
+		r.waitReads()
+		e.templateInfo = info
+
+		content, err := ioutil.ReadFile(e.templateFile)
+		if err != nil {
+			slog.Error("Could not read changed template, keeping the previous one", "event_type", e.EventType, "file", e.templateFile, "err", err)
+			continue
+		}
+		changed := *e
+		changed.Template = content
+		compiled, err := changed.parse()
+		if err != nil {
+			slog.Error("Could not parse changed template, keeping the previous one", "event_type", e.EventType, "file", e.templateFile, "err", err)
+			continue
+		}
+		e.Template, e.compiled = content, compiled
+		slog.Info("Reloaded template", "event_type", e.EventType, "file", e.templateFile)
+	}
+}
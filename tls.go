@@ -0,0 +1,73 @@
+package sest
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+// newTLSConfig returns the TLS config of the network sinks, nil if the config
+// sets no TLS options, leaving the defaults of the sinks. The certificates
+// are loaded once, when the sinks are created.
+func newTLSConfig(cfg Config) (*tls.Config, error) {
+	t := cfg.TLS
+	if t.CAFile == "" && t.CertFile == "" && t.KeyFile == "" && !t.InsecureSkipVerify {
+		return nil, nil
+	}
+	config := &tls.Config{InsecureSkipVerify: t.InsecureSkipVerify}
+	if t.CAFile != "" {
+		roots, err := loadCertPool(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("tls ca_file: %w", err)
+		}
+		config.RootCAs = roots
+	}
+	if t.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("tls cert_file and key_file: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// enableTLS returns the TLS config of a sink with TLS enabled or not, the
+// default one if config is nil.
+func enableTLS(enabled bool, config *tls.Config) *tls.Config {
+	if !enabled {
+		return nil
+	}
+	if config == nil {
+		return &tls.Config{}
+	}
+	return config
+}
+
+// loadCertPool returns the system certificate pool with the PEM certificates
+// of file added.
+func loadCertPool(file string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		roots = x509.NewCertPool()
+	}
+	if !roots.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no PEM certificates in %s", file)
+	}
+	return roots, nil
+}
+
+// validateTLS checks that the certificates of the TLS config load.
+func (cfg *Config) validateTLS() error {
+	if (cfg.TLS.CertFile == "") != (cfg.TLS.KeyFile == "") {
+		return errors.New("tls cert_file and key_file must be set together")
+	}
+	_, err := newTLSConfig(*cfg)
+	return err
+}
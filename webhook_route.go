@@ -0,0 +1,132 @@
+package sest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// webhookMethods are the methods a webhook sink can send events with.
+var webhookMethods = map[string]bool{"POST": true, "PUT": true, "PATCH": true, "DELETE": true}
+
+// webhookRoute renders the URL and method of a webhook sink for an event,
+// with the routeData of the event.
+type webhookRoute struct {
+	url    *template.Template
+	method *template.Template
+}
+
+// isTemplate reports whether text is a template rather than a plain value.
+func isTemplate(text string) bool {
+	return strings.Contains(text, "{{")
+}
+
+// newWebhookRoute returns the route of a webhook sink, nil if neither the URL
+// nor the method is a template.
+func newWebhookRoute(rawURL, method string) (*webhookRoute, error) {
+	if !isTemplate(rawURL) && !isTemplate(method) {
+		return nil, nil
+	}
+	var r webhookRoute
+	var err error
+	if r.url, err = parseRouteTemplate("webhook url", rawURL); err != nil {
+		return nil, err
+	}
+	if r.method, err = parseRouteTemplate("webhook method", method); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func parseRouteTemplate(name, text string) (*template.Template, error) {
+	t, err := template.New(name).Funcs(templateFunctions).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("%s does not parse: %v", name, err)
+	}
+	return t, nil
+}
+
+// routeData returns the data of the templates routing e, its capture groups
+// as group0, group1, ..., its fields by name and its EventType, ChannelName,
+// Filename, Line and Severity.
+func routeData(e RenderedEvent) map[string]interface{} {
+	data := make(map[string]interface{}, len(e.Fields)+len(e.Groups)+5)
+	for i, group := range e.Groups {
+		data["group"+strconv.Itoa(i)] = group
+	}
+	for name, value := range e.Fields {
+		data[name] = value
+	}
+	data["EventType"] = e.EventType
+	data["ChannelName"] = e.ChannelName
+	data["Filename"] = e.Filename
+	data["Line"] = e.Line
+	data["Severity"] = e.Severity.String()
+	return data
+}
+
+// render returns the method and URL of a request delivering e.
+func (r *webhookRoute) render(e RenderedEvent) (method, rawURL string, err error) {
+	data := routeData(e)
+	var b bytes.Buffer
+	if err := r.method.Execute(&b, data); err != nil {
+		return "", "", fmt.Errorf("could not render webhook method: %v", err)
+	}
+	method = strings.ToUpper(strings.TrimSpace(b.String()))
+	if err := validWebhookMethod(method); err != nil {
+		return "", "", err
+	}
+	b.Reset()
+	if err := r.url.Execute(&b, data); err != nil {
+		return "", "", fmt.Errorf("could not render webhook url: %v", err)
+	}
+	rawURL = strings.TrimSpace(b.String())
+	if err := validWebhookURL(rawURL); err != nil {
+		return "", "", err
+	}
+	return method, rawURL, nil
+}
+
+// validateWebhookRoute checks the URL and method of a webhook sink config,
+// which are only parsed if they are templates.
+func validateWebhookRoute(spec SinkConfig) error {
+	route, err := newWebhookRoute(spec.URL, spec.Method)
+	if err != nil {
+		return err
+	}
+	if route != nil && spec.BatchSize > 1 {
+		return errors.New("batched webhook sinks cannot have a templated url or method")
+	}
+	if !isTemplate(spec.URL) {
+		if err := validWebhookURL(spec.URL); err != nil {
+			return err
+		}
+	}
+	if spec.Method != "" && !isTemplate(spec.Method) {
+		return validWebhookMethod(strings.ToUpper(spec.Method))
+	}
+	return nil
+}
+
+func validWebhookMethod(method string) error {
+	if !webhookMethods[method] {
+		return fmt.Errorf("unsupported webhook method %q, use POST, PUT, PATCH or DELETE", method)
+	}
+	return nil
+}
+
+// validWebhookURL checks that a URL is an absolute http or https URL.
+func validWebhookURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid webhook url: %v", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("invalid webhook url %q, not an absolute http or https url", rawURL)
+	}
+	return nil
+}
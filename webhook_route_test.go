@@ -0,0 +1,94 @@
+package sest
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestWebhookSinkRoute(t *testing.T) {
+	event := RenderedEvent{
+		EventType: "LoginFailed",
+		Groups:    []string{"login of alice failed", "alice"},
+		Fields:    map[string]string{"host": "web-1"},
+		Severity:  SeverityError,
+		Body:      []byte("body"),
+	}
+	tests := []struct {
+		name   string
+		url    string
+		method string
+		// path and wantMethod are those of the request, none is sent if
+		// err is set.
+		path       string
+		wantMethod string
+		err        string
+	}{
+		{name: "static", url: "/events", path: "/events", wantMethod: "POST"},
+		{name: "static method", url: "/events", method: "put", path: "/events", wantMethod: "PUT"},
+		{name: "group in url", url: "/users/{{.group1}}", path: "/users/alice", wantMethod: "POST"},
+		{name: "field and event type in url", url: "/{{.host}}/{{.EventType}}", path: "/web-1/LoginFailed", wantMethod: "POST"},
+		{name: "query", url: "/events?user={{.group1 | urlquery}}", path: "/events?user=alice", wantMethod: "POST"},
+		{name: "templated method", url: "/users/{{.group1}}", method: `{{if eq .Severity "error"}}delete{{else}}put{{end}}`, path: "/users/alice", wantMethod: "DELETE"},
+		{name: "unsupported method", url: "/events", method: "{{.group1}}", err: `unsupported webhook method "ALICE"`},
+		{name: "missing key", url: "/{{.user}}", err: "could not render webhook url"},
+		{name: "rendered url not absolute", url: "{{.group1}}", err: "not an absolute http or https url"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newWebhookServer(t)
+			url := tt.url
+			if strings.HasPrefix(url, "/") {
+				url = server.URL + url
+			}
+			sink, err := newWebhookSinkFromSpec(server.Client(), SinkConfig{Type: "webhook", URL: url, Method: tt.method})
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = sink.Deliver(context.Background(), event)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("Deliver() = %v, want an error containing %q", err, tt.err)
+				}
+				// Events that cannot be routed are not retried.
+				var perm permanentError
+				if !errors.As(err, &perm) {
+					t.Errorf("Deliver() = %v, want a permanent error", err)
+				}
+				if requests := server.received(0); len(requests) > 0 {
+					t.Errorf("got requests %v, want none", requests)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			requests := server.received(1)
+			if len(requests) != 1 || requests[0].Path != tt.path || requests[0].Method != tt.wantMethod {
+				t.Errorf("got requests %+v, want %s %s", requests, tt.wantMethod, tt.path)
+			}
+		})
+	}
+}
+
+func TestNewWebhookRoute(t *testing.T) {
+	tests := []struct {
+		url    string
+		method string
+		route  bool
+		err    bool
+	}{
+		{url: "http://localhost/events", method: "POST"},
+		{url: "http://localhost/{{.group1}}", method: "POST", route: true},
+		{url: "http://localhost/events", method: "{{.Severity}}", route: true},
+		{url: "http://localhost/{{.group1", method: "POST", err: true},
+		{url: "http://localhost/events", method: "{{if}}", err: true},
+	}
+	for _, tt := range tests {
+		route, err := newWebhookRoute(tt.url, tt.method)
+		if (err != nil) != tt.err || (route != nil) != tt.route {
+			t.Errorf("newWebhookRoute(%q, %q) = %v, %v", tt.url, tt.method, route, err)
+		}
+	}
+}
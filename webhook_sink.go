@@ -0,0 +1,132 @@
+package sest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const defaultContentType = "application/json"
+
+// webhookSink POSTs the rendered event body to a URL, with the static headers
+// of the sink. The URL and method may be templates rendered per event.
+type webhookSink struct {
+	client      *http.Client
+	url         string
+	method      string
+	contentType string
+	headers     http.Header
+	// route renders the URL and method per event, nil if neither is a
+	// template.
+	route *webhookRoute
+}
+
+func newWebhookSink(client *http.Client, url, contentType string, headers http.Header) *webhookSink {
+	if contentType == "" {
+		contentType = defaultContentType
+	}
+	return &webhookSink{client: client, url: url, method: http.MethodPost, contentType: contentType, headers: headers}
+}
+
+// newWebhookSinkFromSpec returns a webhook sink delivering single events as
+// configured by spec.
+func newWebhookSinkFromSpec(client *http.Client, spec SinkConfig) (*webhookSink, error) {
+	s := newWebhookSink(client, spec.URL, spec.ContentType, webhookHeaders(spec))
+	s.method = webhookMethod(spec)
+	var err error
+	s.route, err = newWebhookRoute(s.url, s.method)
+	return s, err
+}
+
+// webhookMethod returns the method of a webhook sink, POST by default and
+// upper case unless it is a template.
+func webhookMethod(spec SinkConfig) string {
+	if spec.Method == "" {
+		return http.MethodPost
+	}
+	if isTemplate(spec.Method) {
+		return spec.Method
+	}
+	return strings.ToUpper(spec.Method)
+}
+
+// webhookHeaders returns the headers a webhook sink sends with every request,
+// its headers and the Authorization header of its bearer token. References
+// to environment variables like ${TOKEN} in the values are expanded, so
+// secrets need not be in the config file.
+func webhookHeaders(spec SinkConfig) http.Header {
+	headers := make(http.Header, len(spec.Headers)+1)
+	for name, value := range spec.Headers {
+		headers.Set(name, os.ExpandEnv(value))
+	}
+	if spec.BearerToken != "" {
+		headers.Set("Authorization", "Bearer "+os.ExpandEnv(spec.BearerToken))
+	}
+	return headers
+}
+
+// newBatchWebhookSink returns a webhook sink posting batches of events as
+// configured by spec.
+func newBatchWebhookSink(client *http.Client, spec SinkConfig, retry retryPolicy, deadLetter *fileSink) *batchSink {
+	s := newWebhookSink(client, spec.URL, spec.ContentType, webhookHeaders(spec))
+	s.method = webhookMethod(spec)
+	if spec.ContentType == "" && spec.BatchFormat == "ndjson" {
+		s.contentType = "application/x-ndjson"
+	}
+	return newBatchSink(webhookBatch{webhook: s, ndjson: spec.BatchFormat == "ndjson"}, spec, retry, deadLetter)
+}
+
+func (s *webhookSink) Deliver(ctx context.Context, e RenderedEvent) error {
+	if s.route == nil {
+		return s.post(ctx, e.Body, s.contentType)
+	}
+	method, url, err := s.route.render(e)
+	if err != nil {
+		return permanent(err)
+	}
+	return s.send(ctx, method, url, e.Body, s.contentType)
+}
+
+// post sends body to the URL of the sink.
+func (s *webhookSink) post(ctx context.Context, body []byte, contentType string) error {
+	return s.send(ctx, s.method, s.url, body, contentType)
+}
+
+// send sends body to url with method.
+func (s *webhookSink) send(ctx context.Context, method, url string, body []byte, contentType string) error {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for name, values := range s.headers {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respBody, _ := ioutil.ReadAll(resp.Body)
+		err := fmt.Errorf("unexpected status %d: %s", resp.StatusCode, bytes.TrimSpace(respBody))
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+			return permanent(err)
+		}
+		return err
+	}
+	// The connection is only reused once the body was read to the end.
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+func (s *webhookSink) String() string {
+	return "webhook " + s.url
+}
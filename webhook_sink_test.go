@@ -0,0 +1,114 @@
+package sest
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestWebhookSinkHeaders(t *testing.T) {
+	t.Setenv("SEST_TEST_TOKEN", "s3cr3t")
+	tests := []struct {
+		name string
+		spec SinkConfig
+		want map[string]string
+	}{
+		{
+			name: "none",
+			spec: SinkConfig{},
+			want: map[string]string{"Authorization": "", "Content-Type": "application/json"},
+		},
+		{
+			name: "bearer token",
+			spec: SinkConfig{BearerToken: "t0k3n"},
+			want: map[string]string{"Authorization": "Bearer t0k3n"},
+		},
+		{
+			name: "bearer token from environment",
+			spec: SinkConfig{BearerToken: "${SEST_TEST_TOKEN}"},
+			want: map[string]string{"Authorization": "Bearer s3cr3t"},
+		},
+		{
+			name: "headers",
+			spec: SinkConfig{Headers: map[string]string{"x-api-key": "$SEST_TEST_TOKEN", "X-Source": "sest"}},
+			want: map[string]string{"X-Api-Key": "s3cr3t", "X-Source": "sest", "Authorization": ""},
+		},
+		{
+			name: "authorization header",
+			spec: SinkConfig{Headers: map[string]string{"Authorization": "Basic YWxpY2U6c2VjcmV0"}},
+			want: map[string]string{"Authorization": "Basic YWxpY2U6c2VjcmV0"},
+		},
+		{
+			// The content type of the sink wins over a header.
+			name: "content type header",
+			spec: SinkConfig{ContentType: "text/plain", Headers: map[string]string{"Content-Type": "application/xml"}},
+			want: map[string]string{"Content-Type": "text/plain"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newWebhookServer(t)
+			spec := tt.spec
+			spec.Type = "webhook"
+			spec.URL = server.URL
+			sink, err := newWebhookSinkFromSpec(server.Client(), spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := sink.Deliver(context.Background(), RenderedEvent{EventType: "E", Body: []byte("body")}); err != nil {
+				t.Fatal(err)
+			}
+			requests := server.received(1)
+			if len(requests) != 1 {
+				t.Fatalf("got %d requests, want 1", len(requests))
+			}
+			for name, want := range tt.want {
+				if got := requests[0].Header.Get(name); got != want {
+					t.Errorf("header %s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+// TestWebhookSinkHeadersExpandedOnce checks that the environment variables in
+// the headers are expanded when the sink is created, not per request.
+func TestWebhookSinkHeadersExpandedOnce(t *testing.T) {
+	t.Setenv("SEST_TEST_TOKEN", "before")
+	headers := webhookHeaders(SinkConfig{BearerToken: "$SEST_TEST_TOKEN", Headers: map[string]string{"X-Key": "${SEST_TEST_TOKEN}"}})
+	t.Setenv("SEST_TEST_TOKEN", "after")
+	want := http.Header{"Authorization": {"Bearer before"}, "X-Key": {"before"}}
+	if len(headers) != len(want) || headers.Get("Authorization") != want.Get("Authorization") || headers.Get("X-Key") != want.Get("X-Key") {
+		t.Errorf("webhookHeaders() = %v, want %v", headers, want)
+	}
+}
+
+// TestWebhookSinkReusesConnections checks that the events are delivered over
+// one connection, although the server answers with a large body.
+func TestWebhookSinkReusesConnections(t *testing.T) {
+	var conns atomic.Int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("accepted\n", 100000)))
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	sink := newWebhookSink(server.Client(), server.URL, defaultContentType, nil)
+	for i := 0; i < 5; i++ {
+		if err := sink.Deliver(context.Background(), RenderedEvent{EventType: "E", Body: []byte("body")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := conns.Load(); got != 1 {
+		t.Errorf("events were delivered over %d connections, want 1", got)
+	}
+}